@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcutil/bech32"
+	"github.com/echovl/cardano-go"
+	cardanocrypto "github.com/echovl/cardano-go/crypto"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Bech32 human readable parts for native segwit bitcoin addresses
+var bitcoinHRP = map[string]string{
+	Mainnet: "bc",
+	Testnet: "tb",
+}
+
+// deriveECDSAAddress returns the blockchain specific address for the group public key stored in ShareData.PK
+func deriveECDSAAddress(blockchainId, pk string) (string, error) {
+	publicKey, err := parseECDSAPublicKey(pk)
+	if err != nil {
+		return "", err
+	}
+
+	switch blockchainId {
+	case "ETH", "AVAX", "BNB", "MATIC":
+		// EIP-55 checksummed hex address
+		return crypto.PubkeyToAddress(*publicKey).Hex(), nil
+
+	case "BTC":
+		// P2WPKH: witness version 0 program of hash160 of the compressed public key
+		return bitcoinP2WPKHAddress(crypto.CompressPubkey(publicKey), bitcoinHRP[Network])
+	}
+
+	return "", fmt.Errorf("address derivation not supported for blockchain: %s", blockchainId)
+}
+
+// deriveEDDSAAddress returns the blockchain specific address for an eddsa public key
+func deriveEDDSAAddress(blockchainId string, pk ed25519.PublicKey) (string, error) {
+	switch blockchainId {
+	case "ADA":
+		return cardanoEnterpriseAddress(pk)
+	case "ALGO":
+		return algorandAddress(pk).String(), nil
+	case "SOL":
+		return solanaAddress(pk), nil
+	case "XLM":
+		return stellarAddress(pk), nil
+	}
+
+	return "", fmt.Errorf("address derivation not supported for blockchain: %s", blockchainId)
+}
+
+// verifyAddress checks a client supplied address against the derived address, an empty
+// address is accepted and replaced by the derived address
+func verifyAddress(blockchainId, address, derived string) (string, error) {
+	if address == "" {
+		return derived, nil
+	}
+
+	match := address == derived
+	switch blockchainId {
+	case "ETH", "AVAX", "BNB", "MATIC":
+		// all lower or all upper case addresses carry no EIP-55 checksum
+		hexAddress := strings.TrimPrefix(address, "0x")
+		if hexAddress == strings.ToLower(hexAddress) || hexAddress == strings.ToUpper(hexAddress) {
+			match = strings.EqualFold(address, derived)
+		}
+	case "BTC":
+		// bech32 addresses are case insensitive but must not mix cases
+		if address == strings.ToLower(address) || address == strings.ToUpper(address) {
+			match = strings.EqualFold(address, derived)
+		}
+	}
+
+	if !match {
+		return "", fmt.Errorf("address %s does not match the share public key, expected %s", address, derived)
+	}
+
+	return derived, nil
+}
+
+// bitcoinP2WPKHAddress encodes a compressed public key as a native segwit v0 address
+func bitcoinP2WPKHAddress(compressedPK []byte, hrp string) (string, error) {
+	program, err := bech32.ConvertBits(hash160(compressedPK), 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	return bech32.Encode(hrp, append([]byte{0x00}, program...))
+}
+
+// hash160 returns ripemd160(sha256(data))
+func hash160(data []byte) []byte {
+	sha := sha256.Sum256(data)
+	hasher := ripemd160.New()
+	hasher.Write(sha[:])
+	return hasher.Sum(nil)
+}
+
+// cardanoEnterpriseAddress returns the bech32 enterprise address (payment key only) for an eddsa public key
+func cardanoEnterpriseAddress(pk ed25519.PublicKey) (string, error) {
+	network := cardano.Mainnet
+	if Network == Testnet {
+		network = cardano.Testnet
+	}
+
+	credential, err := cardano.NewKeyCredential(cardanocrypto.PubKey(pk))
+	if err != nil {
+		return "", err
+	}
+	address, err := cardano.NewEnterpriseAddress(network, credential)
+	if err != nil {
+		return "", err
+	}
+
+	return address.Bech32(), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// public key of private key 1, the secp256k1 generator point
+var generatorPK = fmt.Sprintf(`{"CurveName":"secp256k1","X":%s,"Y":%s}`, crypto.S256().Params().Gx, crypto.S256().Params().Gy)
+
+func TestDeriveECDSAAddress(t *testing.T) {
+	address, err := deriveECDSAAddress("ETH", generatorPK)
+	if err != nil || address != "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf" {
+		t.Error("ETH address does not match EIP-55 checksummed address")
+	}
+
+	address, err = deriveECDSAAddress("BTC", generatorPK)
+	if err != nil || address != "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4" {
+		t.Error("BTC address does not match P2WPKH address")
+	}
+
+	_, err = deriveECDSAAddress("ETH", `{"CurveName":"secp256k1","X":1,"Y":1}`)
+	if err == nil {
+		t.Error("Point not on curve should be rejected")
+	}
+}
+
+func TestDeriveEDDSAAddress(t *testing.T) {
+	pk, _ := hex.DecodeString("d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a")
+
+	address, err := deriveEDDSAAddress("ADA", ed25519.PublicKey(pk))
+	if err != nil || !strings.HasPrefix(address, "addr1v") {
+		t.Error("ADA address should be a mainnet enterprise address")
+	}
+
+	address, err = deriveEDDSAAddress("ALGO", ed25519.PublicKey(pk))
+	if err != nil || len(address) != 58 {
+		t.Error("ALGO address should be 58 characters")
+	}
+}
+
+func TestVerifyAddress(t *testing.T) {
+	derived := "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf"
+
+	address, err := verifyAddress("ETH", "", derived)
+	if err != nil || address != derived {
+		t.Error("Empty address should be filled with the derived address")
+	}
+
+	address, err = verifyAddress("ETH", strings.ToLower(derived), derived)
+	if err != nil || address != derived {
+		t.Error("Lower case address should match and be checksummed")
+	}
+
+	_, err = verifyAddress("ETH", "0x7e5F4552091A69125d5DfCb7b8C2659029395Bdf", derived)
+	if err == nil {
+		t.Error("Address with invalid checksum should be rejected")
+	}
+
+	_, err = verifyAddress("ETH", "0xba536245A30404A983E120a3d07A7dF260a89669", derived)
+	if err == nil {
+		t.Error("Address of a different key should be rejected")
+	}
+}
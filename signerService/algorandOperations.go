@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/algorand/go-algorand-sdk/crypto"
+	"github.com/algorand/go-algorand-sdk/encoding/msgpack"
+	"github.com/algorand/go-algorand-sdk/types"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Domain separation prefix algorand prepends to a transaction before hashing and signing
+var algorandTxPrefix = []byte("TX")
+
+// PrepareAlgorandTransaction canonically encodes an unsigned algorand transaction or group of
+// transactions, assigns the group id for atomic transfers and returns the "TX" prefixed payloads
+// the client needs to compute its partial eddsa signatures
+func PrepareAlgorandTransaction(c *gin.Context) {
+	userId := c.Param("userId")
+	accountName := c.Param("accountName")
+
+	var txRequest AlgorandTxRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&txRequest)
+	if err != nil {
+		log.Error("Error decoding algorand tx: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	defer CloseClientDB(DB)
+
+	share, err := readEDDSAShare(userId, "ALGO", accountName, keyShareCollection)
+	if err != nil {
+		log.Error("Error reading share err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	response, _, err := prepareAlgorandGroup(txRequest.Transactions, share.PK)
+	if err != nil {
+		log.Error("Error preparing algorand tx:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(response, nil, c.Writer)
+	return
+}
+
+// POSTAlgorandSignature completes the signing flow for a prepared algorand transaction or group.
+// Every transaction sent by the account is signed with the eddsa custody share and returned as
+// msgpack encoded signed transaction bytes ready for submission
+func POSTAlgorandSignature(c *gin.Context) {
+	userId := c.Param("userId")
+	accountName := c.Param("accountName")
+
+	var txRequest AlgorandTxRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&txRequest)
+	if err != nil {
+		log.Error("Error decoding algorand tx: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	if len(txRequest.Signatures) != len(txRequest.Transactions) {
+		log.Error("Error signing algorand tx: signature count mismatch")
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "one signature entry is required per transaction"), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	defer CloseClientDB(DB)
+
+	share, err := readEDDSAShare(userId, "ALGO", accountName, keyShareCollection)
+	if err != nil {
+		log.Error("Error reading share err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	response, txs, err := prepareAlgorandGroup(txRequest.Transactions, share.PK)
+	if err != nil {
+		log.Error("Error preparing algorand tx:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var signedGroup []byte
+	for i, tx := range txs {
+		if !response.Transactions[i].Signer {
+			continue
+		}
+
+		signature, err := completeEDDSASignature(share, algorandBytesToSign(tx), txRequest.Signatures[i])
+		if err != nil {
+			log.Error("Error generating full signature:", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+
+		signedTx := signAlgorandTransaction(tx, signature)
+		response.Transactions[i].SignedTx = base64.StdEncoding.EncodeToString(signedTx)
+		signedGroup = append(signedGroup, signedTx...)
+	}
+
+	txCollection := DB.Database(MongoDatabase).Collection("TxCollection")
+	for _, tx := range response.Transactions {
+		if tx.SignedTx != "" {
+			recordSignedTransaction(userId, "ALGO", accountName, SignedTxResponse{TxHash: tx.TxId, SignedTx: tx.SignedTx}, txCollection)
+		}
+	}
+
+	// the group can only be submitted directly when every transaction was signed by the account
+	if len(signedGroup) > 0 && allAlgorandTxSigned(response.Transactions) {
+		response.SignedGroup = base64.StdEncoding.EncodeToString(signedGroup)
+	}
+
+	ValidateAndWriteResponse(response, nil, c.Writer)
+	return
+}
+
+// prepareAlgorandGroup decodes the unsigned transactions, assigns or checks the group id and
+// marks which transactions are sent by the account owning the eddsa public key
+func prepareAlgorandGroup(encodedTxs []string, pk string) (AlgorandTxResponse, []types.Transaction, error) {
+	var response AlgorandTxResponse
+
+	publicKey, err := parseEDDSAPublicKey(pk)
+	if err != nil {
+		return response, nil, err
+	}
+	address := algorandAddress(publicKey)
+
+	txs, err := decodeAlgorandTransactions(encodedTxs)
+	if err != nil {
+		return response, nil, err
+	}
+
+	txs, groupId, err := assignAlgorandGroup(txs)
+	if err != nil {
+		return response, nil, err
+	}
+	if groupId != (types.Digest{}) {
+		response.GroupId = base64.StdEncoding.EncodeToString(groupId[:])
+	}
+
+	for _, tx := range txs {
+		response.Transactions = append(response.Transactions, AlgorandTx{
+			TxId:        crypto.TransactionIDString(tx),
+			Transaction: base64.StdEncoding.EncodeToString(msgpack.Encode(tx)),
+			BytesToSign: hex.EncodeToString(algorandBytesToSign(tx)),
+			Signer:      tx.Sender == address,
+		})
+	}
+
+	return response, txs, nil
+}
+
+// decodeAlgorandTransactions decodes base64 msgpack encoded unsigned transactions
+func decodeAlgorandTransactions(encodedTxs []string) ([]types.Transaction, error) {
+	if len(encodedTxs) == 0 {
+		return nil, fmt.Errorf("no algorand transactions provided")
+	}
+	if len(encodedTxs) > types.MaxTxGroupSize {
+		return nil, fmt.Errorf("algorand group too large, %d > max size %d", len(encodedTxs), types.MaxTxGroupSize)
+	}
+
+	var txs []types.Transaction
+	for i, encodedTx := range encodedTxs {
+		txBytes, err := base64.StdEncoding.DecodeString(encodedTx)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding algorand tx %d: %s", i, err)
+		}
+
+		var tx types.Transaction
+		err = msgpack.Decode(txBytes, &tx)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding algorand tx %d: %s", i, err)
+		}
+		txs = append(txs, tx)
+	}
+
+	return txs, nil
+}
+
+// assignAlgorandGroup computes the group id for an atomic transfer. Transactions that already carry
+// a group id are kept as is, since the account may only sign its own part of a larger group
+func assignAlgorandGroup(txs []types.Transaction) ([]types.Transaction, types.Digest, error) {
+	var empty types.Digest
+	existing := txs[0].Group
+	for _, tx := range txs {
+		if tx.Group != existing {
+			return nil, empty, fmt.Errorf("algorand transactions have inconsistent group ids")
+		}
+	}
+	if existing != empty || len(txs) == 1 {
+		return txs, existing, nil
+	}
+
+	groupId, err := crypto.ComputeGroupID(txs)
+	if err != nil {
+		return nil, empty, err
+	}
+
+	grouped := make([]types.Transaction, len(txs))
+	for i, tx := range txs {
+		tx.Group = groupId
+		grouped[i] = tx
+	}
+
+	return grouped, groupId, nil
+}
+
+// algorandBytesToSign returns the "TX" prefixed canonical msgpack encoding of a transaction
+func algorandBytesToSign(tx types.Transaction) []byte {
+	return bytes.Join([][]byte{algorandTxPrefix, msgpack.Encode(tx)}, nil)
+}
+
+// signAlgorandTransaction returns the msgpack encoded signed transaction
+func signAlgorandTransaction(tx types.Transaction, signature []byte) []byte {
+	var sig types.Signature
+	copy(sig[:], signature)
+
+	return msgpack.Encode(types.SignedTxn{Sig: sig, Txn: tx})
+}
+
+// algorandAddress returns the algorand address for an eddsa public key
+func algorandAddress(pk ed25519.PublicKey) types.Address {
+	var address types.Address
+	copy(address[:], pk)
+	return address
+}
+
+// allAlgorandTxSigned reports whether every transaction in the group is signed
+func allAlgorandTxSigned(txs []AlgorandTx) bool {
+	for _, tx := range txs {
+		if tx.SignedTx == "" {
+			return false
+		}
+	}
+	return true
+}
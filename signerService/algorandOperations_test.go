@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/crypto"
+	"github.com/algorand/go-algorand-sdk/encoding/msgpack"
+	"github.com/algorand/go-algorand-sdk/types"
+)
+
+func TestAlgorandGroupSigning(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("Error generating key")
+	}
+	sender := algorandAddress(pk)
+
+	var encodedTxs []string
+	var expectedTxs []types.Transaction
+	for _, amount := range []uint64{1000, 2000} {
+		tx := types.Transaction{
+			Type: types.PaymentTx,
+			Header: types.Header{
+				Sender:     sender,
+				Fee:        1000,
+				FirstValid: 1,
+				LastValid:  1001,
+			},
+			PaymentTxnFields: types.PaymentTxnFields{
+				Receiver: types.Address{1},
+				Amount:   types.MicroAlgos(amount),
+			},
+		}
+		expectedTxs = append(expectedTxs, tx)
+		encodedTxs = append(encodedTxs, base64.StdEncoding.EncodeToString(msgpack.Encode(tx)))
+	}
+
+	response, txs, err := prepareAlgorandGroup(encodedTxs, hex.EncodeToString(pk))
+	if err != nil {
+		t.Fatal("Error preparing group:", err)
+	}
+
+	groupId, _ := crypto.ComputeGroupID(expectedTxs)
+	if response.GroupId != base64.StdEncoding.EncodeToString(groupId[:]) {
+		t.Error("Group id does not match sdk group id")
+	}
+
+	for i, tx := range txs {
+		if !response.Transactions[i].Signer {
+			t.Error("Transaction should be signed by the account")
+		}
+		if tx.Group != groupId {
+			t.Error("Group id not assigned to transaction")
+		}
+
+		signature := ed25519.Sign(sk, algorandBytesToSign(tx))
+		_, expected, err := crypto.SignTransaction(sk, tx)
+		if err != nil {
+			t.Fatal("Error signing with sdk:", err)
+		}
+		if !bytes.Equal(signAlgorandTransaction(tx, signature), expected) {
+			t.Error("Signed transaction does not match sdk encoding")
+		}
+	}
+
+	_, _, err = prepareAlgorandGroup([]string{"not base64"}, hex.EncodeToString(pk))
+	if err == nil {
+		t.Error("Invalid transaction should not decode")
+	}
+}
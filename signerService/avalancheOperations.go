@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/btcsuite/btcutil/bech32"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Avalanche codec type ids of the secp256k1fx types shared by the X, P and C chain codecs
+const (
+	avalancheTransferInputType  uint32 = 5
+	avalancheTransferOutputType uint32 = 7
+	avalancheCredentialType     uint32 = 9
+	avalancheCodecVersion       uint16 = 0
+)
+
+// Avalanche network ids and bech32 human readable parts of X and P chain addresses
+var avalancheNetworkIds = map[string]uint32{
+	Mainnet: 1,
+	Testnet: 5,
+}
+
+var avalancheHRP = map[string]string{
+	Mainnet: "avax",
+	Testnet: "fuji",
+}
+
+// avalancheChain is the adapter of one Avalanche chain, each chain has its own codec type ids for
+// atomic import and export transactions
+type avalancheChain struct {
+	importTxType uint32
+	exportTxType uint32
+	parse        func(reader *avalancheReader, txType uint32, chain avalancheChain) ([]int, error)
+}
+
+var avalancheChains = map[string]avalancheChain{
+	"X": {importTxType: 3, exportTxType: 4, parse: parseAvalancheUTXOTx},
+	"P": {importTxType: 17, exportTxType: 18, parse: parseAvalancheUTXOTx},
+	"C": {importTxType: 0, exportTxType: 1, parse: parseAvalancheAtomicTx},
+}
+
+// GetAvalancheAddresses returns the C, X and P chain addresses of an AVAX account
+func GetAvalancheAddresses(c *gin.Context) {
+	userId := c.Param("userId")
+	accountName := c.Param("accountName")
+
+	pk, err := readAvalanchePublicKey(userId, accountName)
+	if err != nil {
+		log.Error("Error reading public key err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	addresses, err := avalancheAddresses(pk)
+	if err != nil {
+		log.Error("Error deriving address err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(addresses, nil, c.Writer)
+	return
+}
+
+// PrepareAvalancheTransaction validates an unsigned import or export transaction of a chain and returns
+// the sha256 hash that is signed as messageHash in the MPC signing flow
+func PrepareAvalancheTransaction(c *gin.Context) {
+	chain := c.Param("chain")
+
+	var txRequest AvalancheTxRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&txRequest)
+	if err != nil {
+		log.Error("Error decoding avalanche tx: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	payload, _, _, err := prepareAvalancheTransaction(chain, txRequest.UnsignedTx)
+	if err != nil {
+		log.Error("Error preparing avalanche tx err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(payload, nil, c.Writer)
+	return
+}
+
+// POSTAvalancheSignature adds the combined MPC signature as credentials of every input and returns
+// the signed import or export transaction
+func POSTAvalancheSignature(c *gin.Context) {
+	userId := c.Param("userId")
+	chain := c.Param("chain")
+	accountName := c.Param("accountName")
+
+	var txRequest AvalancheTxRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&txRequest)
+	if err != nil {
+		log.Error("Error decoding avalanche tx: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	_, unsignedTx, credentials, err := prepareAvalancheTransaction(chain, txRequest.UnsignedTx)
+	if err != nil {
+		log.Error("Error preparing avalanche tx err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	pk, err := readAvalanchePublicKey(userId, accountName)
+	if err != nil {
+		log.Error("Error reading public key err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var signature ECDSASignature
+	err = json.Unmarshal([]byte(txRequest.Signature), &signature)
+	if err != nil {
+		log.Error("Error decoding signature: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	signedTx, err := assembleAvalancheTransaction(unsignedTx, credentials, signature, pk)
+	if err != nil {
+		log.Error("Error assembling signed tx err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(signedTx, nil, c.Writer)
+	return
+}
+
+// readAvalanchePublicKey reads the group public key of an AVAX account
+func readAvalanchePublicKey(userId, accountName string) (*ecdsa.PublicKey, error) {
+	var DB *mongo.Client = ConnectDB()
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	defer CloseClientDB(DB)
+
+	share, err := readECDSAShare(userId, "AVAX", accountName, keyShareCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseECDSAPublicKey(share.ShareData.PK)
+}
+
+// avalancheAddresses returns the C chain hex address and the X and P chain bech32 addresses of a public key,
+// all three are derived from the same key
+func avalancheAddresses(pk *ecdsa.PublicKey) (AvalancheAddresses, error) {
+	program, err := bech32.ConvertBits(hash160(crypto.CompressPubkey(pk)), 8, 5, true)
+	if err != nil {
+		return AvalancheAddresses{}, err
+	}
+	address, err := bech32.Encode(avalancheHRP[Network], program)
+	if err != nil {
+		return AvalancheAddresses{}, err
+	}
+
+	return AvalancheAddresses{
+		C: crypto.PubkeyToAddress(*pk).Hex(),
+		X: "X-" + address,
+		P: "P-" + address,
+	}, nil
+}
+
+// prepareAvalancheTransaction decodes and validates a hex encoded unsigned transaction of a chain, it returns
+// the signing payload, the transaction bytes and the number of signatures of every credential
+func prepareAvalancheTransaction(chainAlias, unsignedTxHex string) (AvalancheTxPayload, []byte, []int, error) {
+	chain, ok := avalancheChains[strings.ToUpper(chainAlias)]
+	if !ok {
+		return AvalancheTxPayload{}, nil, nil, fmt.Errorf("unsupported avalanche chain: %s", chainAlias)
+	}
+
+	unsignedTx, err := hex.DecodeString(strings.TrimPrefix(unsignedTxHex, "0x"))
+	if err != nil {
+		return AvalancheTxPayload{}, nil, nil, fmt.Errorf("Error decoding unsigned tx: %s", err)
+	}
+
+	reader := &avalancheReader{data: unsignedTx}
+	if reader.uint16() != avalancheCodecVersion {
+		return AvalancheTxPayload{}, nil, nil, fmt.Errorf("unsupported avalanche codec version")
+	}
+	txType := reader.uint32()
+
+	var payload AvalancheTxPayload
+	switch txType {
+	case chain.importTxType:
+		payload.TxType = "import"
+	case chain.exportTxType:
+		payload.TxType = "export"
+	default:
+		return AvalancheTxPayload{}, nil, nil, fmt.Errorf("only import and export transactions are supported, type: %d", txType)
+	}
+
+	if networkId := reader.uint32(); reader.err == nil && networkId != avalancheNetworkIds[Network] {
+		return AvalancheTxPayload{}, nil, nil, fmt.Errorf("transaction network id %d does not match %s", networkId, Network)
+	}
+	reader.bytes(32) // blockchain id
+
+	credentials, err := chain.parse(reader, txType, chain)
+	if err != nil {
+		return AvalancheTxPayload{}, nil, nil, err
+	}
+	if reader.err != nil {
+		return AvalancheTxPayload{}, nil, nil, reader.err
+	}
+	if reader.offset != len(unsignedTx) {
+		return AvalancheTxPayload{}, nil, nil, fmt.Errorf("unexpected trailing bytes in unsigned tx")
+	}
+
+	hash := sha256.Sum256(unsignedTx)
+	payload.Hash = hex.EncodeToString(hash[:])
+	payload.Credentials = len(credentials)
+	return payload, unsignedTx, credentials, nil
+}
+
+// parseAvalancheUTXOTx parses the body of an X or P chain import or export transaction and returns the
+// number of signatures of the credential of every input
+func parseAvalancheUTXOTx(reader *avalancheReader, txType uint32, chain avalancheChain) ([]int, error) {
+	err := reader.transferableOutputs()
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := reader.transferableInputs()
+	if err != nil {
+		return nil, err
+	}
+	reader.bytes(int(reader.uint32())) // memo
+
+	reader.bytes(32) // source or destination chain
+	if txType == chain.importTxType {
+		imported, err := reader.transferableInputs()
+		if err != nil {
+			return nil, err
+		}
+		return append(credentials, imported...), nil
+	}
+
+	return credentials, reader.transferableOutputs()
+}
+
+// parseAvalancheAtomicTx parses the body of a C chain atomic import or export transaction, every EVM
+// input of an export is signed once
+func parseAvalancheAtomicTx(reader *avalancheReader, txType uint32, chain avalancheChain) ([]int, error) {
+	reader.bytes(32) // source or destination chain
+
+	if txType == chain.importTxType {
+		credentials, err := reader.transferableInputs()
+		if err != nil {
+			return nil, err
+		}
+		// EVM outputs: address, amount and asset id
+		reader.bytes(int(reader.uint32()) * (20 + 8 + 32))
+		return credentials, nil
+	}
+
+	// EVM inputs: address, amount, asset id and nonce
+	numInputs := int(reader.uint32())
+	reader.bytes(numInputs * (20 + 8 + 32 + 8))
+	credentials := make([]int, numInputs)
+	for i := range credentials {
+		credentials[i] = 1
+	}
+
+	return credentials, reader.transferableOutputs()
+}
+
+// assembleAvalancheTransaction appends a secp256k1fx credential for every input to the unsigned
+// transaction, the id of the signed transaction is the cb58 encoded sha256 of its bytes
+func assembleAvalancheTransaction(unsignedTx []byte, credentials []int, signature ECDSASignature, pk *ecdsa.PublicKey) (SignedTxResponse, error) {
+	hash := sha256.Sum256(unsignedTx)
+	sig, err := recoverableSignature(signature, hash[:], pk)
+	if err != nil {
+		return SignedTxResponse{}, err
+	}
+
+	var signedTx bytes.Buffer
+	signedTx.Write(unsignedTx)
+	binary.Write(&signedTx, binary.BigEndian, uint32(len(credentials)))
+	for _, numSignatures := range credentials {
+		binary.Write(&signedTx, binary.BigEndian, avalancheCredentialType)
+		binary.Write(&signedTx, binary.BigEndian, uint32(numSignatures))
+		for i := 0; i < numSignatures; i++ {
+			signedTx.Write(sig)
+		}
+	}
+
+	txId := sha256.Sum256(signedTx.Bytes())
+	return SignedTxResponse{TxHash: cb58Encode(txId[:]), SignedTx: hex.EncodeToString(signedTx.Bytes())}, nil
+}
+
+// cb58Encode returns the base58 encoding of data followed by the last 4 bytes of its sha256 checksum
+func cb58Encode(data []byte) string {
+	checksum := sha256.Sum256(data)
+	return base58.Encode(append(append([]byte{}, data...), checksum[28:]...))
+}
+
+// avalancheReader reads big endian codec values, the first error stops further reads
+type avalancheReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (reader *avalancheReader) bytes(n int) []byte {
+	if reader.err != nil {
+		return nil
+	}
+	if n < 0 || reader.offset+n > len(reader.data) {
+		reader.err = fmt.Errorf("unsigned tx is too short")
+		return nil
+	}
+	value := reader.data[reader.offset : reader.offset+n]
+	reader.offset += n
+	return value
+}
+
+func (reader *avalancheReader) uint16() uint16 {
+	value := reader.bytes(2)
+	if value == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(value)
+}
+
+func (reader *avalancheReader) uint32() uint32 {
+	value := reader.bytes(4)
+	if value == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(value)
+}
+
+// transferableOutputs reads asset id and secp256k1fx transfer output: amount, locktime, threshold and addresses
+func (reader *avalancheReader) transferableOutputs() error {
+	numOutputs := int(reader.uint32())
+	for i := 0; i < numOutputs && reader.err == nil; i++ {
+		reader.bytes(32)
+		if outputType := reader.uint32(); reader.err == nil && outputType != avalancheTransferOutputType {
+			return fmt.Errorf("unsupported avalanche output type: %d", outputType)
+		}
+		reader.bytes(8 + 8 + 4)
+		reader.bytes(int(reader.uint32()) * 20)
+	}
+	return reader.err
+}
+
+// transferableInputs reads tx id, output index, asset id and secp256k1fx transfer input: amount and
+// signature indices. It returns the number of signature indices of every input
+func (reader *avalancheReader) transferableInputs() ([]int, error) {
+	numInputs := int(reader.uint32())
+	var credentials []int
+	for i := 0; i < numInputs && reader.err == nil; i++ {
+		reader.bytes(32 + 4 + 32)
+		if inputType := reader.uint32(); reader.err == nil && inputType != avalancheTransferInputType {
+			return nil, fmt.Errorf("unsupported avalanche input type: %d", inputType)
+		}
+		reader.bytes(8)
+		numSignatures := int(reader.uint32())
+		reader.bytes(numSignatures * 4)
+		credentials = append(credentials, numSignatures)
+	}
+	return credentials, reader.err
+}
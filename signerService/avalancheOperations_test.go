@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/btcsuite/btcutil/bech32"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// avalancheExportTx returns an unsigned X chain export transaction with one input and one exported output
+func avalancheExportTx(address []byte) []byte {
+	var tx bytes.Buffer
+	write := func(values ...interface{}) {
+		for _, value := range values {
+			binary.Write(&tx, binary.BigEndian, value)
+		}
+	}
+	assetId := make([]byte, 32)
+	write(avalancheCodecVersion, avalancheChains["X"].exportTxType, avalancheNetworkIds[Network], make([]byte, 32))
+	// change output
+	write(uint32(1), assetId, avalancheTransferOutputType, uint64(900), uint64(0), uint32(1), uint32(1), address)
+	// input signed by one key
+	write(uint32(1), make([]byte, 32), uint32(0), assetId, avalancheTransferInputType, uint64(2000), uint32(1), uint32(0))
+	// empty memo and destination P chain
+	write(uint32(0), make([]byte, 32))
+	// exported output
+	write(uint32(1), assetId, avalancheTransferOutputType, uint64(1000), uint64(0), uint32(1), uint32(1), address)
+	return tx.Bytes()
+}
+
+func TestAvalancheAddresses(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal("Error generating key")
+	}
+
+	addresses, err := avalancheAddresses(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addresses.C != crypto.PubkeyToAddress(key.PublicKey).Hex() {
+		t.Error("C chain address should be the EVM address")
+	}
+	if addresses.X[2:] != addresses.P[2:] || !strings.HasPrefix(addresses.X, "X-") || !strings.HasPrefix(addresses.P, "P-") {
+		t.Error("X and P chain addresses should share the same bech32 address")
+	}
+
+	hrp, program, err := bech32.Decode(addresses.X[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := bech32.ConvertBits(program, 5, 8, false)
+	if hrp != avalancheHRP[Network] || !bytes.Equal(decoded, hash160(crypto.CompressPubkey(&key.PublicKey))) {
+		t.Error("X chain address does not encode the public key hash")
+	}
+}
+
+func TestSignAvalancheExportTransaction(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal("Error generating key")
+	}
+	unsignedTx := avalancheExportTx(hash160(crypto.CompressPubkey(&key.PublicKey)))
+
+	payload, txBytes, credentials, err := prepareAvalancheTransaction("x", hex.EncodeToString(unsignedTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(unsignedTx)
+	if payload.TxType != "export" || payload.Hash != hex.EncodeToString(hash[:]) || payload.Credentials != 1 {
+		t.Error("Unexpected payload:", payload)
+	}
+
+	_, _, _, err = prepareAvalancheTransaction("P", hex.EncodeToString(unsignedTx))
+	if err == nil {
+		t.Error("X chain export type should be rejected on the P chain")
+	}
+	_, _, _, err = prepareAvalancheTransaction("X", hex.EncodeToString(append(unsignedTx, 0)))
+	if err == nil {
+		t.Error("Trailing bytes should be rejected")
+	}
+
+	sig, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		t.Fatal("Error signing tx hash")
+	}
+	signature := ECDSASignature{R: new(big.Int).SetBytes(sig[:32]), S: new(big.Int).SetBytes(sig[32:64])}
+
+	signedTx, err := assembleAvalancheTransaction(txBytes, credentials, signature, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, _ := hex.DecodeString(signedTx.SignedTx)
+	credential := signed[len(unsignedTx):]
+	if !bytes.Equal(signed[:len(unsignedTx)], unsignedTx) || len(credential) != 4+4+4+65 {
+		t.Fatal("Signed tx should be the unsigned tx followed by one credential")
+	}
+	if binary.BigEndian.Uint32(credential[4:]) != avalancheCredentialType {
+		t.Error("Credential should be a secp256k1fx credential")
+	}
+	recovered, err := crypto.SigToPub(hash[:], credential[12:])
+	if err != nil || crypto.PubkeyToAddress(*recovered) != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Error("Credential signature does not recover to signing key")
+	}
+
+	txId := sha256.Sum256(signed)
+	if signedTx.TxHash != cb58Encode(txId[:]) {
+		t.Error("Tx id should be the cb58 encoded hash of the signed tx")
+	}
+}
+
+func TestCB58Encode(t *testing.T) {
+	data := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31}
+	decoded := base58.Decode(cb58Encode(data))
+	checksum := sha256.Sum256(data)
+	if !bytes.Equal(decoded[:32], data) || !bytes.Equal(decoded[32:], checksum[28:]) {
+		t.Error(fmt.Sprintf("Unexpected cb58 encoding: %x", decoded))
+	}
+}
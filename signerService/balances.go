@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Balances are cached briefly so wallet refreshes do not hit the node on every request
+const (
+	BalanceCacheTTL  = 15 * time.Second
+	BalanceCacheSize = 10000 // entries kept at most, expired entries are pruned first
+)
+
+// selector of the ERC20 balanceOf(address) view
+var balanceOfSelector = crypto.Keccak256([]byte("balanceOf(address)"))[:4]
+
+type cachedBalance struct {
+	account ETHAccounts
+	expires time.Time
+}
+
+// balanceCache holds recently queried balances keyed by blockchainId and address
+var balanceCache = struct {
+	sync.Mutex
+	entries   map[string]cachedBalance
+	nextPrune time.Time
+}{entries: make(map[string]cachedBalance)}
+
+// cacheBalance stores a balance and prunes the expired entries at most once per TTL, a full cache
+// of unexpired entries is not extended
+func cacheBalance(cacheKey string, account ETHAccounts, now time.Time) {
+	balanceCache.Lock()
+	defer balanceCache.Unlock()
+
+	if !now.Before(balanceCache.nextPrune) || len(balanceCache.entries) >= BalanceCacheSize {
+		for key, entry := range balanceCache.entries {
+			if !now.Before(entry.expires) {
+				delete(balanceCache.entries, key)
+			}
+		}
+		balanceCache.nextPrune = now.Add(BalanceCacheTTL)
+	}
+
+	if _, ok := balanceCache.entries[cacheKey]; !ok && len(balanceCache.entries) >= BalanceCacheSize {
+		return
+	}
+	balanceCache.entries[cacheKey] = cachedBalance{account: account, expires: now.Add(BalanceCacheTTL)}
+}
+
+// GetAccountBalance returns the native and registry token balances of an account
+func GetAccountBalance(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	defer CloseClientDB(DB)
+
+	account, err := readAccount(userId, blockchainId, accountName, userCollection)
+	if err != nil {
+		log.Error("Error reading account record err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	balance, err := getAccountBalance(c.Request.Context(), blockchainId, account.Address)
+	if err != nil {
+		log.Error("Error reading balance err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(balance, nil, c.Writer)
+	return
+}
+
+// GetAccountBalances returns the native and registry token balances of every account of a user on a blockchain
+func GetAccountBalances(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	defer CloseClientDB(DB)
+
+	accounts, err := readAccountRecords(userId, blockchainId, userCollection)
+	if err != nil {
+		log.Error("Error reading account record err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	result := []ETHAccounts{}
+	for _, account := range accounts {
+		balance, err := getAccountBalance(c.Request.Context(), blockchainId, account.Address)
+		if err != nil {
+			log.Error("Error reading balance err:", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+		result = append(result, balance)
+	}
+
+	ValidateAndWriteResponse(result, nil, c.Writer)
+	return
+}
+
+// getAccountBalance queries the native balance and the balance of every registry ERC20 token of an
+// address, results are served from the cache until they expire
+func getAccountBalance(ctx context.Context, blockchainId, address string) (ETHAccounts, error) {
+	if !common.IsHexAddress(address) {
+		return ETHAccounts{}, fmt.Errorf("invalid account address: %s", address)
+	}
+	client, ok := EVMClients[blockchainId]
+	if !ok {
+		return ETHAccounts{}, fmt.Errorf("no rpc client configured for blockchain: %s", blockchainId)
+	}
+
+	cacheKey := blockchainId + "-" + address
+	balanceCache.Lock()
+	cached, ok := balanceCache.entries[cacheKey]
+	balanceCache.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.account, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, RPCTimeout)
+	defer cancel()
+
+	balance, err := client.BalanceAt(ctx, address)
+	if err != nil {
+		return ETHAccounts{}, err
+	}
+
+	account := ETHAccounts{
+		Address:       address,
+		Balance:       formatTokenAmount(balance, nativeDecimals(blockchainId)),
+		ERC20Balances: make(map[string]string),
+	}
+
+	for _, token := range Tokens[blockchainId][Network] {
+		if token.Standard != TokenStandardERC20 {
+			continue
+		}
+		data := append(append([]byte{}, balanceOfSelector...), common.LeftPadBytes(common.HexToAddress(address).Bytes(), 32)...)
+		result, err := client.CallContract(ctx, token.ContractAddress, data)
+		if err != nil {
+			return ETHAccounts{}, fmt.Errorf("Error reading %s balance: %s", token.Symbol, err)
+		}
+		account.ERC20Balances[token.Symbol] = formatTokenAmount(new(big.Int).SetBytes(result), token.Decimals)
+	}
+
+	cacheBalance(cacheKey, account, time.Now())
+
+	return account, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// fakeEVMClient serves node state from memory and counts the node requests
+type fakeEVMClient struct {
+	balances      map[string]*big.Int
+	tokenBalances map[string]*big.Int // keyed by lower case contract address
+	nonces        map[string]uint64
+	pendingNonces map[string]uint64
+	receipts      map[string]*TxReceipt
+	sent          [][]byte
+	calls         int
+}
+
+func (client *fakeEVMClient) BalanceAt(ctx context.Context, address string) (*big.Int, error) {
+	client.calls++
+	balance, ok := client.balances[address]
+	if !ok {
+		return big.NewInt(0), nil
+	}
+	return balance, nil
+}
+
+func (client *fakeEVMClient) CallContract(ctx context.Context, to string, data []byte) ([]byte, error) {
+	client.calls++
+	if !bytes.Equal(data[:4], balanceOfSelector) {
+		return nil, fmt.Errorf("unexpected contract call")
+	}
+	balance, ok := client.tokenBalances[strings.ToLower(to)]
+	if !ok {
+		return nil, fmt.Errorf("execution reverted")
+	}
+	return common.LeftPadBytes(balance.Bytes(), 32), nil
+}
+
+func (client *fakeEVMClient) NonceAt(ctx context.Context, address string) (uint64, error) {
+	client.calls++
+	return client.nonces[address], nil
+}
+
+func (client *fakeEVMClient) PendingNonceAt(ctx context.Context, address string) (uint64, error) {
+	client.calls++
+	return client.pendingNonces[address], nil
+}
+
+func (client *fakeEVMClient) SendRawTransaction(ctx context.Context, rawTx []byte) error {
+	client.calls++
+	client.sent = append(client.sent, rawTx)
+	return nil
+}
+
+func (client *fakeEVMClient) TransactionReceipt(ctx context.Context, txHash string) (*TxReceipt, error) {
+	client.calls++
+	return client.receipts[txHash], nil
+}
+
+func TestGetAccountBalance(t *testing.T) {
+	address := "0xba536245A30404A983E120a3d07A7dF260a89669"
+	qkc, _ := lookupToken("ETH", "QKC")
+	client := &fakeEVMClient{
+		balances:      map[string]*big.Int{address: big.NewInt(1500000000000000000)},
+		tokenBalances: map[string]*big.Int{strings.ToLower(qkc.ContractAddress): big.NewInt(25e17)},
+	}
+	EVMClients["ETH"] = client
+	defer delete(EVMClients, "ETH")
+
+	account, err := getAccountBalance(context.Background(), "ETH", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Balance != "1.5" || account.ERC20Balances["QKC"] != "2.5" {
+		t.Error("Balances should be formatted with native and token decimals")
+	}
+
+	calls := client.calls
+	_, err = getAccountBalance(context.Background(), "ETH", address)
+	if err != nil || client.calls != calls {
+		t.Error("Repeated balance request should be served from the cache")
+	}
+
+	_, err = getAccountBalance(context.Background(), "AVAX", address)
+	if err == nil {
+		t.Error("Blockchain without rpc client should be rejected")
+	}
+}
+
+func TestCacheBalancePrunesExpiredEntries(t *testing.T) {
+	now := time.Now()
+	balanceCache.Lock()
+	balanceCache.nextPrune = time.Time{}
+	balanceCache.Unlock()
+
+	cacheBalance("ETH-expired", ETHAccounts{}, now.Add(-2*BalanceCacheTTL))
+	cacheBalance("ETH-fresh", ETHAccounts{}, now)
+
+	balanceCache.Lock()
+	_, expired := balanceCache.entries["ETH-expired"]
+	_, fresh := balanceCache.entries["ETH-fresh"]
+	balanceCache.Unlock()
+	if expired || !fresh {
+		t.Error("Expired balances should be pruned when a balance is cached")
+	}
+}
+
+func TestJSONRPCClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpcRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		switch req.Method {
+		case "eth_getBalance":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"0x2386f26fc10000"}`)
+		case "eth_call":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"0x00000000000000000000000000000000000000000000000000000000000003e8"}`)
+		default:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`)
+		}
+	}))
+	defer server.Close()
+
+	client := newJSONRPCClient(server.URL)
+	balance, err := client.BalanceAt(context.Background(), "0xba536245A30404A983E120a3d07A7dF260a89669")
+	if err != nil || balance.String() != "10000000000000000" {
+		t.Error("eth_getBalance result should be decoded")
+	}
+
+	result, err := client.CallContract(context.Background(), "0xba536245A30404A983E120a3d07A7dF260a89669", balanceOfSelector)
+	if err != nil || new(big.Int).SetBytes(result).Int64() != 1000 {
+		t.Error("eth_call result should be decoded")
+	}
+
+	err = client.call(context.Background(), "eth_unknown", nil, &result)
+	if err == nil {
+		t.Error("JSON-RPC error should be returned")
+	}
+}
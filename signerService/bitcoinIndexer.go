@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// BitcoinIndexer is the source of the unspent outputs of bitcoin addresses
+type BitcoinIndexer interface {
+	ListUnspent(ctx context.Context, address string) ([]UTXO, error)
+}
+
+// BTCIndexer is the indexer configured with BTC_INDEXER_URL, nil when not configured
+var BTCIndexer BitcoinIndexer = loadBitcoinIndexer()
+
+func loadBitcoinIndexer() BitcoinIndexer {
+	url, ok := os.LookupEnv("BTC_INDEXER_URL")
+	if !ok {
+		return nil
+	}
+	return &esploraIndexer{url: strings.TrimSuffix(url, "/"), httpClient: &http.Client{Timeout: RPCTimeout}}
+}
+
+// esploraIndexer reads unspent outputs from an Esplora compatible REST api
+type esploraIndexer struct {
+	url        string
+	httpClient *http.Client
+}
+
+// ListUnspent returns the unspent outputs of an address
+func (indexer *esploraIndexer) ListUnspent(ctx context.Context, address string) ([]UTXO, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, indexer.url+"/address/"+address+"/utxo", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := indexer.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading utxos: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Error reading utxos: indexer returned status %d", resp.StatusCode)
+	}
+
+	var outputs []struct {
+		TxId   string `json:"txid"`
+		Vout   uint32 `json:"vout"`
+		Value  int64  `json:"value"`
+		Status struct {
+			Confirmed bool `json:"confirmed"`
+		} `json:"status"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&outputs)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding utxos: %s", err)
+	}
+
+	utxos := []UTXO{}
+	for _, output := range outputs {
+		utxos = append(utxos, UTXO{TxId: output.TxId, Vout: output.Vout, Value: output.Value, Confirmed: output.Status.Confirmed})
+	}
+	return utxos, nil
+}
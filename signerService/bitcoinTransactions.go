@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/btcsuite/btcutil/bech32"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Bitcoin transaction constants
+const (
+	bitcoinTxVersion     int32  = 2
+	bitcoinRBFSequence   uint32 = 0xfffffffd // signals replace-by-fee so stuck transactions can be bumped
+	bitcoinSigHashAll    uint32 = 1
+	psbtGlobalUnsignedTx byte   = 0x00
+	psbtInWitnessUTXO    byte   = 0x01
+	psbtInSigHashType    byte   = 0x03
+)
+
+// UTXOs selected for a prepared transaction are locked for this time so concurrent requests do not spend them twice
+const UTXOLockTTL = 10 * time.Minute
+
+// Base58 version bytes of legacy bitcoin addresses
+var bitcoinAddressVersions = map[string]struct{ pubKeyHash, scriptHash byte }{
+	Mainnet: {0x00, 0x05},
+	Testnet: {0x6f, 0xc4},
+}
+
+// bitcoinTx is an unsigned bitcoin transaction spending P2WPKH outputs
+type bitcoinTx struct {
+	Version  int32
+	Inputs   []bitcoinTxIn
+	Outputs  []bitcoinTxOut
+	LockTime uint32
+}
+
+type bitcoinTxIn struct {
+	PrevHash []byte // previous transaction id in internal byte order
+	Vout     uint32
+	Sequence uint32
+	Value    int64 // value of the spent output, committed to by the segwit signature hash
+}
+
+type bitcoinTxOut struct {
+	Value  int64
+	Script []byte
+}
+
+// SyncUTXOs refreshes the unspent outputs of a BTC account from the indexer
+func SyncUTXOs(c *gin.Context) {
+	userId := c.Param("userId")
+	accountName := c.Param("accountName")
+
+	if BTCIndexer == nil {
+		WriteErrorResponse(http.StatusBadRequest, "Error: no bitcoin indexer configured", c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	utxoCollection := DB.Database(MongoDatabase).Collection("UTXOCollection")
+	defer CloseClientDB(DB)
+
+	account, err := readAccount(userId, "BTC", accountName, userCollection)
+	if err != nil {
+		log.Error("Error reading account record err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	utxoSet, err := syncUTXOSet(c.Request.Context(), account.Address, utxoCollection)
+	if err != nil {
+		log.Error("Error syncing utxos err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(utxoSet, nil, c.Writer)
+	return
+}
+
+// GetUTXOs returns the stored unspent outputs of a BTC account
+func GetUTXOs(c *gin.Context) {
+	userId := c.Param("userId")
+	accountName := c.Param("accountName")
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	utxoCollection := DB.Database(MongoDatabase).Collection("UTXOCollection")
+	defer CloseClientDB(DB)
+
+	account, err := readAccount(userId, "BTC", accountName, userCollection)
+	if err != nil {
+		log.Error("Error reading account record err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	utxoSet, err := readUTXOSet("BTC", account.Address, utxoCollection)
+	if err != nil {
+		log.Error("Error reading utxos err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(utxoSet, nil, c.Writer)
+	return
+}
+
+// PrepareBitcoinTransaction selects the inputs of a BTC transaction and returns the unsigned PSBT
+// with the signature hash of every input for the MPC signing flow
+func PrepareBitcoinTransaction(c *gin.Context) {
+	userId := c.Param("userId")
+	accountName := c.Param("accountName")
+
+	var txRequest BitcoinTxRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&txRequest)
+	if err != nil {
+		log.Error("Error decoding bitcoin tx: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	utxoCollection := DB.Database(MongoDatabase).Collection("UTXOCollection")
+	defer CloseClientDB(DB)
+
+	account, err := readAccount(userId, "BTC", accountName, userCollection)
+	if err != nil {
+		log.Error("Error reading account record err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	utxoSet, err := readUTXOSet("BTC", account.Address, utxoCollection)
+	if err == mongo.ErrNoDocuments && BTCIndexer != nil {
+		utxoSet, err = syncUTXOSet(c.Request.Context(), account.Address, utxoCollection)
+	}
+	if err != nil {
+		log.Error("Error reading utxos err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	response, selected, err := prepareBitcoinTransaction(account.Address, spendableUTXOs(utxoSet.UTXOs, time.Now()), txRequest)
+	if err != nil {
+		log.Error("Error preparing bitcoin tx err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	err = lockUTXOSet(utxoSet, selected, time.Now().Add(UTXOLockTTL), utxoCollection)
+	if err != nil {
+		log.Error("Error locking utxos err:", err)
+		WriteErrorResponse(http.StatusConflict, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(response, nil, c.Writer)
+	return
+}
+
+// syncUTXOSet replaces the stored unspent outputs of an address with the indexer view, locks of
+// outputs that are still unspent are kept
+func syncUTXOSet(ctx context.Context, address string, utxoCollection *mongo.Collection) (UTXOSet, error) {
+	ctx, cancel := context.WithTimeout(ctx, RPCTimeout)
+	defer cancel()
+
+	utxos, err := BTCIndexer.ListUnspent(ctx, address)
+	if err != nil {
+		return UTXOSet{}, err
+	}
+
+	previous, err := readUTXOSet("BTC", address, utxoCollection)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return UTXOSet{}, err
+	}
+	locks := make(map[string]time.Time)
+	for _, utxo := range previous.UTXOs {
+		locks[utxoKey(utxo)] = utxo.LockedUntil
+	}
+	for i := range utxos {
+		utxos[i].LockedUntil = locks[utxoKey(utxos[i])]
+	}
+
+	utxoSet := UTXOSet{BlockchainId: "BTC", Address: address, UTXOs: utxos, Version: previous.Version + 1, UpdatedAt: time.Now().UTC()}
+	err = writeUTXOSet(utxoSet, utxoCollection)
+	return utxoSet, err
+}
+
+// lockUTXOSet locks the selected outputs, the update fails when the set changed since it was read
+func lockUTXOSet(utxoSet UTXOSet, selected []UTXO, lockedUntil time.Time, utxoCollection *mongo.Collection) error {
+	keys := make(map[string]bool)
+	for _, utxo := range selected {
+		keys[utxoKey(utxo)] = true
+	}
+
+	utxos := make([]UTXO, len(utxoSet.UTXOs))
+	copy(utxos, utxoSet.UTXOs)
+	for i := range utxos {
+		if keys[utxoKey(utxos[i])] {
+			utxos[i].LockedUntil = lockedUntil.UTC()
+		}
+	}
+
+	return updateUTXOSet(utxoSet.BlockchainId, utxoSet.Address, utxoSet.Version, utxos, utxoCollection)
+}
+
+// spendableUTXOs returns the confirmed outputs that are not locked by a prepared transaction
+func spendableUTXOs(utxos []UTXO, now time.Time) []UTXO {
+	var spendable []UTXO
+	for _, utxo := range utxos {
+		if utxo.Confirmed && !now.Before(utxo.LockedUntil) {
+			spendable = append(spendable, utxo)
+		}
+	}
+	return spendable
+}
+
+func utxoKey(utxo UTXO) string {
+	return fmt.Sprintf("%s:%d", utxo.TxId, utxo.Vout)
+}
+
+// prepareBitcoinTransaction selects the inputs paying the requested outputs from the P2WPKH account
+// address and returns the PSBT response together with the selected outputs
+func prepareBitcoinTransaction(address string, utxos []UTXO, txRequest BitcoinTxRequest) (BitcoinTxResponse, []UTXO, error) {
+	accountScript, err := bitcoinOutputScript(address)
+	if err != nil {
+		return BitcoinTxResponse{}, nil, err
+	}
+	if len(accountScript) != 22 || accountScript[0] != 0x00 {
+		return BitcoinTxResponse{}, nil, fmt.Errorf("account address must be a P2WPKH address")
+	}
+	if len(txRequest.Outputs) == 0 {
+		return BitcoinTxResponse{}, nil, fmt.Errorf("missing transaction outputs")
+	}
+
+	tx := bitcoinTx{Version: bitcoinTxVersion}
+	var target int64
+	baseVBytes := int64(txOverheadVBytes)
+	for _, output := range txRequest.Outputs {
+		script, err := bitcoinOutputScript(output.Address)
+		if err != nil {
+			return BitcoinTxResponse{}, nil, err
+		}
+		if output.Value < dustThreshold(script) {
+			return BitcoinTxResponse{}, nil, fmt.Errorf("output value %d is below the dust threshold of %d", output.Value, dustThreshold(script))
+		}
+		tx.Outputs = append(tx.Outputs, bitcoinTxOut{Value: output.Value, Script: script})
+		target += output.Value
+		baseVBytes += int64(9 + len(script))
+	}
+
+	selection, err := selectCoins(utxos, target, baseVBytes, txRequest.FeeRate)
+	if err != nil {
+		return BitcoinTxResponse{}, nil, err
+	}
+	if selection.Change > 0 {
+		tx.Outputs = append(tx.Outputs, bitcoinTxOut{Value: selection.Change, Script: accountScript})
+	}
+
+	for _, utxo := range selection.Inputs {
+		prevHash, err := hex.DecodeString(utxo.TxId)
+		if err != nil || len(prevHash) != 32 {
+			return BitcoinTxResponse{}, nil, fmt.Errorf("invalid utxo txid: %s", utxo.TxId)
+		}
+		tx.Inputs = append(tx.Inputs, bitcoinTxIn{PrevHash: reverseBytes(prevHash), Vout: utxo.Vout, Sequence: bitcoinRBFSequence, Value: utxo.Value})
+	}
+
+	response := BitcoinTxResponse{
+		PSBT:       base64.StdEncoding.EncodeToString(tx.psbt(accountScript)),
+		UnsignedTx: hex.EncodeToString(tx.serialize()),
+		Fee:        selection.Fee,
+		Change:     selection.Change,
+	}
+	for i, utxo := range selection.Inputs {
+		response.Inputs = append(response.Inputs, BitcoinTxInput{
+			TxId:    utxo.TxId,
+			Vout:    utxo.Vout,
+			Value:   utxo.Value,
+			SigHash: hex.EncodeToString(tx.sigHash(i, accountScript[2:])),
+		})
+	}
+
+	return response, selection.Inputs, nil
+}
+
+// bitcoinOutputScript returns the scriptPubKey of a P2WPKH, P2WSH, P2PKH or P2SH address of the configured network
+func bitcoinOutputScript(address string) ([]byte, error) {
+	hrp, data, err := bech32.Decode(address)
+	if err == nil {
+		if hrp != bitcoinHRP[Network] || len(data) == 0 {
+			return nil, fmt.Errorf("address %s is not a %s address", address, Network)
+		}
+		if data[0] != 0 {
+			return nil, fmt.Errorf("only witness version 0 addresses are supported: %s", address)
+		}
+		program, err := bech32.ConvertBits(data[1:], 5, 8, false)
+		if err != nil || (len(program) != 20 && len(program) != 32) {
+			return nil, fmt.Errorf("invalid witness program: %s", address)
+		}
+		return append([]byte{0x00, byte(len(program))}, program...), nil
+	}
+
+	hash, version, err := base58.CheckDecode(address)
+	if err != nil || len(hash) != 20 {
+		return nil, fmt.Errorf("invalid bitcoin address: %s", address)
+	}
+	switch version {
+	case bitcoinAddressVersions[Network].pubKeyHash:
+		// OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG
+		return append(append([]byte{0x76, 0xa9, 0x14}, hash...), 0x88, 0xac), nil
+	case bitcoinAddressVersions[Network].scriptHash:
+		// OP_HASH160 <hash> OP_EQUAL
+		return append(append([]byte{0xa9, 0x14}, hash...), 0x87), nil
+	}
+
+	return nil, fmt.Errorf("address %s is not a %s address", address, Network)
+}
+
+// serialize encodes the transaction without witness data
+func (tx bitcoinTx) serialize() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, tx.Version)
+	writeVarInt(&buf, uint64(len(tx.Inputs)))
+	for _, input := range tx.Inputs {
+		buf.Write(input.PrevHash)
+		binary.Write(&buf, binary.LittleEndian, input.Vout)
+		buf.WriteByte(0x00) // empty script sig
+		binary.Write(&buf, binary.LittleEndian, input.Sequence)
+	}
+	writeVarInt(&buf, uint64(len(tx.Outputs)))
+	for _, output := range tx.Outputs {
+		output.serialize(&buf)
+	}
+	binary.Write(&buf, binary.LittleEndian, tx.LockTime)
+	return buf.Bytes()
+}
+
+func (output bitcoinTxOut) serialize(buf *bytes.Buffer) {
+	binary.Write(buf, binary.LittleEndian, output.Value)
+	writeVarBytes(buf, output.Script)
+}
+
+// sigHash returns the BIP143 SIGHASH_ALL signature hash of a P2WPKH input with the given public key hash
+func (tx bitcoinTx) sigHash(index int, pubKeyHash []byte) []byte {
+	var prevouts, sequences, outputs bytes.Buffer
+	for _, input := range tx.Inputs {
+		prevouts.Write(input.PrevHash)
+		binary.Write(&prevouts, binary.LittleEndian, input.Vout)
+		binary.Write(&sequences, binary.LittleEndian, input.Sequence)
+	}
+	for _, output := range tx.Outputs {
+		output.serialize(&outputs)
+	}
+
+	input := tx.Inputs[index]
+	var preimage bytes.Buffer
+	binary.Write(&preimage, binary.LittleEndian, tx.Version)
+	preimage.Write(doubleSha256(prevouts.Bytes()))
+	preimage.Write(doubleSha256(sequences.Bytes()))
+	preimage.Write(input.PrevHash)
+	binary.Write(&preimage, binary.LittleEndian, input.Vout)
+	// script code of P2WPKH is the P2PKH script of the public key hash
+	preimage.Write(append(append([]byte{0x19, 0x76, 0xa9, 0x14}, pubKeyHash...), 0x88, 0xac))
+	binary.Write(&preimage, binary.LittleEndian, input.Value)
+	binary.Write(&preimage, binary.LittleEndian, input.Sequence)
+	preimage.Write(doubleSha256(outputs.Bytes()))
+	binary.Write(&preimage, binary.LittleEndian, tx.LockTime)
+	binary.Write(&preimage, binary.LittleEndian, bitcoinSigHashAll)
+
+	return doubleSha256(preimage.Bytes())
+}
+
+// psbt returns the BIP174 PSBT of the unsigned transaction with the witness utxo of every input
+func (tx bitcoinTx) psbt(inputScript []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("psbt\xff")
+	writePSBTEntry(&buf, []byte{psbtGlobalUnsignedTx}, tx.serialize())
+	buf.WriteByte(0x00)
+
+	sigHashType := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sigHashType, bitcoinSigHashAll)
+	for _, input := range tx.Inputs {
+		var witnessUTXO bytes.Buffer
+		bitcoinTxOut{Value: input.Value, Script: inputScript}.serialize(&witnessUTXO)
+		writePSBTEntry(&buf, []byte{psbtInWitnessUTXO}, witnessUTXO.Bytes())
+		writePSBTEntry(&buf, []byte{psbtInSigHashType}, sigHashType)
+		buf.WriteByte(0x00)
+	}
+	for range tx.Outputs {
+		buf.WriteByte(0x00)
+	}
+
+	return buf.Bytes()
+}
+
+func writePSBTEntry(buf *bytes.Buffer, key, value []byte) {
+	writeVarBytes(buf, key)
+	writeVarBytes(buf, value)
+}
+
+func doubleSha256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+func reverseBytes(data []byte) []byte {
+	reversed := make([]byte, len(data))
+	for i := range data {
+		reversed[i] = data[len(data)-1-i]
+	}
+	return reversed
+}
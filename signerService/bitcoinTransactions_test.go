@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestBitcoinSigHash(t *testing.T) {
+	// BIP143 native P2WPKH example
+	prevHash0, _ := hex.DecodeString("fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f")
+	prevHash1, _ := hex.DecodeString("ef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a")
+	script0, _ := hex.DecodeString("76a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac")
+	script1, _ := hex.DecodeString("76a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac")
+	pubKeyHash, _ := hex.DecodeString("1d0f172a0ecb48aee1be1f2687d2963ae33f71a1")
+
+	tx := bitcoinTx{
+		Version: 1,
+		Inputs: []bitcoinTxIn{
+			{PrevHash: prevHash0, Vout: 0, Sequence: 0xffffffee, Value: 625000000},
+			{PrevHash: prevHash1, Vout: 1, Sequence: 0xffffffff, Value: 600000000},
+		},
+		Outputs:  []bitcoinTxOut{{Value: 112340000, Script: script0}, {Value: 223450000, Script: script1}},
+		LockTime: 0x11,
+	}
+
+	unsignedTx := "0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000"
+	if hex.EncodeToString(tx.serialize()) != unsignedTx {
+		t.Error("Unsigned transaction does not match BIP143 example")
+	}
+
+	if hex.EncodeToString(tx.sigHash(1, pubKeyHash)) != "c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670" {
+		t.Error("Signature hash does not match BIP143 example")
+	}
+}
+
+func TestBitcoinOutputScript(t *testing.T) {
+	script, err := bitcoinOutputScript("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4")
+	if err != nil || hex.EncodeToString(script) != "0014751e76e8199196d454941c45d1b3a323f1433bd6" {
+		t.Error("P2WPKH script does not match address")
+	}
+
+	script, err = bitcoinOutputScript("1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2")
+	if err != nil || hex.EncodeToString(script) != "76a91477bff20c60e522dfaa3350c39b030a5d004e839a88ac" {
+		t.Error("P2PKH script does not match address")
+	}
+
+	script, err = bitcoinOutputScript("3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy")
+	if err != nil || hex.EncodeToString(script) != "a914b472a266d0bd89c13706a4132ccfb16f7c3b9fcb87" {
+		t.Error("P2SH script does not match address")
+	}
+
+	_, err = bitcoinOutputScript("tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx")
+	if err == nil {
+		t.Error("Testnet address should be rejected on mainnet")
+	}
+}
+
+func TestPrepareBitcoinTransaction(t *testing.T) {
+	utxos := []UTXO{
+		{TxId: "fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f", Vout: 0, Value: 100000, Confirmed: true},
+		{TxId: "ef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a", Vout: 1, Value: 50000, Confirmed: true},
+	}
+	txRequest := BitcoinTxRequest{
+		Outputs: []BitcoinOutput{{Address: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", Value: 120000}},
+		FeeRate: 2,
+	}
+
+	response, selected, err := prepareBitcoinTransaction("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", utxos, txRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 2 || len(response.Inputs) != 2 || response.Inputs[0].TxId != utxos[0].TxId {
+		t.Error("Both utxos should be selected largest first")
+	}
+	if 150000 != 120000+response.Fee+response.Change {
+		t.Error("Inputs should pay the outputs, fee and change")
+	}
+
+	psbt, _ := base64.StdEncoding.DecodeString(response.PSBT)
+	unsignedTx, _ := hex.DecodeString(response.UnsignedTx)
+	if !bytes.HasPrefix(psbt, []byte("psbt\xff")) || !bytes.Contains(psbt, unsignedTx) {
+		t.Error("PSBT should contain the unsigned transaction")
+	}
+
+	_, _, err = prepareBitcoinTransaction("1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", utxos, txRequest)
+	if err == nil {
+		t.Error("Non P2WPKH account address should be rejected")
+	}
+}
+
+func TestSpendableUTXOs(t *testing.T) {
+	now := time.Now()
+	utxos := []UTXO{
+		{TxId: "a", Value: 1, Confirmed: true},
+		{TxId: "b", Value: 1, Confirmed: false},
+		{TxId: "c", Value: 1, Confirmed: true, LockedUntil: now.Add(time.Minute)},
+		{TxId: "d", Value: 1, Confirmed: true, LockedUntil: now.Add(-time.Minute)},
+	}
+
+	spendable := spendableUTXOs(utxos, now)
+	if len(spendable) != 2 || spendable[0].TxId != "a" || spendable[1].TxId != "d" {
+		t.Error("Only confirmed unlocked utxos should be spendable")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/echovl/cardano-go"
+	cardanocrypto "github.com/echovl/cardano-go/crypto"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/blake2b"
+)
+
+// POSTCardanoSignature completes the signing flow for a cardano transaction body. The body hash
+// is signed with the eddsa custody share and the signed transaction is returned as CBOR
+func POSTCardanoSignature(c *gin.Context) {
+	userId := c.Param("userId")
+	accountName := c.Param("accountName")
+
+	var txRequest CardanoTxRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&txRequest)
+	if err != nil {
+		log.Error("Error decoding cardano tx: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	body, err := hex.DecodeString(txRequest.TxBody)
+	if err != nil {
+		log.Error("Error decoding cardano tx body: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	tx, bodyHash, err := decodeCardanoTxBody(body)
+	if err != nil {
+		log.Error("Error decoding cardano tx body: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	defer CloseClientDB(DB)
+
+	share, err := readEDDSAShare(userId, "ADA", accountName, keyShareCollection)
+	if err != nil {
+		log.Error("Error reading share err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	signature, err := completeEDDSASignature(share, bodyHash, txRequest.Signature)
+	if err != nil {
+		log.Error("Error generating full signature:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	pk, _ := parseEDDSAPublicKey(share.PK)
+	signedTx := addCardanoWitness(tx, pk, signature)
+
+	response := SignedTxResponse{
+		TxHash:   hex.EncodeToString(bodyHash),
+		SignedTx: hex.EncodeToString(signedTx),
+	}
+	recordSignedTransaction(userId, "ADA", accountName, response, DB.Database(MongoDatabase).Collection("TxCollection"))
+
+	ValidateAndWriteResponse(response, nil, c.Writer)
+	return
+}
+
+// decodeCardanoTxBody decodes a CBOR transaction body and returns it as an unsigned transaction
+// together with the blake2b-256 body hash, which is the transaction id and the payload signed by
+// every vkey witness
+func decodeCardanoTxBody(body []byte) (cardano.Tx, []byte, error) {
+	var tx cardano.Tx
+	if len(body) == 0 {
+		return tx, nil, fmt.Errorf("empty cardano transaction body")
+	}
+	bodyHash := blake2b.Sum256(body)
+
+	// decode the body through an unsigned transaction: [body, {}, true, null]
+	unsignedTx := append([]byte{0x84}, body...)
+	unsignedTx = append(unsignedTx, 0xa0, 0xf5, 0xf6)
+	err := tx.UnmarshalCBOR(unsignedTx)
+	if err != nil {
+		return tx, nil, fmt.Errorf("Error decoding cardano tx body: %s", err)
+	}
+
+	// the signed transaction re-encodes the body so it must match the hash being signed
+	encodedHash, err := tx.Hash()
+	if err != nil {
+		return tx, nil, fmt.Errorf("Error encoding cardano tx body: %s", err)
+	}
+	if !bytes.Equal(encodedHash, bodyHash[:]) {
+		return tx, nil, fmt.Errorf("cardano tx body must use canonical CBOR encoding")
+	}
+
+	return tx, bodyHash[:], nil
+}
+
+// addCardanoWitness builds the vkey witness set for the signature and returns the CBOR encoding
+// of the signed transaction
+func addCardanoWitness(tx cardano.Tx, pk, signature []byte) []byte {
+	tx.WitnessSet = cardano.WitnessSet{
+		VKeyWitnessSet: []cardano.VKeyWitness{{VKey: cardanocrypto.PubKey(pk), Signature: signature}},
+	}
+	tx.IsValid = true
+
+	return tx.Bytes()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/echovl/cardano-go"
+	cardanocrypto "github.com/echovl/cardano-go/crypto"
+)
+
+func TestCardanoWitnessAssembly(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("Error generating key")
+	}
+
+	credential, err := cardano.NewKeyCredential(cardanocrypto.PubKey(pk))
+	if err != nil {
+		t.Fatal("Error creating credential")
+	}
+	address, err := cardano.NewEnterpriseAddress(cardano.Testnet, credential)
+	if err != nil {
+		t.Fatal("Error creating address")
+	}
+
+	unsigned := cardano.Tx{
+		Body: cardano.TxBody{
+			Inputs:  []*cardano.TxInput{cardano.NewTxInput(make(cardano.Hash32, 32), 0, nil)},
+			Outputs: []*cardano.TxOutput{cardano.NewTxOutput(address, cardano.NewValue(1000000))},
+			Fee:     170000,
+		},
+	}
+	// strip the array header and the empty witness set, validity flag and auxiliary data
+	encoded := unsigned.Bytes()
+	body := encoded[1 : len(encoded)-3]
+
+	tx, bodyHash, err := decodeCardanoTxBody(body)
+	if err != nil {
+		t.Fatal("Error decoding body:", err)
+	}
+	expectedHash, _ := unsigned.Hash()
+	if !bytes.Equal(bodyHash, expectedHash) {
+		t.Error("Body hash does not match transaction id")
+	}
+
+	signedTx := addCardanoWitness(tx, pk, ed25519.Sign(sk, bodyHash))
+
+	var decoded cardano.Tx
+	err = decoded.UnmarshalCBOR(signedTx)
+	if err != nil {
+		t.Fatal("Error decoding signed tx:", err)
+	}
+	if len(decoded.WitnessSet.VKeyWitnessSet) != 1 {
+		t.Fatal("Signed tx should have one vkey witness")
+	}
+	witness := decoded.WitnessSet.VKeyWitnessSet[0]
+	if !witness.VKey.Verify(bodyHash, witness.Signature) {
+		t.Error("Witness signature does not verify")
+	}
+
+	_, _, err = decodeCardanoTxBody([]byte{0x01})
+	if err == nil {
+		t.Error("Invalid body should not decode")
+	}
+}
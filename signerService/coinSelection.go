@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Virtual sizes used for fee estimation of transactions spending P2WPKH outputs
+const (
+	p2wpkhInputVBytes  = 68 // outpoint, sequence, empty script sig and the witness with signature and public key
+	p2wpkhOutputVBytes = 31 // value and P2WPKH script
+	txOverheadVBytes   = 11 // version, locktime, input and output counts and the segwit marker
+	bnbMaxTries        = 100000
+)
+
+// Smallest outputs relayed by default, the threshold depends on the cost of spending the output
+const (
+	p2wpkhDustThreshold = 294
+	p2wshDustThreshold  = 330
+	legacyDustThreshold = 546 // P2PKH and P2SH outputs
+)
+
+// dustThreshold returns the smallest relayed value of an output script built by bitcoinOutputScript
+func dustThreshold(script []byte) int64 {
+	switch {
+	case len(script) == 22 && script[0] == 0x00:
+		return p2wpkhDustThreshold
+	case len(script) == 34 && script[0] == 0x00:
+		return p2wshDustThreshold
+	}
+	return legacyDustThreshold
+}
+
+// CoinSelection is the result of selecting the inputs of a bitcoin transaction
+type CoinSelection struct {
+	Inputs []UTXO // selected unspent outputs
+	Fee    int64  // fee paid by the transaction in satoshis
+	Change int64  // change returned to the account, 0 when the transaction has no change output
+}
+
+// selectCoins selects inputs paying target satoshis plus the fee at feeRate sat/vB for a transaction
+// whose outputs and overhead take baseVBytes. Branch-and-bound looks for an input set that needs no
+// change output, largest-first with a change output is used when no such set exists
+func selectCoins(utxos []UTXO, target, baseVBytes, feeRate int64) (CoinSelection, error) {
+	if target <= 0 || feeRate <= 0 {
+		return CoinSelection{}, fmt.Errorf("target and fee rate must be positive")
+	}
+
+	selection, ok := branchAndBound(utxos, target, baseVBytes, feeRate)
+	if ok {
+		return selection, nil
+	}
+
+	return largestFirst(utxos, target, baseVBytes, feeRate)
+}
+
+// branchAndBound searches the input set with the smallest excess over the target that is below the
+// cost of creating and later spending a change output, the excess is paid as fee
+func branchAndBound(utxos []UTXO, target, baseVBytes, feeRate int64) (CoinSelection, bool) {
+	inputFee := feeRate * p2wpkhInputVBytes
+	var pool []UTXO
+	var available int64
+	for _, utxo := range utxos {
+		if utxo.Value > inputFee {
+			pool = append(pool, utxo)
+			available += utxo.Value - inputFee
+		}
+	}
+	sort.Slice(pool, func(i, j int) bool { return pool[i].Value > pool[j].Value })
+
+	selectionTarget := target + feeRate*baseVBytes
+	costOfChange := feeRate * (p2wpkhOutputVBytes + p2wpkhInputVBytes)
+
+	var best []int
+	bestExcess := costOfChange + 1
+	tries := 0
+
+	var search func(index int, selected []int, total, remaining int64)
+	search = func(index int, selected []int, total, remaining int64) {
+		tries++
+		if tries > bnbMaxTries || total > selectionTarget+costOfChange {
+			return
+		}
+		if total >= selectionTarget {
+			if total-selectionTarget < bestExcess {
+				best = append([]int{}, selected...)
+				bestExcess = total - selectionTarget
+			}
+			return
+		}
+		if index == len(pool) || total+remaining < selectionTarget {
+			return
+		}
+
+		effective := pool[index].Value - inputFee
+		search(index+1, append(selected, index), total+effective, remaining-effective)
+		search(index+1, selected, total, remaining-effective)
+	}
+	search(0, nil, 0, available)
+
+	if best == nil {
+		return CoinSelection{}, false
+	}
+
+	selection := CoinSelection{}
+	var total int64
+	for _, index := range best {
+		selection.Inputs = append(selection.Inputs, pool[index])
+		total += pool[index].Value
+	}
+	selection.Fee = total - target
+	return selection, true
+}
+
+// largestFirst adds the largest inputs until the target and fee are covered, the remainder is
+// returned as P2WPKH change unless it is dust, which is paid as fee
+func largestFirst(utxos []UTXO, target, baseVBytes, feeRate int64) (CoinSelection, error) {
+	pool := append([]UTXO{}, utxos...)
+	sort.Slice(pool, func(i, j int) bool { return pool[i].Value > pool[j].Value })
+
+	selection := CoinSelection{}
+	var total int64
+	for _, utxo := range pool {
+		selection.Inputs = append(selection.Inputs, utxo)
+		total += utxo.Value
+		vBytes := baseVBytes + int64(len(selection.Inputs))*p2wpkhInputVBytes
+
+		change := total - target - feeRate*(vBytes+p2wpkhOutputVBytes)
+		if change >= p2wpkhDustThreshold {
+			selection.Change = change
+			selection.Fee = feeRate * (vBytes + p2wpkhOutputVBytes)
+			return selection, nil
+		}
+		if total-target >= feeRate*vBytes {
+			selection.Fee = total - target
+			return selection, nil
+		}
+	}
+
+	return CoinSelection{}, fmt.Errorf("insufficient funds: %d satoshis available", total)
+}
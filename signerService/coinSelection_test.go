@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSelectCoinsBranchAndBound(t *testing.T) {
+	feeRate := int64(1)
+	baseVBytes := int64(txOverheadVBytes + p2wpkhOutputVBytes)
+	utxos := []UTXO{
+		{TxId: "a", Value: 100000},
+		{TxId: "b", Value: 30000 + p2wpkhInputVBytes},
+		{TxId: "c", Value: 20000 + p2wpkhInputVBytes},
+	}
+
+	// 50000 plus the base fee is paid exactly by b and c without change
+	selection, err := selectCoins(utxos, 50000-baseVBytes, baseVBytes, feeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selection.Inputs) != 2 || selection.Change != 0 || selection.Inputs[0].TxId != "b" || selection.Inputs[1].TxId != "c" {
+		t.Error("Branch and bound should find the exact match without change")
+	}
+	if selection.Fee != baseVBytes+2*p2wpkhInputVBytes {
+		t.Error("Exact match should only pay the transaction fee")
+	}
+}
+
+func TestSelectCoinsLargestFirst(t *testing.T) {
+	feeRate := int64(5)
+	baseVBytes := int64(txOverheadVBytes + p2wpkhOutputVBytes)
+	utxos := []UTXO{{TxId: "a", Value: 10000}, {TxId: "b", Value: 70000}, {TxId: "c", Value: 40000}}
+
+	selection, err := selectCoins(utxos, 90000, baseVBytes, feeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selection.Inputs) != 2 || selection.Inputs[0].TxId != "b" || selection.Inputs[1].TxId != "c" {
+		t.Error("Largest first should select the two largest utxos")
+	}
+	expectedFee := feeRate * (baseVBytes + 2*p2wpkhInputVBytes + p2wpkhOutputVBytes)
+	if selection.Fee != expectedFee || selection.Change != 110000-90000-expectedFee {
+		t.Error("Change should be the remainder after the fee including the change output")
+	}
+
+	_, err = selectCoins(utxos, 200000, baseVBytes, feeRate)
+	if err == nil {
+		t.Error("Insufficient funds should be rejected")
+	}
+}
+
+func TestSelectCoinsDustChange(t *testing.T) {
+	feeRate := int64(1)
+	baseVBytes := int64(txOverheadVBytes + p2wpkhOutputVBytes)
+	fee := baseVBytes + p2wpkhInputVBytes
+	// the remainder after the fee is above the branch and bound window but below dust with a change output
+	utxos := []UTXO{{TxId: "a", Value: 10000 + fee + 150}}
+
+	selection, err := selectCoins(utxos, 10000, baseVBytes, feeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selection.Change != 0 || selection.Fee != fee+150 {
+		t.Error("Dust change should be paid as fee")
+	}
+}
+
+func TestDustThreshold(t *testing.T) {
+	thresholds := map[string]int64{
+		"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2":                             legacyDustThreshold,
+		"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy":                             legacyDustThreshold,
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4":                     p2wpkhDustThreshold,
+		"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3": p2wshDustThreshold,
+	}
+	for address, threshold := range thresholds {
+		script, err := bitcoinOutputScript(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dustThreshold(script) != threshold {
+			t.Errorf("Wrong dust threshold for %s", address)
+		}
+	}
+
+	utxos := []UTXO{{TxId: "fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f", Value: 100000, Confirmed: true}}
+	txRequest := BitcoinTxRequest{Outputs: []BitcoinOutput{{Address: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", Value: 500}}, FeeRate: 1}
+	if _, _, err := prepareBitcoinTransaction("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", utxos, txRequest); err == nil {
+		t.Error("P2PKH output below 546 satoshis should be rejected")
+	}
+	txRequest.Outputs[0].Address = "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	if _, _, err := prepareBitcoinTransaction("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", utxos, txRequest); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"strconv"
 	"time"
 
 	flow_aws_kms "bitbucket.org/carsonliving/aws-kms-client"
@@ -25,12 +26,6 @@ const RetrySleep = 3 * time.Second
 // AWS KSM Client instance
 var KSM flow_aws_kms.KMSClient = KSMClient()
 
-// TODO: need configuration file with list of ERC20 tokens we want to support
-// need symbol and smart contract address (smart contract address will be chain specific main vs test)
-var Erc20Map map[string]string = map[string]string{
-	"QKC": "0xb2a28A6f755b85eeF3cD41058A5d2A7A398281FC",
-}
-
 // Array of support blockchains
 var BlockchainIds = []string{
 	"ETH",
@@ -38,8 +33,19 @@ var BlockchainIds = []string{
 	"ADA",
 	"ALGO",
 	"AVAX",
+	"SOL",
+	"XLM",
 }
 
+// Blockchain networks used for address encodings
+const (
+	Mainnet = "mainnet"
+	Testnet = "testnet"
+)
+
+// Network selects mainnet or testnet address encodings
+var Network string = getNetwork()
+
 const (
 	//pubkeyCompressed   byte = 0x2 // y_bit + x coord
 	PubkeyUncompressed byte = 0x4 // x coord + y coord
@@ -53,9 +59,97 @@ const (
 	MFAVerified      = "mfaVerified"
 	CustomerVerified = "customerVerified"
 	Complete         = "complete"
+	Rejected         = "rejected"
+	Cancelled        = "cancelled"
+	Expired          = "expired"
 	Recovery         = "RecoveryRecord"
+	MFARecord        = "MFAEnrollment"
+)
+
+// RecoveryTransitions maps each recovery status to the status it must follow
+var RecoveryTransitions = map[string]string{
+	MFAVerified:      Initiated,
+	CustomerVerified: MFAVerified,
+	Complete:         CustomerVerified,
+}
+
+// Release status of the accounts covered by a recovery
+const (
+	RecoveryAccountPending       = "pending"
+	RecoveryAccountReleased      = "released"
+	RecoveryAccountReprovisioned = "reprovisioned"
+)
+
+// Pool keys are available until a claim reserves them, claimed keys are never handed out again
+const (
+	PaillierKeyAvailable = "available"
+	PaillierKeyClaimed   = "claimed"
+	PaillierClaimSize    = 3 // keys handed out by one claim
+)
+
+// Recovery modes, export releases the shares and reshare refreshes them for a new device
+const (
+	RecoveryModeExport  = "export"
+	RecoveryModeReshare = "reshare"
+)
+
+// Status of a re-sharing session
+const (
+	ReshareStarted    = "started"
+	ReshareDealt      = "dealt"
+	ReshareRefreshed  = "refreshed"
+	ReshareCommitted  = "committed"
+	ReshareComplete   = "complete"
+	ReshareRolledBack = "rolledBack"
+)
+
+// RecoveryEnded are the final statuses of a recovery record, ended records are kept as history
+var RecoveryEnded = []string{Complete, Rejected, Cancelled, Expired}
+
+// Evidence methods backing recovery transitions
+const (
+	EvidenceTOTP              = "totp"
+	EvidenceExpiry            = "expiry"
+	EvidenceOperatorQuorum    = "operatorQuorum"
+	EvidenceOperatorRejection = "operatorRejection"
+)
+
+// Waiting period between customer verification and release of recovered shares, configured with
+// RECOVERY_TIME_LOCK as a duration e.g. 72h
+var RecoveryTimeLock = getRecoveryDuration("RECOVERY_TIME_LOCK", 48*time.Hour)
+
+// Recoveries without progress for RECOVERY_EXPIRY, e.g. 168h, are expired by the sweeper
+var RecoveryExpiry = getRecoveryDuration("RECOVERY_EXPIRY", 7*24*time.Hour)
+
+// Wait time between runs of the recovery expiry sweeper
+const RecoverySweepInterval = 10 * time.Minute
+
+// Transaction lifecycle
+const (
+	TxCreated   = "created"
+	TxSigned    = "signed"
+	TxBroadcast = "broadcast"
+	TxConfirmed = "confirmed"
+	TxFailed    = "failed"
+	TxReplaced  = "replaced"
 )
 
+// Wait time between receipt polls of broadcast transactions
+const TxPollInterval = 15 * time.Second
+
+// EVM nonce reservations
+const (
+	NonceReserved          = "reserved"
+	NonceUsed              = "used"
+	NonceReleased          = "released"
+	NonceStale             = "stale"
+	NonceReservationRecord = "NonceReservation"
+	NonceCounterRecord     = "NonceCounter"
+)
+
+// Reserved nonces without a recorded transaction are released after this time
+const NonceReservationTTL = 10 * time.Minute
+
 var MongoDatabase string
 
 func getDatabase() {
@@ -66,3 +160,38 @@ func getDatabase() {
 	}
 	return
 }
+
+func getNetwork() string {
+	network, ok := os.LookupEnv("BLOCKCHAIN_NETWORK")
+	if !ok {
+		return Mainnet
+	}
+	if network != Mainnet && network != Testnet {
+		log.Fatal("invalid environment variable: BLOCKCHAIN_NETWORK")
+	}
+	return network
+}
+
+func getPoolSize(name string, defaultValue int) int {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultValue
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 {
+		log.Fatal("invalid environment variable: ", name)
+	}
+	return size
+}
+
+func getRecoveryDuration(name string, defaultValue time.Duration) time.Duration {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		log.Fatal("invalid environment variable: ", name)
+	}
+	return duration
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PrepareEDDSATransaction returns the account address and the payload the client needs to compute
+// its partial eddsa signature for a solana or stellar transaction
+func PrepareEDDSATransaction(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	var txRequest EDDSATxRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&txRequest)
+	if err != nil {
+		log.Error("Error decoding eddsa tx: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	defer CloseClientDB(DB)
+
+	share, err := readEDDSAShare(userId, blockchainId, accountName, keyShareCollection)
+	if err != nil {
+		log.Error("Error reading share err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	pk, err := parseEDDSAPublicKey(share.PK)
+	if err != nil {
+		log.Error("Error reading public key err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	address, err := deriveEDDSAAddress(blockchainId, pk)
+	if err != nil {
+		log.Error("Error deriving address err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	payload, _, err := prepareEDDSAPayload(blockchainId, txRequest)
+	if err != nil {
+		log.Error("Error preparing eddsa payload err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(EDDSATxPayload{
+		Address: address,
+		Payload: hex.EncodeToString(payload),
+	}, nil, c.Writer)
+	return
+}
+
+// POSTEDDSATransaction completes the eddsa signing of a solana or stellar transaction with the
+// custody share and returns the assembled signed transaction
+func POSTEDDSATransaction(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	var txRequest EDDSATxRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&txRequest)
+	if err != nil {
+		log.Error("Error decoding eddsa tx: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	payload, txData, err := prepareEDDSAPayload(blockchainId, txRequest)
+	if err != nil {
+		log.Error("Error preparing eddsa payload err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	defer CloseClientDB(DB)
+
+	share, err := readEDDSAShare(userId, blockchainId, accountName, keyShareCollection)
+	if err != nil {
+		log.Error("Error reading share err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	signature, err := completeEDDSASignature(share, payload, txRequest.Signature)
+	if err != nil {
+		log.Error("Error generating full signature:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	pk, _ := parseEDDSAPublicKey(share.PK)
+	signedTx, err := assembleEDDSATransaction(blockchainId, txData, payload, pk, signature)
+	if err != nil {
+		log.Error("Error assembling signed tx err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	recordSignedTransaction(userId, blockchainId, accountName, signedTx, DB.Database(MongoDatabase).Collection("TxCollection"))
+
+	ValidateAndWriteResponse(signedTx, nil, c.Writer)
+	return
+}
+
+// prepareEDDSAPayload returns the blockchain specific payload that is signed with eddsa and the
+// transaction data needed to assemble the signed transaction
+func prepareEDDSAPayload(blockchainId string, txRequest EDDSATxRequest) ([]byte, []byte, error) {
+	switch blockchainId {
+	case "SOL":
+		// solana signs the serialized message directly
+		message, err := prepareSolanaMessage(txRequest)
+		return message, message, err
+
+	case "XLM":
+		// stellar signs the network passphrase prefixed transaction hash
+		txXDR, err := decodeStellarEnvelope(txRequest.Envelope)
+		if err != nil {
+			return nil, nil, err
+		}
+		hash, err := stellarTransactionHash(txXDR, txRequest.Network)
+		return hash, txXDR, err
+	}
+
+	return nil, nil, fmt.Errorf("eddsa transaction signing not supported for blockchain: %s", blockchainId)
+}
+
+// assembleEDDSATransaction builds the blockchain specific signed transaction
+func assembleEDDSATransaction(blockchainId string, txData, payload []byte, pk ed25519.PublicKey, signature []byte) (SignedTxResponse, error) {
+	switch blockchainId {
+	case "SOL":
+		signedTx, txId, err := assembleSolanaTransaction(txData, pk, signature)
+		if err != nil {
+			return SignedTxResponse{}, err
+		}
+		return SignedTxResponse{TxHash: txId, SignedTx: base64.StdEncoding.EncodeToString(signedTx)}, nil
+
+	case "XLM":
+		return SignedTxResponse{TxHash: hex.EncodeToString(payload), SignedTx: assembleStellarEnvelope(txData, pk, signature)}, nil
+	}
+
+	return SignedTxResponse{}, fmt.Errorf("eddsa transaction signing not supported for blockchain: %s", blockchainId)
+}
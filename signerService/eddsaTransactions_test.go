@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+)
+
+func TestEDDSAAddresses(t *testing.T) {
+	pk := make(ed25519.PublicKey, ed25519.PublicKeySize)
+
+	address, err := deriveEDDSAAddress("SOL", pk)
+	if err != nil || address != "11111111111111111111111111111111" {
+		t.Error("Solana address does not match system program address")
+	}
+
+	address, err = deriveEDDSAAddress("XLM", pk)
+	if err != nil || address != "GAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAWHF" {
+		t.Error("Stellar address does not match StrKey encoding")
+	}
+
+	_, err = deriveEDDSAAddress("ETH", pk)
+	if err == nil {
+		t.Error("ETH is not an eddsa blockchain")
+	}
+}
+
+func TestSolanaTransactionAssembly(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("Error generating key")
+	}
+
+	txRequest := EDDSATxRequest{
+		Message: &SolanaMessage{
+			NumRequiredSignatures:       1,
+			NumReadonlyUnsignedAccounts: 1,
+			AccountKeys:                 []string{solanaAddress(pk), solanaAddress(make([]byte, 32))},
+			RecentBlockhash:             solanaAddress(pk),
+			Instructions: []SolanaInstruction{
+				{ProgramIdIndex: 1, Accounts: []uint8{0}, Data: base64.StdEncoding.EncodeToString([]byte{2, 0, 0, 0})},
+			},
+		},
+	}
+
+	payload, txData, err := prepareEDDSAPayload("SOL", txRequest)
+	if err != nil {
+		t.Fatal("Error preparing solana message:", err)
+	}
+	// header, 2 keys, blockhash, 1 instruction with 1 account and 4 bytes of data
+	if len(payload) != 3+1+64+32+1+1+1+1+1+4 {
+		t.Error("Unexpected solana message length")
+	}
+
+	signedTx, err := assembleEDDSATransaction("SOL", txData, payload, pk, ed25519.Sign(sk, payload))
+	if err != nil {
+		t.Fatal("Error assembling solana tx:", err)
+	}
+
+	txBytes, _ := base64.StdEncoding.DecodeString(signedTx.SignedTx)
+	if txBytes[0] != 1 || !ed25519.Verify(pk, txBytes[65:], txBytes[1:65]) {
+		t.Error("Solana transaction signature does not verify")
+	}
+
+	txRequest.Message.AccountKeys[0] = solanaAddress(make([]byte, 32))
+	payload, txData, _ = prepareEDDSAPayload("SOL", txRequest)
+	_, err = assembleEDDSATransaction("SOL", txData, payload, pk, ed25519.Sign(sk, payload))
+	if err == nil {
+		t.Error("Account is not a signer of the message")
+	}
+}
+
+func TestStellarEnvelopeAssembly(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("Error generating key")
+	}
+
+	txXDR := []byte{0, 0, 0, 0, 1, 2, 3, 4}
+	unsigned := make([]byte, 4)
+	binary.BigEndian.PutUint32(unsigned, stellarEnvelopeTypeTx)
+	unsigned = append(unsigned, txXDR...)
+	unsigned = append(unsigned, 0, 0, 0, 0)
+
+	txRequest := EDDSATxRequest{Envelope: base64.StdEncoding.EncodeToString(unsigned), Network: "testnet"}
+	payload, txData, err := prepareEDDSAPayload("XLM", txRequest)
+	if err != nil {
+		t.Fatal("Error preparing stellar hash:", err)
+	}
+
+	publicHash, _ := stellarTransactionHash(txData, "public")
+	if string(publicHash) == string(payload) {
+		t.Error("Stellar hash must depend on the network passphrase")
+	}
+
+	signature := ed25519.Sign(sk, payload)
+	signedTx, err := assembleEDDSATransaction("XLM", txData, payload, pk, signature)
+	if err != nil {
+		t.Fatal("Error assembling stellar envelope:", err)
+	}
+
+	envelope, _ := base64.StdEncoding.DecodeString(signedTx.SignedTx)
+	if len(envelope) != len(unsigned)+4+64+4 {
+		t.Error("Unexpected stellar envelope length")
+	}
+	if string(envelope[len(envelope)-64:]) != string(signature) {
+		t.Error("Stellar envelope does not end with the signature")
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// ERC20 methods that are built and decoded for review, transferFrom shares its selector with ERC721
+const erc20ABIJSON = `[
+	{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"function","name":"approve","inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"function","name":"transferFrom","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]}
+]`
+
+var erc20ABI abi.ABI = parseERC20ABI()
+
+func parseERC20ABI() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(erc20ABIJSON))
+	if err != nil {
+		log.Fatal("Error parsing ERC20 abi err:", err)
+	}
+	return parsed
+}
+
+// BuildTokenTransaction builds the contract call of an ERC20 transfer or approve for a registry token
+func BuildTokenTransaction(c *gin.Context) {
+	blockchainId := c.Param("blockchainId")
+
+	var txRequest TokenTxRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&txRequest)
+	if err != nil {
+		log.Error("Error decoding token tx: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	payload, err := buildTokenTransaction(blockchainId, txRequest)
+	if err != nil {
+		log.Error("Error building token tx err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(payload, nil, c.Writer)
+	return
+}
+
+// DecodeEVMTransaction returns a readable summary of what a submitted EVM transaction does
+func DecodeEVMTransaction(c *gin.Context) {
+	blockchainId := c.Param("blockchainId")
+
+	var txRequest EVMTxRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&txRequest)
+	if err != nil {
+		log.Error("Error decoding evm tx: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	summary, err := decodeEVMTransaction(blockchainId, txRequest.FullTx)
+	if err != nil {
+		log.Error("Error decoding evm tx err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(summary, nil, c.Writer)
+	return
+}
+
+// buildTokenTransaction returns the contract address and calldata of an ERC20 transfer or approve
+func buildTokenTransaction(blockchainId string, txRequest TokenTxRequest) (TokenTxPayload, error) {
+	if !isEVMBlockchain(blockchainId) {
+		return TokenTxPayload{}, fmt.Errorf("token transactions not supported for blockchain: %s", blockchainId)
+	}
+
+	token, err := lookupToken(blockchainId, txRequest.TokenId)
+	if err != nil {
+		return TokenTxPayload{}, err
+	}
+	if token.Standard != TokenStandardERC20 {
+		return TokenTxPayload{}, fmt.Errorf("token %s is not an ERC20 token", token.Symbol)
+	}
+
+	if txRequest.Method != "transfer" && txRequest.Method != "approve" {
+		return TokenTxPayload{}, fmt.Errorf("unsupported token method: %s", txRequest.Method)
+	}
+	if !common.IsHexAddress(txRequest.ToAddress) {
+		return TokenTxPayload{}, fmt.Errorf("invalid recipient address: %s", txRequest.ToAddress)
+	}
+
+	amount, err := parseTokenAmount(txRequest.Amount, token.Decimals)
+	if err != nil {
+		return TokenTxPayload{}, err
+	}
+
+	data, err := erc20ABI.Pack(txRequest.Method, common.HexToAddress(txRequest.ToAddress), amount)
+	if err != nil {
+		return TokenTxPayload{}, err
+	}
+
+	summary, err := summarizeCalldata(blockchainId, common.HexToAddress(token.ContractAddress), data)
+	if err != nil {
+		return TokenTxPayload{}, err
+	}
+
+	return TokenTxPayload{
+		To:      common.HexToAddress(token.ContractAddress).Hex(),
+		Value:   "0",
+		Data:    "0x" + hex.EncodeToString(data),
+		Summary: summary,
+	}, nil
+}
+
+// decodeEVMTransaction summarizes a JSON encoded EVM transaction, native transfers have no calldata
+func decodeEVMTransaction(blockchainId, fullTx string) (TxSummary, error) {
+	if !isEVMBlockchain(blockchainId) {
+		return TxSummary{}, fmt.Errorf("transaction decoding not supported for blockchain: %s", blockchainId)
+	}
+
+	tx, err := decodeFullTx(fullTx)
+	if err != nil {
+		return TxSummary{}, err
+	}
+	if tx.To() == nil {
+		return TxSummary{}, fmt.Errorf("contract creation transactions are not supported")
+	}
+
+	if len(tx.Data()) == 0 {
+		return TxSummary{
+			Method:    "nativeTransfer",
+			Token:     blockchainId,
+			Recipient: tx.To().Hex(),
+			Amount:    formatTokenAmount(tx.Value(), nativeDecimals(blockchainId)),
+			RawAmount: tx.Value().String(),
+		}, nil
+	}
+
+	summary, err := summarizeCalldata(blockchainId, *tx.To(), tx.Data())
+	if err != nil {
+		return TxSummary{}, err
+	}
+	if tx.Value().Sign() > 0 {
+		summary.Value = formatTokenAmount(tx.Value(), nativeDecimals(blockchainId))
+	}
+
+	return summary, nil
+}
+
+// summarizeCalldata ABI-decodes the calldata of a contract call, calls of unknown methods are
+// returned with their selector only
+func summarizeCalldata(blockchainId string, contract common.Address, data []byte) (TxSummary, error) {
+	summary := TxSummary{Method: "unknown", Contract: contract.Hex(), Token: contract.Hex()}
+	if len(data) < 4 {
+		return summary, fmt.Errorf("calldata is too short")
+	}
+	summary.Selector = "0x" + hex.EncodeToString(data[:4])
+
+	decimals := uint8(0)
+	token, err := lookupTokenByContract(blockchainId, contract.Hex())
+	if err == nil {
+		summary.Token = token.Symbol
+		decimals = token.Decimals
+	}
+
+	method, err := erc20ABI.MethodById(data[:4])
+	if err != nil {
+		return summary, nil
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return summary, fmt.Errorf("Error decoding %s calldata: %s", method.Name, err)
+	}
+
+	summary.Method = method.Name
+	if method.Name == "transferFrom" {
+		summary.From = args[0].(common.Address).Hex()
+		args = args[1:]
+	}
+	amount := args[1].(*big.Int)
+	summary.Recipient = args[0].(common.Address).Hex()
+	summary.Amount = formatTokenAmount(amount, decimals)
+	summary.RawAmount = amount.String()
+
+	return summary, nil
+}
+
+// parseTokenAmount converts a human readable decimal amount to the smallest token unit
+func parseTokenAmount(amount string, decimals uint8) (*big.Int, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if whole == "" && fraction == "" {
+		return nil, fmt.Errorf("invalid amount: %s", amount)
+	}
+	if len(fraction) > int(decimals) {
+		return nil, fmt.Errorf("amount %s has more than %d decimals", amount, decimals)
+	}
+
+	digits := whole + fraction + strings.Repeat("0", int(decimals)-len(fraction))
+	if strings.Trim(digits, "0123456789") != "" {
+		return nil, fmt.Errorf("invalid amount: %s", amount)
+	}
+
+	value, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount: %s", amount)
+	}
+	return value, nil
+}
+
+// formatTokenAmount converts an amount in the smallest token unit to a human readable decimal amount
+func formatTokenAmount(value *big.Int, decimals uint8) string {
+	if decimals == 0 {
+		return value.String()
+	}
+
+	digits := value.String()
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+	whole := digits[:len(digits)-int(decimals)]
+	fraction := strings.TrimRight(digits[len(digits)-int(decimals):], "0")
+	if fraction == "" {
+		return whole
+	}
+	return whole + "." + fraction
+}
+
+// nativeDecimals returns the decimals of the native asset of a blockchain, 18 for EVM chains
+func nativeDecimals(blockchainId string) uint8 {
+	for _, token := range Tokens[blockchainId][Network] {
+		if token.Standard == TokenStandardNative {
+			return token.Decimals
+		}
+	}
+	return 18
+}
+
+// isEVMBlockchain reports whether a blockchain uses EVM transactions and contract calls
+func isEVMBlockchain(blockchainId string) bool {
+	switch blockchainId {
+	case "ETH", "AVAX", "BNB", "MATIC":
+		return true
+	}
+	return false
+}
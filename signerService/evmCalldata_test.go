@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestBuildTokenTransaction(t *testing.T) {
+	payload, err := buildTokenTransaction("ETH", TokenTxRequest{
+		TokenId:   "QKC",
+		Method:    "transfer",
+		ToAddress: "0xba536245A30404A983E120a3d07A7dF260a89669",
+		Amount:    "1.5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "0xa9059cbb000000000000000000000000ba536245a30404a983e120a3d07a7df260a8966900000000000000000000000000000000000000000000000014d1120d7b160000"
+	if payload.Data != expected {
+		t.Error("Transfer calldata does not match ABI encoding")
+	}
+	if payload.Summary.Method != "transfer" || payload.Summary.Amount != "1.5" || payload.Summary.Token != "QKC" {
+		t.Error("Transfer summary does not match request")
+	}
+
+	_, err = buildTokenTransaction("ETH", TokenTxRequest{TokenId: "ETH", Method: "transfer", ToAddress: "0xba536245A30404A983E120a3d07A7dF260a89669", Amount: "1"})
+	if err == nil {
+		t.Error("Native asset should not build ERC20 calldata")
+	}
+
+	_, err = buildTokenTransaction("ETH", TokenTxRequest{TokenId: "QKC", Method: "burn", ToAddress: "0xba536245A30404A983E120a3d07A7dF260a89669", Amount: "1"})
+	if err == nil {
+		t.Error("Unsupported method should be rejected")
+	}
+}
+
+func TestDecodeEVMTransaction(t *testing.T) {
+	payload, _ := buildTokenTransaction("ETH", TokenTxRequest{
+		TokenId:   "QKC",
+		Method:    "approve",
+		ToAddress: "0x019ad7b3a616275df4272adad98a95d07658789e",
+		Amount:    "0.25",
+	})
+
+	contract := common.HexToAddress(payload.To)
+	approveTx := types.NewTx(&types.LegacyTx{Nonce: 1, To: &contract, Gas: 60000, GasPrice: big.NewInt(1), Data: common.FromHex(payload.Data)})
+	fullTx, _ := json.Marshal(approveTx)
+
+	summary, err := decodeEVMTransaction("ETH", string(fullTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Method != "approve" || summary.Token != "QKC" || summary.Amount != "0.25" ||
+		summary.Recipient != common.HexToAddress("0x019ad7b3a616275df4272adad98a95d07658789e").Hex() {
+		t.Error("Approve summary does not match calldata")
+	}
+
+	summary, err = decodeEVMTransaction("ETH", tx.FullTx)
+	if err != nil || summary.Method != "nativeTransfer" || summary.Amount != "0.01" {
+		t.Error("Native transfer summary does not match transaction value")
+	}
+
+	unknown := types.NewTx(&types.LegacyTx{To: &contract, Gas: 60000, GasPrice: big.NewInt(1), Data: common.FromHex("0xdeadbeef")})
+	fullTx, _ = json.Marshal(unknown)
+	summary, err = decodeEVMTransaction("ETH", string(fullTx))
+	if err != nil || summary.Method != "unknown" || summary.Selector != "0xdeadbeef" {
+		t.Error("Unknown method should be summarized with its selector")
+	}
+}
+
+func TestTokenAmounts(t *testing.T) {
+	amount, err := parseTokenAmount("12.000001", 6)
+	if err != nil || amount.String() != "12000001" {
+		t.Error("Amount should be converted with token decimals")
+	}
+
+	for _, invalid := range []string{"", ".", "-1", "1.0000001", "1e6", "0x10"} {
+		_, err = parseTokenAmount(invalid, 6)
+		if err == nil {
+			t.Errorf("Invalid amount should be rejected: %s", invalid)
+		}
+	}
+
+	if formatTokenAmount(big.NewInt(5), 6) != "0.000005" || formatTokenAmount(big.NewInt(12000000), 6) != "12" {
+		t.Error("Amount should be formatted with token decimals")
+	}
+}
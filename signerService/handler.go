@@ -1,16 +1,81 @@
 package main
 
 import (
+	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"strings"
 
 	flowErrors "bitbucket.org/carsonliving/flow.packages.errors"
+	"github.com/golang-jwt/jwt/v4"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/gin-gonic/gin"
 )
 
+// UserTokenKey verifies the RS256 bearer tokens of the user endpoints, it is loaded from the PEM file
+// USER_TOKEN_PUBLIC_KEY_FILE. Without it every request to a user endpoint is rejected
+var UserTokenKey *rsa.PublicKey = loadUserTokenKey()
+
+func loadUserTokenKey() *rsa.PublicKey {
+	path, ok := os.LookupEnv("USER_TOKEN_PUBLIC_KEY_FILE")
+	if !ok {
+		log.Warn("missing environment variable: USER_TOKEN_PUBLIC_KEY_FILE, user endpoints are disabled")
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal("Error reading user token key err:", err)
+	}
+	key, err := jwt.ParseRSAPublicKeyFromPEM(data)
+	if err != nil {
+		log.Fatal("Error loading user token key err:", err)
+	}
+	return key
+}
+
+// authenticatedUserId returns the subject of the bearer token of a request once its signature and expiry are verified
+func authenticatedUserId(r *http.Request, key *rsa.PublicKey) (string, error) {
+	if key == nil {
+		return "", fmt.Errorf("user authentication is not configured")
+	}
+
+	reqToken := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer"))
+	if reqToken == "" {
+		return "", fmt.Errorf("missing bearer token")
+	}
+
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(reqToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
+	if err != nil {
+		return "", err
+	}
+	if claims.Subject == "" || claims.ExpiresAt == nil {
+		return "", fmt.Errorf("token without subject or expiry")
+	}
+
+	return claims.Subject, nil
+}
+
+// authorizeUser checks that the bearer token of the request belongs to userId and writes an unauthorized response otherwise
+func authorizeUser(c *gin.Context, userId string) bool {
+	callerId, err := authenticatedUserId(c.Request, UserTokenKey)
+	if err != nil {
+		WriteErrorResponse(http.StatusUnauthorized, fmt.Sprintf("Error: %s", err), c.Writer)
+		return false
+	}
+	if callerId != userId {
+		WriteErrorResponse(http.StatusUnauthorized, fmt.Sprintf("Error: %s", "token does not belong to the user"), c.Writer)
+		return false
+	}
+	return true
+}
+
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
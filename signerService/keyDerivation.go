@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BIP32 limits, only non-hardened children can be derived from the public key
+const (
+	hardenedKeyStart    uint32 = 0x80000000
+	maxDerivedAddresses        = 100
+)
+
+// ECDSAShareValue is the JSON representation of ShareData.Share
+type ECDSAShareValue struct {
+	Identifier uint32     `json:"Identifier"` // participant identifier used during MPC key generation
+	Value      *big.Int   `json:"Value"`      // secret share value
+	Point      ECDSAPoint `json:"Point"`      // share value times the generator
+}
+
+// ECDSAPublicShare is the JSON representation of an entry of ShareData.PubShares
+type ECDSAPublicShare struct {
+	Point ECDSAPoint `json:"Point"` // public share point of a participant
+}
+
+// GetDerivedAddresses returns the addresses of the non-hardened children m/0/i of an account key
+func GetDerivedAddresses(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	start, err := strconv.Atoi(c.DefaultQuery("start", "0"))
+	if err != nil || start < 0 {
+		WriteErrorResponse(http.StatusBadRequest, "Invalid query parameter: start", c.Writer)
+		return
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", "10"))
+	if err != nil || count < 1 || count > maxDerivedAddresses {
+		WriteErrorResponse(http.StatusBadRequest, "Invalid query parameter: count", c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	defer CloseClientDB(DB)
+
+	share, err := readECDSAShare(userId, blockchainId, accountName, keyShareCollection)
+	if err != nil {
+		log.Error("Error reading share err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var result []DerivedAddress
+	for i := start; i < start+count; i++ {
+		path := fmt.Sprintf("m/0/%d", i)
+		_, childPK, _, err := deriveChildKey(share, path)
+		if err != nil {
+			log.Error("Error deriving child key err:", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+
+		address, err := deriveECDSAAddress(blockchainId, encodePublicKey(childPK))
+		if err != nil {
+			log.Error("Error deriving address err:", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+		result = append(result, DerivedAddress{Path: path, Address: address})
+	}
+
+	ValidateAndWriteResponse(result, nil, c.Writer)
+	return
+}
+
+// parseDerivationPath parses a non-hardened BIP32 path such as m/0/5
+func parseDerivationPath(path string) ([]uint32, error) {
+	segments := strings.Split(strings.TrimSpace(path), "/")
+	if len(segments) == 0 || segments[0] != "m" {
+		return nil, fmt.Errorf("derivation path must start with m: %s", path)
+	}
+
+	var indexes []uint32
+	for _, segment := range segments[1:] {
+		if strings.HasSuffix(segment, "'") || strings.HasSuffix(segment, "h") {
+			return nil, fmt.Errorf("hardened derivation is not supported: %s", path)
+		}
+		index, err := strconv.ParseUint(segment, 10, 32)
+		if err != nil || uint32(index) >= hardenedKeyStart {
+			return nil, fmt.Errorf("invalid derivation path index: %s", segment)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+
+	return indexes, nil
+}
+
+// parseChainCode decodes the chain code of the root key. The chain code is generated from secret
+// randomness at keygen, without one derivation is not enabled for the account since a chain code
+// computed from the public key would let anyone link the child addresses
+func parseChainCode(chainCodeHex string) ([]byte, error) {
+	if chainCodeHex == "" {
+		return nil, fmt.Errorf("derivation is not enabled, the account has no chain code")
+	}
+
+	chainCode, err := hex.DecodeString(strings.TrimPrefix(chainCodeHex, "0x"))
+	if err != nil || len(chainCode) != 32 {
+		return nil, fmt.Errorf("chain code must be 32 hex encoded bytes")
+	}
+	return chainCode, nil
+}
+
+// deriveChildPublicKey is BIP32 CKDpub: it returns the additive tweak, the child public key
+// and the child chain code for a non-hardened index
+func deriveChildPublicKey(parentPK *ecdsa.PublicKey, chainCode []byte, index uint32) (*big.Int, *ecdsa.PublicKey, []byte, error) {
+	if index >= hardenedKeyStart {
+		return nil, nil, nil, fmt.Errorf("hardened derivation is not supported")
+	}
+
+	data := make([]byte, 37)
+	copy(data, crypto.CompressPubkey(parentPK))
+	binary.BigEndian.PutUint32(data[33:], index)
+
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	I := mac.Sum(nil)
+
+	tweak := new(big.Int).SetBytes(I[:32])
+	if tweak.Cmp(secp256k1N) >= 0 {
+		return nil, nil, nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+
+	child := addTweakToPoint(parentPK, tweak)
+	if child.X.Sign() == 0 && child.Y.Sign() == 0 {
+		return nil, nil, nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+
+	return tweak, child, I[32:], nil
+}
+
+// deriveChildKey follows a derivation path from the share root key and returns the accumulated
+// additive tweak, the child public key and the child chain code
+func deriveChildKey(share KeyShare, path string) (*big.Int, *ecdsa.PublicKey, []byte, error) {
+	indexes, err := parseDerivationPath(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	pk, err := parseECDSAPublicKey(share.ShareData.PK)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	chainCode, err := parseChainCode(share.ChainCode)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	total := new(big.Int)
+	for _, index := range indexes {
+		var tweak *big.Int
+		tweak, pk, chainCode, err = deriveChildPublicKey(pk, chainCode, index)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		total.Add(total, tweak)
+		total.Mod(total, secp256k1N)
+	}
+
+	return total, pk, chainCode, nil
+}
+
+// applyDerivationPath returns a copy of the share for the child key at the derivation path. Every
+// participant adds the same tweak to its share value, which shifts the shared secret by the tweak
+// and keeps the public shares and group public key consistent
+func applyDerivationPath(share KeyShare, path string) (KeyShare, error) {
+	if path == "" || path == "m" {
+		return share, nil
+	}
+
+	tweak, childPK, _, err := deriveChildKey(share, path)
+	if err != nil {
+		return share, err
+	}
+
+	var shareValue ECDSAShareValue
+	err = json.Unmarshal([]byte(share.ShareData.Share), &shareValue)
+	if err != nil || shareValue.Value == nil {
+		return share, fmt.Errorf("Error decoding share value: %v", err)
+	}
+	sharePoint, err := pointToPublicKey(shareValue.Point)
+	if err != nil {
+		return share, err
+	}
+	shareValue.Value = new(big.Int).Add(shareValue.Value, tweak)
+	shareValue.Value.Mod(shareValue.Value, secp256k1N)
+	shareValue.Point = publicKeyToPoint(addTweakToPoint(sharePoint, tweak))
+
+	pubShares := make(map[string]string)
+	for id, pubShareJSON := range share.ShareData.PubShares {
+		var pubShare ECDSAPublicShare
+		err = json.Unmarshal([]byte(pubShareJSON), &pubShare)
+		if err != nil {
+			return share, fmt.Errorf("Error decoding public share %s: %s", id, err)
+		}
+		point, err := pointToPublicKey(pubShare.Point)
+		if err != nil {
+			return share, err
+		}
+		pubShare.Point = publicKeyToPoint(addTweakToPoint(point, tweak))
+		pubShareBytes, _ := json.Marshal(pubShare)
+		pubShares[id] = string(pubShareBytes)
+	}
+
+	shareValueBytes, _ := json.Marshal(shareValue)
+	child := share
+	child.ShareData.PK = encodePublicKey(childPK)
+	child.ShareData.Share = string(shareValueBytes)
+	child.ShareData.PubShares = pubShares
+
+	return child, nil
+}
+
+// addTweakToPoint returns point + tweak * G
+func addTweakToPoint(point *ecdsa.PublicKey, tweak *big.Int) *ecdsa.PublicKey {
+	curve := crypto.S256()
+	tx, ty := curve.ScalarBaseMult(tweak.Bytes())
+	x, y := curve.Add(point.X, point.Y, tx, ty)
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+}
+
+// publicKeyToPoint converts an ecdsa public key to the JSON point representation of the MPC shares
+func publicKeyToPoint(pk *ecdsa.PublicKey) ECDSAPoint {
+	return ECDSAPoint{CurveName: "secp256k1", X: pk.X, Y: pk.Y}
+}
+
+// encodePublicKey returns the ShareData.PK JSON representation of an ecdsa public key
+func encodePublicKey(pk *ecdsa.PublicKey) string {
+	pkBytes, _ := json.Marshal(publicKeyToPoint(pk))
+	return string(pkBytes)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// decodeXpub returns the chain code and compressed public key of a BIP32 extended public key
+func decodeXpub(xpub string) ([]byte, []byte) {
+	decoded := base58.Decode(xpub)
+	return decoded[13:45], decoded[45:78]
+}
+
+func TestDeriveChildPublicKey(t *testing.T) {
+	// BIP32 test vector 2, m -> m/0
+	chainCode, compressedPK := decodeXpub("xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB")
+	childChainCode, childCompressedPK := decodeXpub("xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH")
+
+	parentPK, err := crypto.DecompressPubkey(compressedPK)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, childPK, derivedChainCode, err := deriveChildPublicKey(parentPK, chainCode, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(crypto.CompressPubkey(childPK), childCompressedPK) {
+		t.Error("Child public key does not match BIP32 test vector")
+	}
+	if !bytes.Equal(derivedChainCode, childChainCode) {
+		t.Error("Child chain code does not match BIP32 test vector")
+	}
+
+	share := KeyShare{ChainCode: hex.EncodeToString(chainCode)}
+	share.ShareData.PK = encodePublicKey(parentPK)
+	_, pathPK, _, err := deriveChildKey(share, "m/0")
+	if err != nil || !bytes.Equal(crypto.CompressPubkey(pathPK), childCompressedPK) {
+		t.Error("Derivation path m/0 does not match BIP32 test vector")
+	}
+}
+
+func TestApplyDerivationPath(t *testing.T) {
+	// a single participant share of private key 1
+	share := KeyShare{}
+	share.ShareData.PK = generatorPK
+	share.ShareData.Share = fmt.Sprintf(`{"Identifier":1,"Value":1,"Point":%s}`, generatorPK)
+	share.ShareData.PubShares = map[string]string{"1": fmt.Sprintf(`{"Point":%s}`, generatorPK)}
+
+	// derivation needs the chain code generated at keygen
+	if _, err := applyDerivationPath(share, "m/0/7"); err == nil {
+		t.Error("Derivation without a chain code should be rejected")
+	}
+	share.ChainCode = strings.Repeat("07", 32)
+
+	child, err := applyDerivationPath(share, "m/0/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, childPK, _, _ := deriveChildKey(share, "m/0/7")
+	if child.ShareData.PK != encodePublicKey(childPK) {
+		t.Error("Child share public key does not match derived public key")
+	}
+
+	var shareValue ECDSAShareValue
+	json.Unmarshal([]byte(child.ShareData.Share), &shareValue)
+	x, y := crypto.S256().ScalarBaseMult(shareValue.Value.Bytes())
+	if x.Cmp(shareValue.Point.X) != 0 || y.Cmp(shareValue.Point.Y) != 0 {
+		t.Error("Child share point does not match child share value")
+	}
+	if x.Cmp(childPK.X) != 0 || y.Cmp(childPK.Y) != 0 {
+		t.Error("Child share value of a single participant should be the child private key")
+	}
+
+	var pubShare ECDSAPublicShare
+	json.Unmarshal([]byte(child.ShareData.PubShares["1"]), &pubShare)
+	if pubShare.Point.X.Cmp(x) != 0 || pubShare.Point.Y.Cmp(y) != 0 {
+		t.Error("Child public share does not match child share point")
+	}
+
+	if share.ShareData.PubShares["1"] == child.ShareData.PubShares["1"] {
+		t.Error("Applying a derivation path should not modify the root share")
+	}
+
+	unchanged, err := applyDerivationPath(share, "")
+	if err != nil || unchanged.ShareData.Share != share.ShareData.Share {
+		t.Error("Empty derivation path should return the root share")
+	}
+}
+
+func TestParseDerivationPath(t *testing.T) {
+	indexes, err := parseDerivationPath("m/0/5")
+	if err != nil || len(indexes) != 2 || indexes[0] != 0 || indexes[1] != 5 {
+		t.Error("Path m/0/5 should parse to indexes 0 and 5")
+	}
+
+	for _, path := range []string{"m/44'/0", "m/0h", "m/2147483648", "0/1", "m/x"} {
+		_, err = parseDerivationPath(path)
+		if err == nil {
+			t.Errorf("Path %s should be rejected", path)
+		}
+	}
+}
@@ -15,8 +15,18 @@ func main() {
 	}
 	getDatabase()
 
+	createIndexes()
+
+	go migratePaillierKeys()
+
+	go backfillAccountPublicKeys()
+
 	go generatePaillierKeys()
 
+	go trackTransactions()
+
+	go sweepRecoveries()
+
 	fmt.Printf("** Service Started on Port %s **", listenAddress)
 
 	router := gin.Default()
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Bitcoin signed message magic prefix defined in BIP-137
+const bitcoinMessageMagic = "Bitcoin Signed Message:\n"
+
+// BIP-137 header byte offsets for each address type, the recovery id is added to the offset
+var bip137HeaderOffsets = map[string]byte{
+	"p2pkh-uncompressed": 27,
+	"p2pkh":              31,
+	"p2sh-p2wpkh":        35,
+	"p2wpkh":             39,
+}
+
+// secp256k1 group order and half order used to normalize signatures to low s form
+var (
+	secp256k1N     = crypto.S256().Params().N
+	secp256k1HalfN = new(big.Int).Rsh(secp256k1N, 1)
+)
+
+// decodeMessage converts a raw message to bytes, the encoding is either utf8 (default) or hex
+func decodeMessage(message, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", "utf8":
+		return []byte(message), nil
+	case "hex":
+		return hexutil.Decode("0x" + strings.TrimPrefix(message, "0x"))
+	}
+
+	return nil, fmt.Errorf("unsupported message encoding: %s", encoding)
+}
+
+// prepareMessageHash applies the blockchain specific signed message prefix and hashing to a message
+func prepareMessageHash(message []byte, blockchainId string) ([]byte, error) {
+	switch blockchainId {
+	case "ETH", "AVAX", "BNB", "MATIC":
+		// EIP-191 personal_sign: keccak256("\x19Ethereum Signed Message:\n" + len(message) + message)
+		return accounts.TextHash(message), nil
+
+	case "BTC":
+		// BIP-137: double sha256 of the var string encoded magic followed by the var string encoded message
+		var buf bytes.Buffer
+		writeVarBytes(&buf, []byte(bitcoinMessageMagic))
+		writeVarBytes(&buf, message)
+		first := sha256.Sum256(buf.Bytes())
+		second := sha256.Sum256(first[:])
+		return second[:], nil
+	}
+
+	return nil, fmt.Errorf("message signing not supported for blockchain: %s", blockchainId)
+}
+
+// writeVarBytes writes a bitcoin compact size length prefix followed by the data
+func writeVarBytes(buf *bytes.Buffer, data []byte) {
+	writeVarInt(buf, uint64(len(data)))
+	buf.Write(data)
+}
+
+// writeVarInt writes a bitcoin compact size unsigned integer
+func writeVarInt(buf *bytes.Buffer, value uint64) {
+	switch {
+	case value < 0xfd:
+		buf.WriteByte(byte(value))
+	case value <= 0xffff:
+		buf.WriteByte(0xfd)
+		binary.Write(buf, binary.LittleEndian, uint16(value))
+	case value <= 0xffffffff:
+		buf.WriteByte(0xfe)
+		binary.Write(buf, binary.LittleEndian, uint32(value))
+	default:
+		buf.WriteByte(0xff)
+		binary.Write(buf, binary.LittleEndian, value)
+	}
+}
+
+// recoverableSignature normalizes an MPC signature to low s form and returns it as
+// 65 bytes r || s || recoveryId, the recovery id is found by matching the account public key
+func recoverableSignature(signature ECDSASignature, hash []byte, pk *ecdsa.PublicKey) ([]byte, error) {
+	if signature.R == nil || signature.S == nil {
+		return nil, fmt.Errorf("signature is missing r or s value")
+	}
+
+	s := new(big.Int).Set(signature.S)
+	if s.Cmp(secp256k1HalfN) > 0 {
+		s.Sub(secp256k1N, s)
+	}
+
+	sig := make([]byte, 65)
+	signature.R.FillBytes(sig[0:32])
+	s.FillBytes(sig[32:64])
+
+	expected := crypto.FromECDSAPub(pk)
+	for recoveryId := byte(0); recoveryId < 2; recoveryId++ {
+		sig[64] = recoveryId
+		recovered, err := crypto.Ecrecover(hash, sig)
+		if err == nil && bytes.Equal(recovered, expected) {
+			return sig, nil
+		}
+	}
+
+	return nil, fmt.Errorf("signature does not match account public key")
+}
+
+// formatMessageSignature converts the combined MPC signature into the format expected by
+// each ecosystem's message verifiers. ETH style chains return 0x hex r || s || v with v = 27 + recoveryId
+// and BTC returns the base64 BIP-137 compact signature for the requested address type
+func formatMessageSignature(signatureJSON string, hash []byte, pk *ecdsa.PublicKey, blockchainId, addressType string) (string, error) {
+	var signature ECDSASignature
+	err := json.Unmarshal([]byte(signatureJSON), &signature)
+	if err != nil {
+		return "", fmt.Errorf("Error decoding signature: %s", err)
+	}
+
+	sig, err := recoverableSignature(signature, hash, pk)
+	if err != nil {
+		return "", err
+	}
+
+	switch blockchainId {
+	case "ETH", "AVAX", "BNB", "MATIC":
+		sig[64] += 27
+		return hexutil.Encode(sig), nil
+
+	case "BTC":
+		if addressType == "" {
+			addressType = "p2wpkh"
+		}
+		offset, ok := bip137HeaderOffsets[addressType]
+		if !ok {
+			return "", fmt.Errorf("unsupported bitcoin address type: %s", addressType)
+		}
+		compact := append([]byte{offset + sig[64]}, sig[:64]...)
+		return base64.StdEncoding.EncodeToString(compact), nil
+	}
+
+	return "", fmt.Errorf("message signing not supported for blockchain: %s", blockchainId)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestPrepareETHMessageHash(t *testing.T) {
+	hash, err := prepareMessageHash([]byte("hello"), "ETH")
+	if err != nil {
+		t.Error("Error calculating ETH message hash")
+	}
+
+	if hex.EncodeToString(hash) != "50b2c43fd39106bafbba0da34fc430e1f91e3c96ea2acee2bc34119f92b37750" {
+		t.Error("EIP-191 message hash does not match")
+	}
+
+	_, err = prepareMessageHash([]byte("hello"), "ADA")
+	if err == nil {
+		t.Error("Message signing should not be supported for ADA")
+	}
+}
+
+func TestFormatMessageSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal("Error generating key")
+	}
+
+	for _, blockchainId := range []string{"ETH", "BTC"} {
+		hash, err := prepareMessageHash([]byte("proof of reserves"), blockchainId)
+		if err != nil {
+			t.Fatal("Error calculating message hash")
+		}
+
+		sig, err := crypto.Sign(hash, key)
+		if err != nil {
+			t.Fatal("Error signing message hash")
+		}
+		signatureJSON := fmt.Sprintf(`{"V":0,"R":%s,"S":%s}`, new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:64]))
+
+		formatted, err := formatMessageSignature(signatureJSON, hash, &key.PublicKey, blockchainId, "")
+		if err != nil {
+			t.Fatal("Error formatting signature:", err)
+		}
+
+		var recoverable []byte
+		if blockchainId == "ETH" {
+			recoverable, _ = hex.DecodeString(formatted[2:])
+			recoverable[64] -= 27
+		} else {
+			compact, _ := base64.StdEncoding.DecodeString(formatted)
+			if compact[0] < 39 || compact[0] > 42 {
+				t.Error("BIP-137 header should be for a P2WPKH address")
+			}
+			recoverable = append(compact[1:], compact[0]-39)
+		}
+
+		recovered, err := crypto.SigToPub(hash, recoverable)
+		if err != nil || crypto.PubkeyToAddress(*recovered) != crypto.PubkeyToAddress(key.PublicKey) {
+			t.Error("Formatted signature does not recover to signing key for ", blockchainId)
+		}
+	}
+}
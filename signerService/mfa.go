@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RFC 6238 TOTP parameters, codes of the previous and next time step are accepted for clock drift
+const (
+	TOTPIssuer     = "signerService"
+	TOTPPeriod     = 30
+	TOTPDigits     = 6
+	TOTPSkew       = 1
+	totpSecretSize = 20
+)
+
+// Online guessing of codes is limited, every code checked counts as an attempt until one is accepted. After
+// MFAMaxAttempts the enrollment is locked, each further lockout before an accepted code doubles the lockout
+const (
+	MFAMaxAttempts = 5
+	MFALockout     = 5 * time.Minute
+	MFAMaxLockout  = 24 * time.Hour
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollMFA creates a TOTP secret for the authenticated user, the secret is returned once and stored
+// encrypted. The enrollment is only used after the first code is confirmed
+func EnrollMFA(c *gin.Context) {
+	userId := c.Param("userId")
+	if !authorizeUser(c, userId) {
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	defer CloseClientDB(DB)
+
+	enrollment, err := readMFAEnrollment(userId, userCollection)
+	if err == nil && enrollment.Confirmed {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "MFA already enrolled"), c.Writer)
+		return
+	} else if err != nil && err != mongo.ErrNoDocuments {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	secret := make([]byte, totpSecretSize)
+	_, err = rand.Read(secret)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ciphertexts, err := chunkEncryptData(secret)
+	if err != nil {
+		log.Error("Error encrypting mfa secret:", err)
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	err = writeMFAEnrollment(MFAEnrollment{UserId: userId, Secret: ciphertexts, CreatedAt: time.Now().UTC(), RecordType: MFARecord}, userCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(MFAEnrollmentResponse{
+		Secret: totpEncoding.EncodeToString(secret),
+		URI:    totpURI(userId, secret),
+	}, nil, c.Writer)
+	return
+}
+
+// ConfirmMFA activates a TOTP enrollment of the authenticated user with a code from the authenticator app
+func ConfirmMFA(c *gin.Context) {
+	userId := c.Param("userId")
+	if !authorizeUser(c, userId) {
+		return
+	}
+
+	var request MFARequest
+	err := json.NewDecoder(c.Request.Body).Decode(&request)
+	if err != nil {
+		log.Error("Error decoding mfa request: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	defer CloseClientDB(DB)
+
+	_, err = verifyMFACode(userId, request.Code, false, userCollection)
+	if err != nil {
+		log.Error("Error verifying mfa code err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(SuccessDetails{
+		Message: "Success",
+	}, nil, c.Writer)
+	return
+}
+
+// ResetMFA removes the TOTP enrollment of a user who lost the authenticator so the authenticated user can
+// enroll again. The reset must be signed by a recovery approver for the current enrollment
+func ResetMFA(c *gin.Context) {
+	userId := c.Param("userId")
+	if !authorizeUser(c, userId) {
+		return
+	}
+
+	var request MFAResetRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&request)
+	if err != nil {
+		log.Error("Error decoding mfa reset request: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	defer CloseClientDB(DB)
+
+	enrollment, err := readMFAEnrollment(userId, userCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "MFA not enrolled"), c.Writer)
+		return
+	}
+
+	err = verifyMFAReset(Operators, enrollment, request)
+	if err != nil {
+		log.Error("Error verifying mfa reset err:", err)
+		WriteErrorResponse(http.StatusUnauthorized, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	err = deleteMFAEnrollment(userId, enrollment.ID, userCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	log.Info("MFA reset, userId: ", userId, ", operator: ", request.OperatorId)
+
+	ValidateAndWriteResponse(SuccessDetails{
+		Message: "Success",
+	}, nil, c.Writer)
+	return
+}
+
+// verifyMFAReset checks that a recovery approver signed the reset of this enrollment, a signature
+// can not be replayed once the user enrolled again
+func verifyMFAReset(registry OperatorRegistry, enrollment MFAEnrollment, request MFAResetRequest) error {
+	operator, err := lookupApprover(registry, request.OperatorId)
+	if err != nil {
+		return err
+	}
+
+	pk, err := parseEDDSAPublicKey(operator.PublicKey)
+	if err != nil {
+		return err
+	}
+	sig, err := parseEDDSASignature(request.Signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pk, mfaResetMessage(enrollment), sig) {
+		return fmt.Errorf("invalid operator signature")
+	}
+
+	return nil
+}
+
+// mfaResetMessage is the message signed by an operator, it binds the reset to one enrollment
+func mfaResetMessage(enrollment MFAEnrollment) []byte {
+	return []byte(fmt.Sprintf("signerService mfa reset\nuserId: %s\nenrollmentId: %s", enrollment.UserId, enrollment.ID.Hex()))
+}
+
+// verifyMFACode checks a TOTP code against the enrollment of a user and returns the matched time step.
+// A time step is only accepted once, a confirmed enrollment is required unless the code confirms it.
+// Codes are not checked while the enrollment is locked after too many invalid codes
+func verifyMFACode(userId, code string, requireConfirmed bool, userCollection *mongo.Collection) (int64, error) {
+	enrollment, err := readMFAEnrollment(userId, userCollection)
+	if err == mongo.ErrNoDocuments {
+		return 0, fmt.Errorf("MFA not enrolled")
+	} else if err != nil {
+		return 0, err
+	}
+	if requireConfirmed && !enrollment.Confirmed {
+		return 0, fmt.Errorf("MFA enrollment not confirmed")
+	}
+
+	now := time.Now().UTC()
+	if now.Before(enrollment.LockedUntil) {
+		return 0, fmt.Errorf("MFA locked until %s", enrollment.LockedUntil.Format(time.RFC3339))
+	}
+	// the attempt is counted before the code is checked so concurrent guesses can not pass the limit
+	enrollment, err = claimMFAAttempt(userId, now, userCollection)
+	if err == mongo.ErrNoDocuments {
+		return 0, fmt.Errorf("MFA locked, retry later")
+	} else if err != nil {
+		return 0, err
+	}
+	if enrollment.FailedAttempts > MFAMaxAttempts {
+		return 0, fmt.Errorf("too many invalid MFA codes, retry later")
+	}
+
+	secret, err := decrypChunkData(enrollment.Secret)
+	if err != nil {
+		log.Error("Error decrypting mfa secret ", err)
+		return 0, err
+	}
+
+	step, ok := validateTOTP(secret, code, now)
+	if !ok || step <= enrollment.LastTimeStep {
+		err = recordMFAFailure(userId, enrollment, now, userCollection)
+		if err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("invalid MFA code")
+	}
+
+	// claiming the time step rejects a replay of the same code
+	err = useMFATimeStep(userId, step, userCollection)
+	if err != nil {
+		return 0, err
+	}
+
+	return step, nil
+}
+
+// recordMFAFailure locks the enrollment once the attempts since the last accepted code reach MFAMaxAttempts
+func recordMFAFailure(userId string, enrollment MFAEnrollment, now time.Time, userCollection *mongo.Collection) error {
+	if enrollment.FailedAttempts < MFAMaxAttempts {
+		return nil
+	}
+
+	lockedUntil := now.Add(mfaLockout(enrollment.Lockouts))
+	log.Warn("MFA locked after invalid codes, userId: ", userId, ", until: ", lockedUntil)
+	return lockMFAEnrollment(userId, lockedUntil, userCollection)
+}
+
+// mfaLockout returns the duration of a lockout after the given number of previous lockouts
+func mfaLockout(lockouts int) time.Duration {
+	lockout := MFALockout
+	for i := 0; i < lockouts && lockout < MFAMaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > MFAMaxLockout {
+		return MFAMaxLockout
+	}
+	return lockout
+}
+
+// validateTOTP checks an RFC 6238 code within the allowed clock skew and returns its time step
+func validateTOTP(secret []byte, code string, now time.Time) (int64, bool) {
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / TOTPPeriod
+	for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+		if hmac.Equal([]byte(totpCode(secret, step, TOTPDigits)), []byte(code)) {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// totpCode returns the RFC 4226 HOTP value of the time step counter with dynamic truncation
+func totpCode(secret []byte, step int64, digits int) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%modulo)
+}
+
+// totpURI returns the otpauth URI shown as QR code by authenticator apps
+func totpURI(userId string, secret []byte) string {
+	query := url.Values{}
+	query.Set("secret", totpEncoding.EncodeToString(secret))
+	query.Set("issuer", TOTPIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTPDigits))
+	query.Set("period", fmt.Sprint(TOTPPeriod))
+
+	return fmt.Sprintf("otpauth://totp/%s:%s?%s", url.PathEscape(TOTPIssuer), url.PathEscape(userId), query.Encode())
+}
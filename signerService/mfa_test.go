@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B test vectors for the SHA1 secret
+	secret := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+
+	for unixTime, expected := range vectors {
+		if code := totpCode(secret, unixTime/TOTPPeriod, 8); code != expected {
+			t.Errorf("Unexpected code at %d: %s, expected %s", unixTime, code, expected)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / TOTPPeriod
+
+	matched, ok := validateTOTP(secret, totpCode(secret, step, TOTPDigits), now)
+	if !ok || matched != step {
+		t.Error("Current code should be accepted")
+	}
+	matched, ok = validateTOTP(secret, totpCode(secret, step-1, TOTPDigits), now)
+	if !ok || matched != step-1 {
+		t.Error("Code of the previous time step should be accepted")
+	}
+	if _, ok = validateTOTP(secret, totpCode(secret, step+2, TOTPDigits), now); ok {
+		t.Error("Code outside the allowed skew should be rejected")
+	}
+	if _, ok = validateTOTP(secret, "12345", now); ok {
+		t.Error("Code with wrong length should be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(totpURI("user 1", []byte("12345678901234567890")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || !strings.HasSuffix(uri.Path, ":user 1") {
+		t.Error("Unexpected otpauth uri:", uri)
+	}
+	if uri.Query().Get("secret") != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" || uri.Query().Get("issuer") != TOTPIssuer {
+		t.Error("Unexpected otpauth parameters:", uri.Query())
+	}
+}
+
+func TestRecoveryTransitions(t *testing.T) {
+	status := Initiated
+	for _, next := range []string{MFAVerified, CustomerVerified, Complete} {
+		if RecoveryTransitions[next] != status {
+			t.Errorf("%s should follow %s", next, status)
+		}
+		status = next
+	}
+	if _, ok := RecoveryTransitions[Initiated]; ok {
+		t.Error("Initiated is only reached by starting a recovery")
+	}
+}
+
+// userToken returns an RS256 bearer token for subject expiring after ttl
+func userToken(t *testing.T, key *rsa.PrivateKey, subject string, ttl time.Duration) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{Subject: subject, ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl))})
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + signed
+}
+
+func TestAuthenticatedUserId(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	request := httptest.NewRequest(http.MethodPost, "/api/enrollMFA/user1", nil)
+
+	request.Header.Set("Authorization", userToken(t, key, "user1", time.Minute))
+	if userId, err := authenticatedUserId(request, &key.PublicKey); err != nil || userId != "user1" {
+		t.Error("Valid token should authenticate its subject", err)
+	}
+	if _, err := authenticatedUserId(request, nil); err == nil {
+		t.Error("Token accepted without a configured key")
+	}
+
+	invalid := []string{"", userToken(t, other, "user1", time.Minute), userToken(t, key, "user1", -time.Minute), userToken(t, key, "", time.Minute)}
+	for _, header := range invalid {
+		request.Header.Set("Authorization", header)
+		if _, err := authenticatedUserId(request, &key.PublicKey); err == nil {
+			t.Error("Invalid token accepted:", header)
+		}
+	}
+}
+
+func TestUserEndpointsRequireUserToken(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	userTokenKey := UserTokenKey
+	UserTokenKey = &key.PublicKey
+	defer func() { UserTokenKey = userTokenKey }()
+
+	// the TOTP code of the recovery endpoints is not the only credential
+	handlers := map[string]gin.HandlerFunc{
+		"/api/enrollMFA/user1":                          EnrollMFA,
+		"/api/recoverUserAccounts/user1?state=initiate": RecoverUserAccounts,
+		"/api/recoverUserAccounts/user1?state=complete": RecoverUserAccounts,
+		"/api/cancelRecovery/user1":                     CancelRecovery,
+		"/api/getECDSAShare/user1/ETH/main":             GetECDSAKeyShare,
+		"/api/getEDDSAShare/user1/SOL/main":             GetEDDSAKeyShare,
+	}
+	for target, handler := range handlers {
+		for _, header := range []string{"", userToken(t, key, "attacker", time.Minute)} {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Params = gin.Params{{Key: "userId", Value: "user1"}}
+			c.Request = httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"code":"123456"}`))
+			c.Request.Header.Set("Authorization", header)
+
+			handler(c)
+			if recorder.Code != http.StatusUnauthorized {
+				t.Error("Request for another user should be unauthorized:", target, recorder.Code)
+			}
+		}
+	}
+}
+
+func TestMFALockout(t *testing.T) {
+	if mfaLockout(0) != MFALockout || mfaLockout(1) != 2*MFALockout || mfaLockout(20) != MFAMaxLockout {
+		t.Error("Lockout should double up to the maximum lockout")
+	}
+
+	now := time.Now().UTC()
+	locked := MFAEnrollment{UserId: "user1", Confirmed: true, LockedUntil: now.Add(time.Minute), RecordType: MFARecord}
+	userCollection, mock := newMockCollection(t, cursorResponse(locked))
+	if _, err := verifyMFACode("user1", "123456", true, userCollection); err == nil || len(mock.commands) != 1 {
+		t.Error("Code of a locked enrollment should not be checked:", err)
+	}
+
+	// concurrent attempts over the limit are rejected before the code is checked
+	exhausted := MFAEnrollment{UserId: "user1", Confirmed: true, FailedAttempts: MFAMaxAttempts + 1, RecordType: MFARecord}
+	userCollection, mock = newMockCollection(t, cursorResponse(exhausted), successResponse(bson.E{"value", exhausted}))
+	if _, err := verifyMFACode("user1", "123456", true, userCollection); err == nil || len(mock.commands) != 2 {
+		t.Error("Attempt over the limit should be rejected:", err)
+	}
+	filter := mock.command(1).Lookup("query", "lockedUntil", "$not", "$gt")
+	if filter.Type != bson.TypeDateTime {
+		t.Error("Attempts should only be counted on unlocked enrollments")
+	}
+}
+
+func TestRecordMFAFailure(t *testing.T) {
+	now := time.Now().UTC()
+	userCollection, mock := newMockCollection(t, updatedResponse(1))
+
+	if err := recordMFAFailure("user1", MFAEnrollment{FailedAttempts: MFAMaxAttempts - 1}, now, userCollection); err != nil || len(mock.commands) != 0 {
+		t.Error("Enrollment should stay unlocked below the attempt limit:", err)
+	}
+	if err := recordMFAFailure("user1", MFAEnrollment{FailedAttempts: MFAMaxAttempts, Lockouts: 1}, now, userCollection); err != nil {
+		t.Fatal(err)
+	}
+	updates, _ := mock.command(0).Lookup("updates").Array().Values()
+	lockedUntil := updates[0].Document().Lookup("u", "$set", "lockedUntil").Time()
+	if !lockedUntil.Equal(now.Add(2 * MFALockout).Truncate(time.Millisecond)) {
+		t.Error("Second lockout should double the lockout, locked until:", lockedUntil)
+	}
+}
+
+func TestUseMFATimeStepResetsAttempts(t *testing.T) {
+	userCollection, mock := newMockCollection(t, updatedResponse(1))
+	if err := useMFATimeStep("user1", 100, userCollection); err != nil {
+		t.Fatal(err)
+	}
+	updates, _ := mock.command(0).Lookup("updates").Array().Values()
+	update := updates[0].Document().Lookup("u").Document()
+	if update.Lookup("$set", "failedAttempts").Int32() != 0 || update.Lookup("$unset", "lockedUntil").Type == 0 {
+		t.Error("Accepted code should reset the failed attempts and the lockout")
+	}
+}
+
+func TestVerifyMFAReset(t *testing.T) {
+	pk, sk, _ := ed25519.GenerateKey(rand.Reader)
+	registry := OperatorRegistry{Quorum: 1, Operators: []Operator{
+		{OperatorId: "op1", Role: OperatorRoleApprover, PublicKey: hex.EncodeToString(pk)},
+		{OperatorId: "audit", Role: OperatorRoleAuditor, PublicKey: hex.EncodeToString(pk)},
+	}}
+	enrollment := MFAEnrollment{ID: primitive.NewObjectID(), UserId: "user1"}
+	signature := hex.EncodeToString(ed25519.Sign(sk, mfaResetMessage(enrollment)))
+
+	if err := verifyMFAReset(registry, enrollment, MFAResetRequest{OperatorId: "op1", Signature: signature}); err != nil {
+		t.Error(err)
+	}
+	if verifyMFAReset(registry, enrollment, MFAResetRequest{OperatorId: "audit", Signature: signature}) == nil {
+		t.Error("Reset signed by an auditor accepted")
+	}
+	reenrolled := MFAEnrollment{ID: primitive.NewObjectID(), UserId: "user1"}
+	if verifyMFAReset(registry, reenrolled, MFAResetRequest{OperatorId: "op1", Signature: signature}) == nil {
+		t.Error("Reset signature replayed on a new enrollment")
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"encoding/json"
+	"math/big"
+	"time"
 
 	ep "bitbucket.org/carsonliving/cryptographymodules/ecdsaoperations"
 
@@ -22,7 +24,8 @@ type KeyShare struct {
 	AccountName  string              `bson:"accountName"`   // accountName is the user defined nickname for a specific set of credentials
 	BlockchainId string              `bson:"blockchainId"`  // blockchainId is the symbol for a specific blockchain, this is used to link credentials from L1 to ERC20 or ERC721 tokens
 	Address      string              `bson:"address,omitempty"`
-	ShareData    ep.ECDSAParticipant `bson:"shareData"` // shareData is participant specific MPC sensitive data
+	ShareData    ep.ECDSAParticipant `bson:"shareData"`           // shareData is participant specific MPC sensitive data
+	ChainCode    string              `bson:"chainCode,omitempty"` // chainCode is the hex encoded BIP32 chain code of the root key generated at keygen, derivation needs it
 }
 
 // MessageToSigner struct for message sent from aggregator to signer
@@ -60,15 +63,188 @@ type BroadcastMessage struct {
 
 // BasicTx is structure for sending tokens from one address to another
 type BasicTx struct {
-	UserId       string `bson:"userId"`       // userId associated with account
-	BlockchainId string `bson:"blockchainId"` // blockchainId is the symbol for a specific blockchain, this is used to link credentials from L1 to ERC20 or ERC721 tokens
-	TokenId      string `bson:"tokenId"`      // tokenId is the symbol for specific asset ETH, BTC, ERC20 symbol
-	AccountName  string `bson:"accountName"`  // accountName is the user defined nickname for a specific set of credentials
-	Value        string `bson:"value"`        // value being transfered by transaction to target account
-	ToAddress    string `bson:"toAddress"`    // toAddress is recipient hex encoded address
-	FullTx       string `bson:"fullTx"`       // fullTx is the JSON stringified transaction that is submitted to target blockchain
-	TxHash       string `bson:"txHash"`       // txHash is the tx hash used to identify transaction
-	Status       string `bson:"status"`       // status tracks transaction status from generation to signing to completion
+	UserId       string    `json:"userId" bson:"userId"`                     // userId associated with account
+	BlockchainId string    `json:"blockchainId" bson:"blockchainId"`         // blockchainId is the symbol for a specific blockchain, this is used to link credentials from L1 to ERC20 or ERC721 tokens
+	TokenId      string    `json:"tokenId" bson:"tokenId"`                   // tokenId is the symbol for specific asset ETH, BTC, ERC20 symbol
+	AccountName  string    `json:"accountName" bson:"accountName"`           // accountName is the user defined nickname for a specific set of credentials
+	Value        string    `json:"value" bson:"value"`                       // value being transfered by transaction to target account
+	ToAddress    string    `json:"toAddress" bson:"toAddress"`               // toAddress is recipient hex encoded address
+	FullTx       string    `json:"fullTx" bson:"fullTx"`                     // fullTx is the JSON stringified transaction that is submitted to target blockchain
+	TxHash       string    `json:"txHash" bson:"txHash"`                     // txHash is the tx hash used to identify transaction
+	Status       string    `json:"status" bson:"status"`                     // status tracks transaction status from generation to signing to completion
+	FromAddress  string    `json:"fromAddress,omitempty" bson:"fromAddress"` // fromAddress is the sender recovered from a signed EVM transaction
+	Nonce        uint64    `json:"nonce,omitempty" bson:"nonce"`             // nonce of an EVM transaction
+	BlockNumber  uint64    `json:"blockNumber,omitempty" bson:"blockNumber"` // blockNumber the transaction was confirmed or failed in
+	CreatedAt    time.Time `json:"createdAt,omitempty" bson:"createdAt"`     // createdAt is when the transaction was recorded
+	UpdatedAt    time.Time `json:"updatedAt,omitempty" bson:"updatedAt"`     // updatedAt is when the status last changed
+}
+
+// Token is a supported asset of a blockchain network in the token registry
+type Token struct {
+	Symbol          string `json:"symbol"`                    // symbol is the tokenId used by KeyShare and BasicTx
+	ContractAddress string `json:"contractAddress,omitempty"` // contract address of ERC20/ERC721 tokens, asset id of algorand standard assets
+	Decimals        uint8  `json:"decimals"`                  // number of decimals of the smallest unit
+	Standard        string `json:"standard"`                  // token standard: native, ERC20, ERC721 or ASA
+}
+
+// TokenInfo is a token registry entry returned by the token listing api
+type TokenInfo struct {
+	BlockchainId string `json:"blockchainId"` // blockchainId the token is issued on
+	Network      string `json:"network"`      // mainnet or testnet
+	Token
+}
+
+// TokenTxRequest is the request for building the calldata of an ERC20 transfer or approve
+type TokenTxRequest struct {
+	TokenId   string `json:"tokenId"`   // tokenId is the registry symbol of the ERC20 token
+	Method    string `json:"method"`    // transfer or approve
+	ToAddress string `json:"toAddress"` // recipient of a transfer or spender of an approve
+	Amount    string `json:"amount"`    // human readable decimal amount, converted with the token decimals
+}
+
+// TokenTxPayload is the contract call the client uses to build the token transaction
+type TokenTxPayload struct {
+	To      string    `json:"to"`      // token contract address
+	Value   string    `json:"value"`   // native value sent with the call, always 0
+	Data    string    `json:"data"`    // hex encoded calldata
+	Summary TxSummary `json:"summary"` // decoded summary of the calldata for review
+}
+
+// EVMTxRequest is the request for decoding a submitted EVM transaction
+type EVMTxRequest struct {
+	FullTx string `json:"fullTx"` // fullTx is the JSON stringified transaction that is submitted to target blockchain
+}
+
+// TxSummary is a readable summary of what an EVM transaction does
+type TxSummary struct {
+	Method    string `json:"method"`              // nativeTransfer, transfer, approve, transferFrom or unknown
+	Token     string `json:"token"`               // registry symbol, or the contract address for tokens not in the registry
+	Contract  string `json:"contract,omitempty"`  // called contract address
+	Selector  string `json:"selector,omitempty"`  // 4 byte method selector of a contract call
+	From      string `json:"from,omitempty"`      // owner of the tokens of a transferFrom
+	Recipient string `json:"recipient,omitempty"` // recipient of a transfer or spender of an approve
+	Amount    string `json:"amount,omitempty"`    // human readable amount, in raw units for tokens not in the registry
+	RawAmount string `json:"rawAmount,omitempty"` // amount in the smallest token unit
+	Value     string `json:"value,omitempty"`     // native value sent with a contract call
+}
+
+// NonceReservation is an EVM nonce handed out for building a transaction of an account
+type NonceReservation struct {
+	BlockchainId string    `json:"blockchainId" bson:"blockchainId"`         // blockchainId the nonce is used on
+	Address      string    `json:"address" bson:"address"`                   // checksummed sender address
+	Nonce        uint64    `json:"nonce" bson:"nonce"`                       // reserved nonce
+	Status       string    `json:"status" bson:"status"`                     // reserved, used, released or stale
+	TxHash       string    `json:"txHash,omitempty" bson:"txHash,omitempty"` // txHash of the recorded transaction using the nonce
+	ReservedAt   time.Time `json:"reservedAt" bson:"reservedAt"`             // reservedAt is when the nonce was handed out
+	RecordType   string    `json:"-" bson:"recordType"`                      // extra field to improve searching
+}
+
+// NonceCounter is the next never reserved nonce of an account
+type NonceCounter struct {
+	BlockchainId string `bson:"blockchainId"` // blockchainId the nonce is used on
+	Address      string `bson:"address"`      // checksummed sender address
+	NextNonce    uint64 `bson:"nextNonce"`    // next nonce to hand out when no released nonce can be reused
+	RecordType   string `bson:"recordType"`   // extra field to improve searching
+}
+
+// UTXO is an unspent output of a bitcoin account
+type UTXO struct {
+	TxId        string    `json:"txId" bson:"txId"`                                   // id of the transaction creating the output
+	Vout        uint32    `json:"vout" bson:"vout"`                                   // output index in the transaction
+	Value       int64     `json:"value" bson:"value"`                                 // value in satoshis
+	Confirmed   bool      `json:"confirmed" bson:"confirmed"`                         // confirmed is true once the output is mined
+	LockedUntil time.Time `json:"lockedUntil,omitempty" bson:"lockedUntil,omitempty"` // output is reserved by a prepared transaction until this time
+}
+
+// UTXOSet is the set of unspent outputs of a bitcoin account address
+type UTXOSet struct {
+	BlockchainId string    `json:"blockchainId" bson:"blockchainId"` // blockchainId of the account
+	Address      string    `json:"address" bson:"address"`           // account address
+	UTXOs        []UTXO    `json:"utxos" bson:"utxos"`               // unspent outputs of the address
+	Version      int64     `json:"version" bson:"version"`           // version is incremented on every update to detect concurrent changes
+	UpdatedAt    time.Time `json:"updatedAt" bson:"updatedAt"`       // updatedAt is when the set was last synced from the indexer
+}
+
+// BitcoinOutput is a recipient of a bitcoin transaction
+type BitcoinOutput struct {
+	Address string `json:"address"` // recipient address
+	Value   int64  `json:"value"`   // value in satoshis
+}
+
+// BitcoinTxRequest is the request for preparing a bitcoin transaction from the account utxos
+type BitcoinTxRequest struct {
+	Outputs []BitcoinOutput `json:"outputs"` // recipients of the transaction, change is added by the service
+	FeeRate int64           `json:"feeRate"` // fee rate in satoshis per virtual byte
+}
+
+// BitcoinTxInput is a selected input with the hash signed for it in the MPC signing flow
+type BitcoinTxInput struct {
+	TxId    string `json:"txId"`    // id of the transaction creating the spent output
+	Vout    uint32 `json:"vout"`    // output index in the transaction
+	Value   int64  `json:"value"`   // value in satoshis
+	SigHash string `json:"sigHash"` // hex encoded BIP143 signature hash used as messageHash for signing
+}
+
+// BitcoinTxResponse returns a prepared unsigned bitcoin transaction
+type BitcoinTxResponse struct {
+	PSBT       string           `json:"psbt"`       // base64 encoded unsigned PSBT
+	UnsignedTx string           `json:"unsignedTx"` // hex encoded unsigned transaction
+	Inputs     []BitcoinTxInput `json:"inputs"`     // selected inputs in transaction order
+	Fee        int64            `json:"fee"`        // fee in satoshis
+	Change     int64            `json:"change"`     // change returned to the account in satoshis
+}
+
+// SignatureRequest is the request for verifying a signature against an account public key
+type SignatureRequest struct {
+	Hash      string `json:"hash"`      // hex encoded signed hash, for eddsa accounts the signed payload
+	Signature string `json:"signature"` // MPC signature JSON, hex r || s (|| v), base64 BIP-137 or hex/base64 eddsa signature
+}
+
+// SignatureVerification is the result of verifying a signature against an account public key
+type SignatureVerification struct {
+	Valid   bool   `json:"valid"`   // valid is true when the signature verifies for the account public key
+	Curve   string `json:"curve"`   // curve is secp256k1 or ed25519
+	Address string `json:"address"` // address of the account
+}
+
+// PublicKeyExport is the group public key of an account in the common public key encodings
+type PublicKeyExport struct {
+	Curve            string       `json:"curve"`                      // curve is secp256k1 or ed25519
+	DerivationPath   string       `json:"derivationPath,omitempty"`   // BIP32 path of the exported key, m for the account key
+	SEC1Compressed   string       `json:"sec1Compressed,omitempty"`   // hex encoded 33 byte SEC1 compressed point
+	SEC1Uncompressed string       `json:"sec1Uncompressed,omitempty"` // hex encoded 65 byte SEC1 uncompressed point
+	Raw              string       `json:"raw,omitempty"`              // hex encoded 32 byte ed25519 public key
+	PEM              string       `json:"pem"`                        // PEM encoded X.509 SubjectPublicKeyInfo
+	JWK              PublicKeyJWK `json:"jwk"`                        // RFC 7517 JSON web key
+	Xpub             string       `json:"xpub,omitempty"`             // BIP32 extended public key, tpub on testnet
+}
+
+// PublicKeyJWK is the JSON web key of an EC or OKP public key
+type PublicKeyJWK struct {
+	Kty string `json:"kty"`         // key type, EC or OKP
+	Crv string `json:"crv"`         // curve name
+	X   string `json:"x"`           // base64url encoded x coordinate or ed25519 public key
+	Y   string `json:"y,omitempty"` // base64url encoded y coordinate
+}
+
+// AvalancheAddresses are the addresses of an AVAX account on the C, X and P chains
+type AvalancheAddresses struct {
+	C string `json:"c"` // C chain hex address
+	X string `json:"x"` // X chain bech32 address
+	P string `json:"p"` // P chain bech32 address
+}
+
+// AvalancheTxRequest is the request for signing an Avalanche import or export transaction
+type AvalancheTxRequest struct {
+	UnsignedTx string `json:"unsignedTx"`          // hex encoded codec bytes of the unsigned transaction
+	Signature  string `json:"signature,omitempty"` // combined MPC signature over the transaction hash
+}
+
+// AvalancheTxPayload is the hash of an Avalanche transaction used as messageHash in the MPC signing flow
+type AvalancheTxPayload struct {
+	TxType      string `json:"txType"`      // import or export
+	Hash        string `json:"hash"`        // hex encoded sha256 of the unsigned transaction
+	Credentials int    `json:"credentials"` // number of credentials added when the transaction is signed
 }
 
 // ETHAccounts is a structure for returning to wallet the balances associated with a users ETH blockchain holdings
@@ -90,7 +266,9 @@ type AccountRecord struct {
 	AccountName  string             `bson:"accountName"`   // accountName is the user defined nickname for a specific set of credentials
 	BlockchainId string             `bson:"blockchainId"`  // blockchainId is the symbol for a specific blockchain, this is used to link credentials from L1 to ERC20 or ERC721 tokens
 	Address      string             `bson:"address,omitempty"`
-	RecordType   string             `bson:"recordType"` // extra field to improve searching
+	PublicKey    string             `bson:"publicKey,omitempty"` // publicKey is the group public key of the account share, ShareData.PK or the eddsa PK
+	ChainCode    string             `bson:"chainCode"`           // chainCode is the hex encoded BIP32 chain code of an ecdsa keygen, empty when derivation is not enabled
+	RecordType   string             `bson:"recordType"`          // extra field to improve searching
 }
 
 type EDDSAShare struct {
@@ -111,12 +289,262 @@ type TxInputs struct {
 	Signature  string `json:"signature"`
 }
 
+// CardanoTxRequest is the request for signing a cardano transaction body with the eddsa custody share
+type CardanoTxRequest struct {
+	TxBody    string `json:"txBody"`    // hex encoded CBOR transaction body
+	Signature string `json:"signature"` // partial eddsa signature from the client over the body hash
+}
+
+// SignedTxResponse returns a fully assembled signed transaction ready for submission
+type SignedTxResponse struct {
+	TxHash   string `json:"txHash"`   // txHash is the tx hash used to identify transaction
+	SignedTx string `json:"signedTx"` // signedTx is the encoded signed transaction
+}
+
+// AlgorandTxRequest is the request for preparing and signing an algorand transaction or atomic transfer group
+type AlgorandTxRequest struct {
+	Transactions []string `json:"transactions"`         // base64 msgpack encoded unsigned transactions
+	Signatures   []string `json:"signatures,omitempty"` // partial eddsa signatures from the client, one entry per transaction and empty when not sent by the account
+}
+
+// AlgorandTx is a prepared or signed algorand transaction
+type AlgorandTx struct {
+	TxId        string `json:"txId"`               // txId is the base32 transaction id
+	Transaction string `json:"transaction"`        // base64 msgpack encoded unsigned transaction including the group id
+	BytesToSign string `json:"bytesToSign"`        // hex encoded "TX" prefixed payload signed with eddsa
+	Signer      bool   `json:"signer"`             // signer is true when the transaction is sent by the account
+	SignedTx    string `json:"signedTx,omitempty"` // base64 msgpack encoded signed transaction
+}
+
+// AlgorandTxResponse returns the prepared or signed algorand transactions of a group
+type AlgorandTxResponse struct {
+	GroupId      string       `json:"groupId,omitempty"`     // base64 group id for atomic transfers
+	Transactions []AlgorandTx `json:"transactions"`          // transactions in group order
+	SignedGroup  string       `json:"signedGroup,omitempty"` // base64 concatenated signed transactions ready for submission
+}
+
+// SolanaInstruction is a compiled solana instruction referencing the message account keys by index
+type SolanaInstruction struct {
+	ProgramIdIndex uint8   `json:"programIdIndex"` // index of the program account key
+	Accounts       []uint8 `json:"accounts"`       // indexes of the instruction account keys
+	Data           string  `json:"data"`           // base64 encoded instruction data
+}
+
+// SolanaMessage is a legacy solana transaction message
+type SolanaMessage struct {
+	NumRequiredSignatures       uint8               `json:"numRequiredSignatures"`       // number of signer account keys at the start of accountKeys
+	NumReadonlySignedAccounts   uint8               `json:"numReadonlySignedAccounts"`   // number of read only signer account keys
+	NumReadonlyUnsignedAccounts uint8               `json:"numReadonlyUnsignedAccounts"` // number of read only non signer account keys
+	AccountKeys                 []string            `json:"accountKeys"`                 // base58 encoded account keys
+	RecentBlockhash             string              `json:"recentBlockhash"`             // base58 encoded recent blockhash
+	Instructions                []SolanaInstruction `json:"instructions"`                // compiled instructions
+}
+
+// EDDSATxRequest is the request for preparing and signing a solana or stellar transaction
+type EDDSATxRequest struct {
+	Message           *SolanaMessage `json:"message,omitempty"`           // solana legacy message to serialize
+	SerializedMessage string         `json:"serializedMessage,omitempty"` // base64 serialized solana message
+	Envelope          string         `json:"envelope,omitempty"`          // base64 XDR unsigned stellar transaction envelope
+	Network           string         `json:"network,omitempty"`           // stellar network passphrase name: public or testnet
+	Signature         string         `json:"signature,omitempty"`         // partial eddsa signature from the client over the payload
+}
+
+// EDDSATxPayload returns the payload the client signs for an eddsa transaction
+type EDDSATxPayload struct {
+	Address string `json:"address"` // address of the account derived from the eddsa public key
+	Payload string `json:"payload"` // hex encoded payload to sign
+}
+
+// DerivedAddress is the address of a non-hardened child key of an account
+type DerivedAddress struct {
+	Path    string `json:"path"`    // BIP32 derivation path of the child key
+	Address string `json:"address"` // address of the child key
+}
+
 type RecoveryRecord struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"` //mongoDB object id created when item inserted to DB
+	UserId     string             `bson:"userId"`        // userId created during registration in active directory
+	Mode       string             `bson:"mode"`          // export releases the shares, reshare refreshes them for a new device
+	Accounts   []RecoveryAccount  `bson:"accounts"`      // accounts covered by the recovery
+	Status     string             `bson:"status"`        // status of account record being recovered
+	Evidence   []RecoveryEvidence `bson:"evidence"`      // evidence backing each status transition
+	Decisions  []OperatorDecision `bson:"decisions"`     // signed operator approvals and rejections
+	VerifiedAt time.Time          `bson:"verifiedAt"`    // time the customer was verified
+	UnlockAt   time.Time          `bson:"unlockAt"`      // time the shares are released, verifiedAt plus the time lock
+	CreatedAt  time.Time          `bson:"createdAt"`     // time the recovery was initiated
+	UpdatedAt  time.Time          `bson:"updatedAt"`     // time of the last transition or decision
+	ExpiresAt  time.Time          `bson:"expiresAt"`     // ongoing recoveries are expired after this time
+	Ongoing    bool               `bson:"ongoing"`       // set until the recovery ends, a unique index keeps one ongoing recovery per user
+	DeviceKey  string             `bson:"deviceKey"`     // hex key of the new device, exported shares and reshare sub-shares are sealed to it
+	RecordType string             `bson:"recordType"`    // extra field to improve searching
+}
+
+// SealedShare is a released key share encrypted to the client ephemeral public key
+type SealedShare struct {
+	Scheme     string `json:"scheme"`         // ecies-secp256k1 or hpke-x25519
+	Enc        string `json:"enc,omitempty"`  // hex encoded HPKE encapsulated key
+	Info       string `json:"info,omitempty"` // HPKE info used in the key schedule
+	Ciphertext string `json:"ciphertext"`     // base64 encoded sealed share JSON
+}
+
+// RecoveryStatus is the status of the recovery record of a user
+type RecoveryStatus struct {
+	Message   string             `json:"message"`             // status of the recovery record
+	Mode      string             `json:"mode,omitempty"`      // export or reshare
+	RecordId  string             `json:"recordId,omitempty"`  // id of the recovery record signed by operators
+	DeviceKey string             `json:"deviceKey,omitempty"` // key of the new device approved with the recovery
+	Accounts  []RecoveryAccount  `json:"accounts"`            // accounts covered by the recovery and their release status
+	Decisions []OperatorDecision `json:"decisions,omitempty"` // operator approvals and rejections
+	UnlockAt  *time.Time         `json:"unlockAt,omitempty"`  // time the shares become available once the customer is verified
+	CreatedAt *time.Time         `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time         `json:"updatedAt,omitempty"`
+	ExpiresAt *time.Time         `json:"expiresAt,omitempty"` // time an ongoing recovery expires
+}
+
+// Operator is a person allowed to approve recoveries, decisions are signed with the operator's ed25519 key
+type Operator struct {
+	OperatorId string `json:"operatorId"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`      // recoveryApprover or auditor
+	PublicKey  string `json:"publicKey"` // hex or base64 encoded ed25519 public key
+}
+
+// OperatorRegistry lists the recovery operators and the number of approvals a recovery needs
+type OperatorRegistry struct {
+	Quorum    int        `json:"quorum"`
+	Operators []Operator `json:"operators"`
+}
+
+// OperatorDecision is an approval or rejection of a recovery record by an operator
+type OperatorDecision struct {
+	OperatorId string    `bson:"operatorId" json:"operatorId"`
+	Role       string    `bson:"role" json:"role"`
+	Decision   string    `bson:"decision" json:"decision"`   // approve or reject
+	Signature  string    `bson:"signature" json:"signature"` // operator signature over the decision message
+	DecidedAt  time.Time `bson:"decidedAt" json:"decidedAt"`
+}
+
+// RecoveryDecisionRequest is the signed decision of an operator on a recovery record
+type RecoveryDecisionRequest struct {
+	OperatorId string `json:"operatorId"`
+	Decision   string `json:"decision"`  // approve or reject
+	Signature  string `json:"signature"` // hex or base64 ed25519 signature of the decision message
+}
+
+// RecoveryAccount is an account named in a recovery request and its release status
+type RecoveryAccount struct {
+	BlockchainId string     `bson:"blockchainId" json:"blockchainId"`
+	AccountName  string     `bson:"accountName" json:"accountName"`
+	Address      string     `bson:"address,omitempty" json:"address,omitempty"`
+	Status       string     `bson:"status" json:"status"`                             // pending until the share is released
+	ReleasedAt   *time.Time `bson:"releasedAt,omitempty" json:"releasedAt,omitempty"` // time the share was first released
+}
+
+// RecoveryRequest names the accounts a recovery covers
+type RecoveryRequest struct {
+	Mode      string            `json:"mode,omitempty"`      // export by default, or reshare to re-provision a new device
+	DeviceKey string            `json:"deviceKey,omitempty"` // hex secp256k1 key of the new device, an X25519 key is also accepted for export
+	Accounts  []RecoveryAccount `json:"accounts"`
+}
+
+// ReshareSession is the re-sharing of an account share for a new device, the secrets are encrypted with the KMS key
+type ReshareSession struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty"` //mongoDB object id created when item inserted to DB
+	UserId            string             `bson:"userId"`
+	BlockchainId      string             `bson:"blockchainId"`
+	AccountName       string             `bson:"accountName"`
+	RecoveryId        primitive.ObjectID `bson:"recoveryId"`        // recovery record the re-sharing belongs to
+	Identifier        uint32             `bson:"identifier"`        // participant identifier of this service
+	SessionKey        string             `bson:"sessionKey"`        // hex compressed secp256k1 key the other dealer seals to
+	DeviceKey         string             `bson:"deviceKey"`         // key of the new device approved with the recovery record
+	Commitments       map[string]string  `bson:"commitments"`       // JSON commitments of each dealer by participant identifier
+	PubShares         map[string]string  `bson:"pubShares"`         // refreshed public shares once every dealing is in
+	PreviousPubShares map[string]string  `bson:"previousPubShares"` // public shares replaced by the refreshed ones, kept for a rollback
+	RollbackUntil     time.Time          `bson:"rollbackUntil"`     // end of the rollback window of a finalized session
+	Secrets           []string           `bson:"secrets"`           // KMS encrypted ReshareSecrets, dropped once the rollback window ends
+	Status            string             `bson:"status"`            // started, dealt, refreshed, committed, complete or rolledBack
+	CreatedAt         time.Time          `bson:"createdAt"`
+	UpdatedAt         time.Time          `bson:"updatedAt"`
+}
+
+// ReshareSecrets are the secret values of a re-sharing session
+type ReshareSecrets struct {
+	SessionKey    string              `json:"sessionKey"`              // hex session private key
+	SubShares     map[string]*big.Int `json:"subShares"`               // sub-shares received by dealer identifier
+	Share         string              `json:"share,omitempty"`         // refreshed ECDSAShareValue JSON
+	PreviousShare string              `json:"previousShare,omitempty"` // replaced ECDSAShareValue JSON, kept for a rollback
+}
+
+// ReshareSessionState is the state of a re-sharing session signed with the pinned key of the service
+type ReshareSessionState struct {
+	RecordId   string            `json:"recordId"`            // recovery record the re-sharing belongs to
+	Identifier uint32            `json:"identifier"`          // participant identifier of the service
+	SessionKey string            `json:"sessionKey"`          // hex compressed secp256k1 key to seal sub-shares to
+	Status     string            `json:"status"`              // status of the session
+	PubShares  map[string]string `json:"pubShares,omitempty"` // refreshed public shares once every dealing is in
+	Signature  string            `json:"signature"`           // hex ed25519 signature of the session state message
+}
+
+// ResharePeer is another re-sharing service, its session states and dealings are signed with its pinned key
+type ResharePeer struct {
+	Identifier uint32 `json:"identifier"` // participant identifier of the service
+	URL        string `json:"url"`        // base url of the service
+	PublicKey  string `json:"publicKey"`  // hex or base64 encoded ed25519 public key
+}
+
+// ReshareDealing is the dealing of one re-sharing service
+type ReshareDealing struct {
+	DealerId    uint32                 `json:"dealerId"`
+	RecordId    string                 `json:"recordId"`    // recovery record the dealing belongs to
+	SessionKey  string                 `json:"sessionKey"`  // session key of the other dealer the sub-share is sealed to
+	Commitments []ECDSAPoint           `json:"commitments"` // Feldman commitments of the polynomial coefficients
+	SubShares   map[string]SealedShare `json:"subShares"`   // sub-shares sealed to each other participant by identifier
+	Signature   string                 `json:"signature"`   // hex ed25519 signature of the dealer over the dealing message
+}
+
+// ReshareCompleteRequest is the public share of the refreshed share of the new device signed with the device key
+type ReshareCompleteRequest struct {
+	PublicShare ECDSAPoint `json:"publicShare"`
+	Signature   string     `json:"signature"` // hex 65 byte secp256k1 signature of the keccak256 hash of the commit message
+}
+
+// RecoveryEvidence is the verification that allowed a recovery record to move to a status
+type RecoveryEvidence struct {
+	Status     string    `bson:"status"`             // status reached with this evidence
+	Method     string    `bson:"method"`             // verification method e.g. totp
+	TimeStep   int64     `bson:"timeStep,omitempty"` // TOTP time step of the accepted code
+	VerifiedAt time.Time `bson:"verifiedAt"`         // time the evidence was verified
+}
+
+// MFAEnrollment is the TOTP enrollment of a user, the secret is encrypted with the KMS key
+type MFAEnrollment struct {
 	ID             primitive.ObjectID `bson:"_id,omitempty"`  //mongoDB object id created when item inserted to DB
 	UserId         string             `bson:"userId"`         // userId created during registration in active directory
-	AccountRecords []AccountRecord    `bson:"accountRecords"` // accountrecord that needs to be processed
-	Status         string             `bson:"status"`         // status of account record being recovered
-	RecordType     string             `bson:"recordType"`     // extra field to improve searching
+	Secret         []string           `bson:"secret"`         // KMS encrypted TOTP secret
+	Confirmed      bool               `bson:"confirmed"`      // confirmed is set once the first code was verified
+	LastTimeStep   int64              `bson:"lastTimeStep"`   // last accepted time step, codes are not accepted twice
+	FailedAttempts int                `bson:"failedAttempts"` // attempts since the last accepted code or lockout
+	Lockouts       int                `bson:"lockouts"`       // lockouts since the last accepted code, each one doubles the lockout
+	LockedUntil    time.Time          `bson:"lockedUntil"`    // no code is checked before this time
+	CreatedAt      time.Time          `bson:"createdAt"`
+	RecordType     string             `bson:"recordType"` // extra field to improve searching
+}
+
+// MFAEnrollmentResponse is the TOTP secret returned once during enrollment
+type MFAEnrollmentResponse struct {
+	Secret string `json:"secret"` // base32 encoded TOTP secret
+	URI    string `json:"uri"`    // otpauth URI for authenticator apps
+}
+
+// MFARequest carries a TOTP code from the user's authenticator app
+type MFARequest struct {
+	Code string `json:"code"`
+}
+
+// MFAResetRequest is the operator approval to remove the enrollment of a user who lost the authenticator
+type MFAResetRequest struct {
+	OperatorId string `json:"operatorId"`
+	Signature  string `json:"signature"` // hex or base64 ed25519 signature of the reset message
 }
 
 type SuccessDetails struct {
@@ -124,11 +552,46 @@ type SuccessDetails struct {
 }
 
 type PaillierKey struct {
-	UniqueId        string `bson:"uniqueId"`
-	UserId          string `bson:"userId"`
-	PaillierKeyData string `bson:"paillierKeyData"`
-	KeyNumber       int    `bson:"keyNumber"`
-	Error           string `bson:"error"`
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"-"` //mongoDB object id created when item inserted to DB
+	UniqueId        string             `bson:"uniqueId"`
+	UserId          string             `bson:"userId"`
+	PaillierKeyData string             `bson:"paillierKeyData"`                 // plaintext key, only set once decrypted for hand out
+	EncryptedKey    []string           `bson:"encryptedKey,omitempty" json:"-"` // KMS encrypted PaillierKeyData
+	KeyNumber       int                `bson:"keyNumber"`
+	Error           string             `bson:"error"`
+	Status          string             `bson:"status,omitempty"`    // available or claimed for pool keys
+	ClaimId         string             `bson:"claimId,omitempty"`   // claim that reserved a pool key
+	ClaimedBy       string             `bson:"claimedBy,omitempty"` // userId a pool key was reserved for
+	ClaimedAt       time.Time          `bson:"claimedAt,omitempty"`
+}
+
+// PaillierKeyClaim is the audit record of a pool key handed out to a user
+type PaillierKeyClaim struct {
+	ClaimId   string    `bson:"claimId" json:"claimId"`
+	KeyId     string    `bson:"keyId" json:"keyId"` // uniqueId of the pool key
+	UserId    string    `bson:"userId" json:"userId"`
+	ClaimedAt time.Time `bson:"claimedAt" json:"claimedAt"`
+}
+
+// PaillierKeyClaimResponse returns the keys of a claim once
+type PaillierKeyClaimResponse struct {
+	ClaimId string        `json:"claimId"`
+	Keys    []PaillierKey `json:"keys"`
+}
+
+// PaillierPoolStatus is the depth of the Paillier key pool and the generator status of a replica
+type PaillierPoolStatus struct {
+	Depth          int64      `json:"depth"`          // unclaimed keys in the pool
+	Target         int        `json:"target"`         // pool size a refill stops at
+	LowWater       int        `json:"lowWater"`       // pool size a refill starts below
+	Workers        int        `json:"workers"`        // concurrent key generation workers
+	Leader         bool       `json:"leader"`         // this replica holds the generator lease
+	Refilling      bool       `json:"refilling"`      // a refill is in progress
+	Generated      int64      `json:"generated"`      // keys generated by this replica since start
+	GenerationRate float64    `json:"generationRate"` // keys per minute generated by this replica over the last 10 minutes
+	Failures       int        `json:"failures"`       // consecutive generation or DB failures
+	LastError      string     `json:"lastError,omitempty"`
+	RetryAt        *time.Time `json:"retryAt,omitempty"` // end of the backoff after a failure
 }
 
 type ApiError struct {
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
@@ -72,6 +73,23 @@ func CloseClientDB(client *mongo.Client) {
 	log.Debug("Connection to MongoDB closed.")
 }
 
+// createIndexes creates the unique indexes the atomic updates of the service rely on, the service
+// does not start without them
+func createIndexes() {
+	var DB *mongo.Client = ConnectDB()
+	defer CloseClientDB(DB)
+
+	err := createNonceIndexes(DB.Database(MongoDatabase).Collection("NonceCollection"))
+	if err != nil {
+		log.Fatal("Error creating indexes err:", err)
+	}
+
+	err = createRecoveryIndexes(DB.Database(MongoDatabase).Collection("UserCollection"))
+	if err != nil {
+		log.Fatal("Error creating indexes err:", err)
+	}
+}
+
 // writeShare write a keyShare to mongoDB from a trusted MPC dealer
 func writeECDSAShare(dataEntry KeyShare, keyShareCollection *mongo.Collection) error {
 	keyvaultindex := dataEntry.UserId + "-" + dataEntry.BlockchainId + "-" + dataEntry.AccountName // TODO: need to salt hash to create a more obfuscated index
@@ -129,7 +147,7 @@ func updateECDSAShare(dataEntry KeyShare, keyShareCollection *mongo.Collection)
 		return err
 	}
 
-	log.Info("Update KeyShare:", dataEntry)
+	log.Info("Update KeyShare:", keyvaultindex)
 
 	return nil
 }
@@ -187,7 +205,7 @@ func updateEDDSAShare(dataEntry EDDSAShare, keyShareCollection *mongo.Collection
 		return err
 	}
 
-	log.Info("Update KeyShare:", dataEntry)
+	log.Info("Update KeyShare:", keyvaultindex)
 
 	return nil
 }
@@ -257,6 +275,36 @@ func createAccountRecord(userId, blockchainId, accountName, address string, todo
 	return nil
 }
 
+// updateAccountAddress updates the address saved in an account record
+func updateAccountAddress(userId, blockchainId, accountName, address string, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"recordType": "AccountData", "userId": userId, "blockchainId": blockchainId, "accountName": accountName}
+	update := bson.M{"$set": bson.M{"address": address}}
+
+	_, err := todoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to update account address ", err)
+		return err
+	}
+
+	return nil
+}
+
+// updateAccountPublicKey saves the group public key and chain code of the account share in the account record
+func updateAccountPublicKey(userId, blockchainId, accountName, publicKey, chainCode string, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"recordType": "AccountData", "userId": userId, "blockchainId": blockchainId, "accountName": accountName}
+	update := bson.M{"$set": bson.M{"publicKey": publicKey, "chainCode": chainCode}}
+
+	_, err := todoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to update account public key ", err)
+		return err
+	}
+
+	return nil
+}
+
 // readAccount retrieve account record
 func readAccount(userId, blockchainId, accountName string, todoCollection *mongo.Collection) (AccountRecord, error) {
 	var res AccountRecord
@@ -296,6 +344,28 @@ func readAccountRecords(userId, blockchainId string, todoCollection *mongo.Colle
 	return res, nil
 }
 
+// readAccountsWithoutPublicKey returns the account records created before the public key and chain code were saved on them
+func readAccountsWithoutPublicKey(todoCollection *mongo.Collection) ([]AccountRecord, error) {
+	var res []AccountRecord
+	filter := bson.M{"recordType": "AccountData", "$or": bson.A{
+		bson.M{"publicKey": bson.M{"$exists": false}}, bson.M{"publicKey": ""}, bson.M{"chainCode": bson.M{"$exists": false}}}}
+
+	ctx := context.Background()
+	listRes, err := todoCollection.Find(ctx, filter)
+	if err != nil {
+		log.Error("Error reading account records from db err:", err)
+		return res, fmt.Errorf("Error reading account records from db err: %s", err)
+	}
+	defer listRes.Close(ctx)
+
+	if err = listRes.All(ctx, &res); err != nil {
+		log.Error(err)
+		return res, fmt.Errorf("Error reading account records from db err: %s", err)
+	}
+
+	return res, nil
+}
+
 // deleteAccount deletes an account entry
 func deleteAccount(userId, blockchainId, accountName string, todoCollection *mongo.Collection) error {
 	ctx := context.Background()
@@ -458,7 +528,7 @@ func readTx(txHash string, todoCollection *mongo.Collection) (BasicTx, error) {
 	ctx := context.Background()
 	err := todoCollection.FindOne(ctx, filter).Decode(&res)
 	if err != nil {
-		return res, fmt.Errorf("failed to find tx with messageHAsh:%s, err: %v", txHash, err)
+		return res, fmt.Errorf("failed to find tx with messageHAsh:%s, err: %w", txHash, err)
 	}
 
 	return res, nil
@@ -483,23 +553,273 @@ func updateTx(txHash string, tx BasicTx, todoCollection *mongo.Collection) error
 	return nil
 }
 
-// createRecoveryRecord saves record of users recovery flow
-func createRecoveryRecord(userId string, todoCollection *mongo.Collection) error {
+// readUserTxs returns the transactions of a user, optionally filtered by status
+func readUserTxs(userId, status string, todoCollection *mongo.Collection) ([]BasicTx, error) {
+	res := []BasicTx{}
+	filter := bson.M{"userId": userId}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	ctx := context.Background()
+	listRes, err := todoCollection.Find(ctx, filter)
+	if err != nil {
+		log.Error("Error reading txs from db err:", err)
+		return res, fmt.Errorf("Error reading txs from db err: %s", err)
+	}
+	defer listRes.Close(ctx)
+
+	if err = listRes.All(ctx, &res); err != nil {
+		log.Error(err)
+		return res, fmt.Errorf("Error reading txs from db err: %s", err)
+	}
+
+	return res, nil
+}
+
+// readTxsByStatus returns the transactions of every user in a status
+func readTxsByStatus(status string, todoCollection *mongo.Collection) ([]BasicTx, error) {
+	var res []BasicTx
+	filter := bson.M{"status": status}
+
+	ctx := context.Background()
+	listRes, err := todoCollection.Find(ctx, filter)
+	if err != nil {
+		log.Error("Error reading txs from db err:", err)
+		return res, fmt.Errorf("Error reading txs from db err: %s", err)
+	}
+	defer listRes.Close(ctx)
+
+	if err = listRes.All(ctx, &res); err != nil {
+		log.Error(err)
+		return res, fmt.Errorf("Error reading txs from db err: %s", err)
+	}
+
+	return res, nil
+}
+
+// createNonceIndexes creates the unique indexes that keep one counter per account and one
+// reservation per nonce when reservations of the same account run concurrently
+func createNonceIndexes(todoCollection *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{"recordType", 1}, {"blockchainId", 1}, {"address", 1}},
+			Options: options.Index().SetName("uniqueNonceCounter").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"recordType": NonceCounterRecord}),
+		},
+		{
+			Keys: bson.D{{"blockchainId", 1}, {"address", 1}, {"nonce", 1}},
+			Options: options.Index().SetName("uniqueNonceReservation").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"recordType": NonceReservationRecord}),
+		},
+	}
+
+	ctx := context.Background()
+	_, err := todoCollection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		log.Error("failed to create nonce indexes ", err)
+		return err
+	}
+	return nil
+}
+
+// writeNonceReservation saves a newly reserved nonce
+func writeNonceReservation(reservation NonceReservation, todoCollection *mongo.Collection) error {
+	reservation.RecordType = NonceReservationRecord
+	ctx := context.Background()
+	_, err := todoCollection.InsertOne(ctx, reservation)
+	if err != nil {
+		log.Error("failed to add nonce reservation ", err)
+		return err
+	}
+	return nil
+}
+
+// readNonceReservation returns the reservation of a nonce
+func readNonceReservation(blockchainId, address string, nonce uint64, todoCollection *mongo.Collection) (NonceReservation, error) {
+	var res NonceReservation
+	filter := bson.M{"recordType": NonceReservationRecord, "blockchainId": blockchainId, "address": address, "nonce": nonce}
+
+	ctx := context.Background()
+	err := todoCollection.FindOne(ctx, filter).Decode(&res)
+	return res, err
+}
+
+// readOpenNonceReservations returns the reserved and released nonces of an account
+func readOpenNonceReservations(blockchainId, address string, todoCollection *mongo.Collection) ([]NonceReservation, error) {
+	var res []NonceReservation
+	filter := bson.M{"recordType": NonceReservationRecord, "blockchainId": blockchainId, "address": address,
+		"status": bson.M{"$in": []string{NonceReserved, NonceReleased}}}
+
+	ctx := context.Background()
+	listRes, err := todoCollection.Find(ctx, filter)
+	if err != nil {
+		log.Error("Error reading nonce reservations from db err:", err)
+		return res, fmt.Errorf("Error reading nonce reservations from db err: %s", err)
+	}
+	defer listRes.Close(ctx)
+
+	if err = listRes.All(ctx, &res); err != nil {
+		log.Error(err)
+		return res, fmt.Errorf("Error reading nonce reservations from db err: %s", err)
+	}
+
+	return res, nil
+}
+
+// updateNonceReservation moves a nonce reservation in one of the from statuses to a new status,
+// it returns mongo.ErrNoDocuments when no reservation was in a from status
+func updateNonceReservation(blockchainId, address string, nonce uint64, fromStatuses []string, status, txHash string, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"recordType": NonceReservationRecord, "blockchainId": blockchainId, "address": address, "nonce": nonce,
+		"status": bson.M{"$in": fromStatuses}}
+	set := bson.M{"status": status}
+	if txHash != "" {
+		set["txHash"] = txHash
+	}
+
+	res, err := todoCollection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		log.Error("failed to update nonce reservation ", err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// claimReleasedNonce atomically reserves the lowest released nonce that is not yet used on chain
+func claimReleasedNonce(blockchainId, address string, pendingNonce uint64, todoCollection *mongo.Collection) (NonceReservation, error) {
+	var res NonceReservation
+	filter := bson.M{"recordType": NonceReservationRecord, "blockchainId": blockchainId, "address": address,
+		"status": NonceReleased, "nonce": bson.M{"$gte": pendingNonce}}
+	update := bson.M{"$set": bson.M{"status": NonceReserved, "reservedAt": time.Now().UTC()}}
+	opts := options.FindOneAndUpdate().SetSort(bson.M{"nonce": 1}).SetReturnDocument(options.After)
+
+	ctx := context.Background()
+	err := todoCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&res)
+	return res, err
+}
+
+// raiseNonceCounter makes sure the next nonce handed out for an account is at least nonce
+func raiseNonceCounter(blockchainId, address string, nonce uint64, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"recordType": NonceCounterRecord, "blockchainId": blockchainId, "address": address}
+	update := bson.M{"$max": bson.M{"nextNonce": nonce}}
+
+	_, err := todoCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// a concurrent upsert created the counter first, the update now matches it
+		_, err = todoCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	}
+	if err != nil {
+		log.Error("failed to update nonce counter ", err)
+		return err
+	}
+	return nil
+}
+
+// incrementNonceCounter atomically hands out the next nonce of an account, never below the pending nonce
+func incrementNonceCounter(blockchainId, address string, pendingNonce uint64, todoCollection *mongo.Collection) (uint64, error) {
+	err := raiseNonceCounter(blockchainId, address, pendingNonce, todoCollection)
+	if err != nil {
+		return 0, err
+	}
+
+	var counter NonceCounter
+	filter := bson.M{"recordType": NonceCounterRecord, "blockchainId": blockchainId, "address": address}
+	update := bson.M{"$inc": bson.M{"nextNonce": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	ctx := context.Background()
+	err = todoCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&counter)
+	if err != nil {
+		log.Error("failed to increment nonce counter ", err)
+		return 0, err
+	}
+	return counter.NextNonce, nil
+}
+
+// readUTXOSet returns the stored unspent outputs of an address
+func readUTXOSet(blockchainId, address string, todoCollection *mongo.Collection) (UTXOSet, error) {
+	var res UTXOSet
+	filter := bson.M{"blockchainId": blockchainId, "address": address}
+
+	ctx := context.Background()
+	err := todoCollection.FindOne(ctx, filter).Decode(&res)
+	return res, err
+}
+
+// writeUTXOSet saves the unspent outputs of an address, replacing the previous set
+func writeUTXOSet(utxoSet UTXOSet, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"blockchainId": utxoSet.BlockchainId, "address": utxoSet.Address}
+
+	_, err := todoCollection.ReplaceOne(ctx, filter, utxoSet, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Error("failed to save utxo set ", err)
+		return err
+	}
+	return nil
+}
+
+// updateUTXOSet saves updated outputs of an address if the set is still at the read version
+func updateUTXOSet(blockchainId, address string, version int64, utxos []UTXO, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"blockchainId": blockchainId, "address": address, "version": version}
+	update := bson.M{"$set": bson.M{"utxos": utxos}, "$inc": bson.M{"version": 1}}
+
+	res, err := todoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to update utxo set ", err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("utxo set of %s changed concurrently, retry", address)
+	}
+	return nil
+}
+
+// createRecoveryRecord saves record of users recovery flow for the named accounts, a new recovery
+// can start once the previous one has ended
+func createRecoveryRecord(userId, mode, deviceKey string, accounts []RecoveryAccount, todoCollection *mongo.Collection) error {
 	_, noDocs := readRecoveryRecord(userId, todoCollection)
 	if noDocs == mongo.ErrNoDocuments {
-		var accountRecords []AccountRecord
-		for _, blockchainId := range BlockchainIds {
-			accountRecord, err := readAccountRecords(userId, blockchainId, todoCollection)
+		var recoveryAccounts []RecoveryAccount
+		for _, account := range accounts {
+			accountRecord, err := readAccount(userId, account.BlockchainId, account.AccountName, todoCollection)
 			if err != nil {
 				log.Error("Error reading account record err:", err)
-				return fmt.Errorf("Error checking for previous recovery record: %s", err)
+				return fmt.Errorf("Error reading account %s %s: %s", account.BlockchainId, account.AccountName, err)
 			}
-			accountRecords = append(accountRecords, accountRecord...)
+			recoveryAccounts = append(recoveryAccounts, RecoveryAccount{
+				BlockchainId: accountRecord.BlockchainId,
+				AccountName:  accountRecord.AccountName,
+				Address:      accountRecord.Address,
+				Status:       RecoveryAccountPending,
+			})
 		}
 
 		ctx := context.Background()
-
-		_, err := todoCollection.InsertOne(ctx, RecoveryRecord{UserId: userId, AccountRecords: accountRecords, Status: Initiated, RecordType: Recovery})
+		now := time.Now().UTC()
+
+		_, err := todoCollection.InsertOne(ctx, RecoveryRecord{
+			UserId:     userId,
+			Mode:       mode,
+			Accounts:   recoveryAccounts,
+			Status:     Initiated,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			ExpiresAt:  now.Add(RecoveryExpiry),
+			Ongoing:    true,
+			DeviceKey:  deviceKey,
+			RecordType: Recovery,
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			// a concurrent request started a recovery after the ongoing record was read
+			return fmt.Errorf("Recovery process already started")
+		}
 		if err != nil {
 			log.Error("Failed to add recovery record to db:", err)
 			return err
@@ -510,25 +830,159 @@ func createRecoveryRecord(userId string, todoCollection *mongo.Collection) error
 	return fmt.Errorf("Recovery process already started")
 }
 
-// updateRecoveryRecord saves updated recovery record
-func updateRecoveryRecord(userId, status string, todoCollection *mongo.Collection) error {
+// createRecoveryIndexes marks the ongoing recovery records written before the ongoing flag and creates the
+// unique index that keeps concurrent requests from starting two recoveries of a user
+func createRecoveryIndexes(todoCollection *mongo.Collection) error {
 	ctx := context.Background()
-	filter := bson.M{"recordType": Recovery, "userId": userId}
-	update := bson.M{"$set": bson.M{"status": status}}
+	filter := bson.M{"recordType": Recovery, "status": bson.M{"$nin": RecoveryEnded}, "ongoing": bson.M{"$exists": false}}
+	_, err := todoCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"ongoing": true}})
+	if err != nil {
+		log.Error("failed to mark ongoing recovery records ", err)
+		return err
+	}
+
+	index := mongo.IndexModel{
+		Keys: bson.D{{"userId", 1}},
+		Options: options.Index().SetName("uniqueOngoingRecovery").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"recordType": Recovery, "ongoing": true}),
+	}
+	_, err = todoCollection.Indexes().CreateOne(ctx, index)
+	if err != nil {
+		log.Error("failed to create recovery index ", err)
+		return err
+	}
+	return nil
+}
+
+// markRecoveryAccount records the release or re-provisioning of the share of an account covered by a recovery,
+// only a pending account matches so a share is handed out once
+func markRecoveryAccount(recordId primitive.ObjectID, blockchainId, accountName, status string, now time.Time, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"_id": recordId, "accounts": bson.M{"$elemMatch": bson.M{"blockchainId": blockchainId, "accountName": accountName, "status": RecoveryAccountPending}}}
+	update := bson.M{"$set": bson.M{"accounts.$.status": status, "accounts.$.releasedAt": now, "updatedAt": now}}
+
+	res, err := todoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to update recovery account ", err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		// a concurrent request released the share first
+		return fmt.Errorf("Share of account %s %s was already released", blockchainId, accountName)
+	}
+
+	return nil
+}
+
+// resetRecoveryAccount returns a re-provisioned account of a recovery to pending once its re-sharing was rolled back
+func resetRecoveryAccount(recordId primitive.ObjectID, blockchainId, accountName string, now time.Time, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"_id": recordId, "accounts": bson.M{"$elemMatch": bson.M{"blockchainId": blockchainId, "accountName": accountName, "status": RecoveryAccountReprovisioned}}}
+	update := bson.M{"$set": bson.M{"accounts.$.status": RecoveryAccountPending, "updatedAt": now}, "$unset": bson.M{"accounts.$.releasedAt": ""}}
 
 	_, err := todoCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		log.Error("failed to update todo ", err)
+		log.Error("failed to reset recovery account ", err)
+		return err
+	}
+
+	return nil
+}
+
+// advanceRecoveryRecord moves a recovery record from one status to the next and stores the evidence,
+// the status filter makes concurrent transitions fail instead of skipping a step. Every transition
+// extends the expiry, a verified customer has until the end of the time lock plus the expiry
+func advanceRecoveryRecord(userId, from, to string, evidence RecoveryEvidence, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"recordType": Recovery, "userId": userId, "status": from}
+	set := bson.M{"status": to, "updatedAt": evidence.VerifiedAt, "expiresAt": evidence.VerifiedAt.Add(RecoveryExpiry)}
+	if to == CustomerVerified {
+		// a rejection stored concurrently with the last approval keeps the record from being verified
+		filter["decisions.decision"] = bson.M{"$ne": DecisionReject}
+		// the time lock starts when the customer is verified
+		set["verifiedAt"] = evidence.VerifiedAt
+		set["unlockAt"] = evidence.VerifiedAt.Add(RecoveryTimeLock)
+		set["expiresAt"] = evidence.VerifiedAt.Add(RecoveryTimeLock + RecoveryExpiry)
+	}
+	update := bson.M{"$set": set, "$push": bson.M{"evidence": evidence}}
+	if recoveryEnded(to) {
+		update["$unset"] = bson.M{"ongoing": ""}
+	}
+
+	res, err := todoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to update recovery record ", err)
 		return err
 	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("Error updating recovery record: wrong status")
+	}
 
 	return nil
 }
 
-// readRecoveryRecord retrieve record of users recovery flow
+// endRecoveryRecord moves the ongoing recovery record of a user to a final status
+func endRecoveryRecord(userId, status string, evidence RecoveryEvidence, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"recordType": Recovery, "userId": userId, "status": bson.M{"$nin": RecoveryEnded}}
+	update := bson.M{"$set": bson.M{"status": status, "updatedAt": evidence.VerifiedAt}, "$unset": bson.M{"ongoing": ""}, "$push": bson.M{"evidence": evidence}}
+
+	res, err := todoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to update recovery record ", err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("Recovery not initiated")
+	}
+
+	return nil
+}
+
+// expireRecoveryRecords moves ongoing recoveries past their expiry to expired, records written before
+// expiry was tracked have no expiresAt and are expired as well
+func expireRecoveryRecords(now time.Time, todoCollection *mongo.Collection) (int64, error) {
+	ctx := context.Background()
+	filter := bson.M{
+		"recordType": Recovery,
+		"status":     bson.M{"$nin": RecoveryEnded},
+		"$or":        bson.A{bson.M{"expiresAt": bson.M{"$lt": now}}, bson.M{"expiresAt": bson.M{"$exists": false}}},
+	}
+	evidence := RecoveryEvidence{Status: Expired, Method: EvidenceExpiry, VerifiedAt: now}
+	update := bson.M{"$set": bson.M{"status": Expired, "updatedAt": now}, "$unset": bson.M{"ongoing": ""}, "$push": bson.M{"evidence": evidence}}
+
+	res, err := todoCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to expire recovery records ", err)
+		return 0, err
+	}
+
+	return res.ModifiedCount, nil
+}
+
+// addRecoveryDecision stores an operator decision on a recovery awaiting approval, an operator
+// that already decided matches nothing so each operator is counted once
+func addRecoveryDecision(userId string, decision OperatorDecision, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"recordType": Recovery, "userId": userId, "status": MFAVerified, "decisions.operatorId": bson.M{"$ne": decision.OperatorId}}
+	update := bson.M{"$push": bson.M{"decisions": decision}, "$set": bson.M{"updatedAt": decision.DecidedAt}}
+
+	res, err := todoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to update recovery record ", err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("operator %s already decided or recovery is not awaiting approval", decision.OperatorId)
+	}
+
+	return nil
+}
+
+// readRecoveryRecord retrieve the ongoing record of users recovery flow
 func readRecoveryRecord(userId string, todoCollection *mongo.Collection) (RecoveryRecord, error) {
 	var res RecoveryRecord
-	filter := bson.M{"recordType": Recovery, "userId": userId}
+	filter := bson.M{"recordType": Recovery, "userId": userId, "status": bson.M{"$nin": RecoveryEnded}}
 
 	ctx := context.Background()
 	err := todoCollection.FindOne(ctx, filter).Decode(&res)
@@ -542,13 +996,13 @@ func readRecoveryRecord(userId string, todoCollection *mongo.Collection) (Recove
 	return res, nil
 }
 
-// readRecoveryRecords retrieve all records of recovery
-func readRecoveryRecords(userId, blockchainId string, todoCollection *mongo.Collection) ([]RecoveryRecord, error) {
+// readRecoveryRecords retrieve all records of recovery, newest first
+func readRecoveryRecords(userId string, todoCollection *mongo.Collection) ([]RecoveryRecord, error) {
 	var res []RecoveryRecord
 	filter := bson.M{"recordType": Recovery, "userId": userId}
 
 	ctx := context.Background()
-	listRes, err := todoCollection.Find(ctx, filter)
+	listRes, err := todoCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{"createdAt", -1}, {"_id", -1}}))
 	if err != nil {
 		log.Error("Error reading  record from db err:", err)
 		return res, fmt.Errorf("Error reading record from db err: %s", err)
@@ -565,22 +1019,108 @@ func readRecoveryRecords(userId, blockchainId string, todoCollection *mongo.Coll
 	return res, nil
 }
 
-// deleteAccount deletes an account entry
-func deleteRecoveryRecord(userId string, todoCollection *mongo.Collection) error {
+// writeMFAEnrollment saves a new unconfirmed TOTP enrollment, replacing a previous unconfirmed one
+func writeMFAEnrollment(enrollment MFAEnrollment, todoCollection *mongo.Collection) error {
 	ctx := context.Background()
-	filter := bson.D{{"recordType", Recovery}, {"userId", userId}}
-	_, err := todoCollection.DeleteOne(ctx, filter)
+	filter := bson.M{"recordType": MFARecord, "userId": enrollment.UserId, "confirmed": false}
+
+	_, err := todoCollection.ReplaceOne(ctx, filter, enrollment, options.Replace().SetUpsert(true))
 	if err != nil {
-		log.Error("Failed to delete recovery record ", err)
+		log.Error("Failed to add mfa enrollment to db:", err)
 		return err
 	}
 	return nil
 }
 
-// writeShare write a keyShare to mongoDB from a trusted MPC dealer
+// readMFAEnrollment retrieve the TOTP enrollment of a user
+func readMFAEnrollment(userId string, todoCollection *mongo.Collection) (MFAEnrollment, error) {
+	var res MFAEnrollment
+	filter := bson.M{"recordType": MFARecord, "userId": userId}
+
+	ctx := context.Background()
+	err := todoCollection.FindOne(ctx, filter).Decode(&res)
+	if err != nil {
+		log.Error("Error reading mfa enrollment from db err:", err)
+		return res, err
+	}
+
+	return res, nil
+}
+
+// deleteMFAEnrollment removes a TOTP enrollment of a user
+func deleteMFAEnrollment(userId string, id primitive.ObjectID, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"recordType": MFARecord, "userId": userId, "_id": id}
+
+	res, err := todoCollection.DeleteOne(ctx, filter)
+	if err != nil {
+		log.Error("failed to delete mfa enrollment ", err)
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("MFA enrollment changed, retry the reset")
+	}
+	return nil
+}
+
+// claimMFAAttempt counts an attempt to check a code against an enrollment that is not locked and returns the
+// enrollment with the attempts since the last accepted code or lockout. A locked enrollment matches nothing
+func claimMFAAttempt(userId string, now time.Time, todoCollection *mongo.Collection) (MFAEnrollment, error) {
+	var res MFAEnrollment
+	filter := bson.M{"recordType": MFARecord, "userId": userId, "lockedUntil": bson.M{"$not": bson.M{"$gt": now}}}
+	update := bson.M{"$inc": bson.M{"failedAttempts": 1}}
+
+	ctx := context.Background()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := todoCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&res)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Error("failed to count mfa attempt ", err)
+	}
+	return res, err
+}
+
+// lockMFAEnrollment locks an enrollment until lockedUntil and starts counting attempts again
+func lockMFAEnrollment(userId string, lockedUntil time.Time, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"recordType": MFARecord, "userId": userId}
+	update := bson.M{"$set": bson.M{"lockedUntil": lockedUntil, "failedAttempts": 0}, "$inc": bson.M{"lockouts": 1}}
+
+	_, err := todoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to lock mfa enrollment ", err)
+		return err
+	}
+	return nil
+}
+
+// useMFATimeStep records an accepted TOTP time step, confirms the enrollment and resets the failed attempts,
+// a time step that is not newer than the last accepted one matches nothing so a replayed code is rejected
+func useMFATimeStep(userId string, step int64, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"recordType": MFARecord, "userId": userId, "lastTimeStep": bson.M{"$lt": step}}
+	update := bson.M{"$set": bson.M{"lastTimeStep": step, "confirmed": true, "failedAttempts": 0, "lockouts": 0}, "$unset": bson.M{"lockedUntil": ""}}
+
+	res, err := todoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to update mfa enrollment ", err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("invalid MFA code")
+	}
+
+	return nil
+}
+
+// writePaillierKey encrypts the paillier secret with the KMS key and writes the key to mongoDB
 func writePaillierKey(paillierKey PaillierKey, todoCollection *mongo.Collection) error {
+	err := encryptPaillierKey(&paillierKey)
+	if err != nil {
+		return err
+	}
+
 	ctx := context.Background()
-	_, err := todoCollection.InsertOne(ctx, paillierKey)
+	_, err = todoCollection.InsertOne(ctx, paillierKey)
 	if err != nil {
 		log.Error("failed to add BasicTx ", err)
 		return err
@@ -612,6 +1152,13 @@ func readPaillierKeys(userId, id string, todoCollection *mongo.Collection) ([]Pa
 
 	defer listRes.Close(ctx)
 
+	for i := range res {
+		err = decryptPaillierKey(&res[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return res, nil
 }
 
@@ -627,28 +1174,255 @@ func deletePaillierKeys(userId, id string, todoCollection *mongo.Collection) err
 	return nil
 }
 
-// readRecoveryRecords retrieve all records of recovery
-func readRandomPaillierKeys(todoCollection *mongo.Collection) ([]PaillierKey, error) {
-	var res []PaillierKey
+// countPaillierKeys returns the number of available keys in the Paillier key pool
+func countPaillierKeys(todoCollection *mongo.Collection) (int64, error) {
 	ctx := context.Background()
-	pipeline := []bson.M{{"$sample": bson.M{"size": 3}}}
-	listRes, err := todoCollection.Aggregate(ctx, pipeline)
-	if err == mongo.ErrNoDocuments {
-		log.Info("No paillier key found:")
-		return res, nil
+	count, err := todoCollection.CountDocuments(ctx, bson.M{"status": bson.M{"$in": bson.A{PaillierKeyAvailable, nil}}})
+	if err != nil {
+		log.Error("Error counting paillier keys err:", err)
+		return 0, err
 	}
+	return count, nil
+}
+
+// acquireLease takes or renews a named lease for the owner, it fails without error while another owner holds it
+func acquireLease(name, owner string, now time.Time, duration time.Duration, leaseCollection *mongo.Collection) (bool, error) {
+	ctx := context.Background()
+	filter := bson.M{"_id": name, "$or": []bson.M{{"owner": owner}, {"expiresAt": bson.M{"$lte": now}}}}
+	update := bson.M{"$set": bson.M{"owner": owner, "expiresAt": now.Add(duration)}}
 
+	_, err := leaseCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// the lease exists and is held by another owner
+		return false, nil
+	}
 	if err != nil {
-		log.Error("Error reading  paillier from db err:", err)
+		log.Error("failed to acquire lease ", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// claimPaillierKey atomically reserves one available pool key for a user, ErrNoDocuments means the pool is empty
+func claimPaillierKey(userId, claimId string, now time.Time, todoCollection *mongo.Collection) (PaillierKey, error) {
+	var res PaillierKey
+	ctx := context.Background()
+	// pool keys written before claiming have no status and are available
+	filter := bson.M{"status": bson.M{"$in": bson.A{PaillierKeyAvailable, nil}}, "error": ""}
+	update := bson.M{"$set": bson.M{"status": PaillierKeyClaimed, "claimId": claimId, "claimedBy": userId, "claimedAt": now}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := todoCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&res)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Error("Error claiming paillier key err:", err)
+		}
+		return res, err
+	}
+
+	return res, decryptPaillierKey(&res)
+}
+
+// releasePaillierClaim returns the keys of a claim that was never handed out to the pool
+func releasePaillierClaim(claimId string, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"claimId": claimId, "status": PaillierKeyClaimed}
+	update := bson.M{"$set": bson.M{"status": PaillierKeyAvailable}, "$unset": bson.M{"claimId": "", "claimedBy": "", "claimedAt": ""}}
+
+	_, err := todoCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to release paillier claim ", err)
+		return err
+	}
+	return nil
+}
+
+// deletePaillierClaim removes the key material of a handed out claim from the pool
+func deletePaillierClaim(claimId string, todoCollection *mongo.Collection) error {
+	ctx := context.Background()
+	_, err := todoCollection.DeleteMany(ctx, bson.M{"claimId": claimId, "status": PaillierKeyClaimed})
+	if err != nil {
+		log.Error("failed to delete paillier claim ", err)
+		return err
+	}
+	return nil
+}
+
+// writePaillierClaims saves the audit records of a claim
+func writePaillierClaims(claims []PaillierKeyClaim, todoCollection *mongo.Collection) error {
+	var documents []interface{}
+	for _, claim := range claims {
+		documents = append(documents, claim)
+	}
+
+	ctx := context.Background()
+	_, err := todoCollection.InsertMany(ctx, documents)
+	if err != nil {
+		log.Error("Failed to add paillier claims to db:", err)
+		return err
+	}
+	return nil
+}
+
+// readPaillierClaims retrieve the audit records of the pool keys a user received, newest first
+func readPaillierClaims(userId string, todoCollection *mongo.Collection) ([]PaillierKeyClaim, error) {
+	res := []PaillierKeyClaim{}
+	filter := bson.M{"userId": userId}
+
+	ctx := context.Background()
+	listRes, err := todoCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"claimedAt": -1}))
+	if err != nil {
+		log.Error("Error reading paillier claims from db err:", err)
 		return res, fmt.Errorf("Error reading record from db err: %s", err)
 	}
+	defer listRes.Close(ctx)
 
 	if err = listRes.All(ctx, &res); err != nil {
 		log.Error(err)
-		return res, fmt.Errorf("Error reading paillier key record from db err: %s", err)
+		return res, fmt.Errorf("Error reading paillier claims from db err: %s", err)
 	}
 
-	defer listRes.Close(ctx)
+	return res, nil
+}
+
+// writeReshareSession saves a new re-sharing session of an account
+func writeReshareSession(session ReshareSession, reshareCollection *mongo.Collection) error {
+	ctx := context.Background()
+	_, err := reshareCollection.InsertOne(ctx, session)
+	if err != nil {
+		log.Error("Failed to add reshare session to db:", err)
+		return err
+	}
+	return nil
+}
+
+// readReshareSession retrieve the re-sharing session of an account for a recovery
+func readReshareSession(userId, blockchainId, accountName string, recoveryId primitive.ObjectID, reshareCollection *mongo.Collection) (ReshareSession, error) {
+	var res ReshareSession
+	filter := bson.M{"userId": userId, "blockchainId": blockchainId, "accountName": accountName, "recoveryId": recoveryId}
+
+	ctx := context.Background()
+	err := reshareCollection.FindOne(ctx, filter).Decode(&res)
+	if err != nil {
+		log.Error("Error reading reshare session from db err:", err)
+		return res, err
+	}
 
 	return res, nil
 }
+
+// updateReshareSession replaces a re-sharing session if it is still at the read update time
+func updateReshareSession(session ReshareSession, previous time.Time, reshareCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"_id": session.ID, "updatedAt": previous}
+
+	res, err := reshareCollection.ReplaceOne(ctx, filter, session)
+	if err != nil {
+		log.Error("failed to update reshare session ", err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("reshare session changed concurrently, retry")
+	}
+	return nil
+}
+
+// purgeReshareRollbacks drops the secrets and replaced public shares of finalized re-sharing sessions past
+// their rollback window, the replaced share must not outlive it
+func purgeReshareRollbacks(now time.Time, reshareCollection *mongo.Collection) (int64, error) {
+	ctx := context.Background()
+	filter := bson.M{"status": ReshareComplete, "rollbackUntil": bson.M{"$lt": now}, "secrets": bson.M{"$exists": true}}
+	update := bson.M{"$set": bson.M{"updatedAt": now}, "$unset": bson.M{"secrets": "", "previousPubShares": ""}}
+
+	res, err := reshareCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to purge reshare rollbacks ", err)
+		return 0, err
+	}
+
+	return res.ModifiedCount, nil
+}
+
+// purgeRecoveryReshares drops the secrets and replaced public shares of every re-sharing session of a recovery
+func purgeRecoveryReshares(recoveryId primitive.ObjectID, now time.Time, reshareCollection *mongo.Collection) error {
+	ctx := context.Background()
+	filter := bson.M{"recoveryId": recoveryId}
+	update := bson.M{"$set": bson.M{"updatedAt": now}, "$unset": bson.M{"secrets": "", "previousPubShares": ""}}
+
+	_, err := reshareCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		log.Error("failed to purge reshare sessions ", err)
+		return err
+	}
+
+	return nil
+}
+
+// encryptPaillierKey moves the paillier secret into EncryptedKey
+func encryptPaillierKey(paillierKey *PaillierKey) error {
+	if paillierKey.PaillierKeyData == "" {
+		return nil
+	}
+
+	ciphertexts, err := chunkEncryptData([]byte(paillierKey.PaillierKeyData))
+	if err != nil {
+		log.Error("Error encrypting paillier key:", err)
+		return err
+	}
+	paillierKey.EncryptedKey = ciphertexts
+	paillierKey.PaillierKeyData = ""
+	return nil
+}
+
+// decryptPaillierKey restores the paillier secret of a key read from mongoDB, keys written before
+// encryption at rest are still plaintext until migrated
+func decryptPaillierKey(paillierKey *PaillierKey) error {
+	if len(paillierKey.EncryptedKey) == 0 {
+		return nil
+	}
+
+	plaintext, err := decrypChunkData(paillierKey.EncryptedKey)
+	if err != nil {
+		log.Error("Error decrypting paillier key ", err)
+		return err
+	}
+	paillierKey.PaillierKeyData = string(plaintext)
+	paillierKey.EncryptedKey = nil
+	return nil
+}
+
+// encryptPlaintextPaillierKeys encrypts the paillier keys still stored as plaintext and returns how many were migrated
+func encryptPlaintextPaillierKeys(todoCollection *mongo.Collection) (int, error) {
+	ctx := context.Background()
+	filter := bson.M{"paillierKeyData": bson.M{"$exists": true, "$ne": ""}}
+	listRes, err := todoCollection.Find(ctx, filter)
+	if err != nil {
+		log.Error("Error reading plaintext paillier keys err:", err)
+		return 0, err
+	}
+	defer listRes.Close(ctx)
+
+	migrated := 0
+	for listRes.Next(ctx) {
+		var paillierKey PaillierKey
+		if err = listRes.Decode(&paillierKey); err != nil {
+			return migrated, err
+		}
+
+		plaintext := paillierKey.PaillierKeyData
+		if err = encryptPaillierKey(&paillierKey); err != nil {
+			return migrated, err
+		}
+
+		// the plaintext filter leaves keys migrated concurrently by another replica untouched
+		update := bson.M{"$set": bson.M{"encryptedKey": paillierKey.EncryptedKey, "paillierKeyData": ""}}
+		res, err := todoCollection.UpdateOne(ctx, bson.M{"_id": paillierKey.ID, "paillierKeyData": plaintext}, update)
+		if err != nil {
+			log.Error("failed to encrypt paillier key ", err)
+			return migrated, err
+		}
+		migrated += int(res.ModifiedCount)
+	}
+
+	return migrated, listRes.Err()
+}
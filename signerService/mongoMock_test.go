@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/address"
+	"go.mongodb.org/mongo-driver/mongo/description"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"go.mongodb.org/mongo-driver/x/mongo/driver"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/wiremessage"
+)
+
+// mockMongo is a single server deployment that answers every command with the next queued
+// response and keeps the commands it received, it lets gateway functions run without a database
+type mockMongo struct {
+	responses []bson.D
+	commands  []bson.Raw
+	updates   chan description.Topology
+}
+
+var mockMongoAddress = address.Address("localhost:27017")
+
+// newMockCollection returns a collection served by a mock deployment answering with responses
+func newMockCollection(t *testing.T, responses ...bson.D) (*mongo.Collection, *mockMongo) {
+	mock := &mockMongo{responses: responses}
+	clientOptions := options.Client()
+	clientOptions.Deployment = mock
+
+	client, err := mongo.NewClient(clientOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	return client.Database("test").Collection("test"), mock
+}
+
+// successResponse is the reply of a successful command with the given fields
+func successResponse(elems ...bson.E) bson.D {
+	return append(bson.D{{"ok", 1}}, elems...)
+}
+
+// updatedResponse is the reply of an update matching count documents
+func updatedResponse(count int) bson.D {
+	return successResponse(bson.E{"n", count}, bson.E{"nModified", count})
+}
+
+// cursorResponse is the reply of a find returning docs in a single batch
+func cursorResponse(docs ...interface{}) bson.D {
+	batch := bson.A{}
+	batch = append(batch, docs...)
+	return successResponse(bson.E{"cursor", bson.D{{"id", int64(0)}, {"ns", "test.test"}, {"firstBatch", batch}}})
+}
+
+// duplicateKeyResponse is the reply of a write rejected by a unique index
+func duplicateKeyResponse() bson.D {
+	return successResponse(bson.E{"writeErrors", bson.A{bson.D{{"index", 0}, {"code", 11000}, {"errmsg", "duplicate key"}}}})
+}
+
+// commandErrorResponse is the reply of a failed command
+func commandErrorResponse(message string) bson.D {
+	return bson.D{{"ok", 0}, {"code", 8000}, {"errmsg", message}}
+}
+
+// command returns the i-th command received by the deployment
+func (mock *mockMongo) command(i int) bson.Raw {
+	if i >= len(mock.commands) {
+		return nil
+	}
+	return mock.commands[i]
+}
+
+func (mock *mockMongo) WriteWireMessage(_ context.Context, wm []byte) error {
+	// OP_MSG header and flag bits precede the command body, document sequences such as the
+	// updates of an update command follow the body and are added to the command as arrays
+	_, _, _, _, rem, ok := wiremessage.ReadHeader(wm)
+	if !ok || len(rem) < 5 || rem[4] != byte(wiremessage.SingleDocument) {
+		return fmt.Errorf("malformed wire message")
+	}
+	body, rem, ok := bsoncore.ReadDocument(rem[5:])
+	if !ok {
+		return fmt.Errorf("malformed command document")
+	}
+
+	command := bson.D{}
+	if err := bson.Unmarshal(body, &command); err != nil {
+		return err
+	}
+	for len(rem) > 0 && rem[0] == byte(wiremessage.DocumentSequence) {
+		var identifier string
+		var docs []bsoncore.Document
+		identifier, docs, rem, ok = wiremessage.ReadMsgSectionDocumentSequence(rem[1:])
+		if !ok {
+			return fmt.Errorf("malformed document sequence")
+		}
+		sequence := bson.A{}
+		for _, doc := range docs {
+			sequence = append(sequence, bson.Raw(doc))
+		}
+		command = append(command, bson.E{identifier, sequence})
+	}
+
+	raw, err := bson.Marshal(command)
+	if err != nil {
+		return err
+	}
+	mock.commands = append(mock.commands, raw)
+	return nil
+}
+
+func (mock *mockMongo) ReadWireMessage(_ context.Context) ([]byte, error) {
+	if len(mock.responses) == 0 {
+		return nil, fmt.Errorf("no mock responses remaining")
+	}
+	response := mock.responses[0]
+	mock.responses = mock.responses[1:]
+
+	idx, wm := wiremessage.AppendHeaderStart(nil, wiremessage.NextRequestID(), 0, wiremessage.OpMsg)
+	wm = wiremessage.AppendMsgFlags(wm, 0)
+	wm = wiremessage.AppendMsgSectionType(wm, wiremessage.SingleDocument)
+	responseBytes, _ := bson.Marshal(response)
+	wm = append(wm, responseBytes...)
+	return bsoncore.UpdateLength(wm, idx, int32(len(wm[idx:]))), nil
+}
+
+func (mock *mockMongo) Description() description.Server {
+	return description.Server{
+		CanonicalAddr:         mockMongoAddress,
+		MaxDocumentSize:       16777216,
+		MaxMessageSize:        48000000,
+		MaxBatchCount:         100000,
+		SessionTimeoutMinutes: 30,
+		Kind:                  description.RSPrimary,
+		WireVersion:           &description.VersionRange{Max: topology.SupportedWireVersions.Max},
+	}
+}
+
+func (mock *mockMongo) Close() error                   { return nil }
+func (mock *mockMongo) ID() string                     { return "mock" }
+func (mock *mockMongo) ServerConnectionID() *int32     { return nil }
+func (mock *mockMongo) Address() address.Address       { return mockMongoAddress }
+func (mock *mockMongo) Stale() bool                    { return false }
+func (mock *mockMongo) Kind() description.TopologyKind { return description.Single }
+func (mock *mockMongo) Connect() error                 { return nil }
+func (mock *mockMongo) RTTMonitor() driver.RTTMonitor  { return mockRTTMonitor{} }
+
+func (mock *mockMongo) SelectServer(context.Context, description.ServerSelector) (driver.Server, error) {
+	return mock, nil
+}
+
+func (mock *mockMongo) Connection(context.Context) (driver.Connection, error) {
+	return mock, nil
+}
+
+func (mock *mockMongo) Disconnect(context.Context) error {
+	if mock.updates != nil {
+		close(mock.updates)
+	}
+	return nil
+}
+
+func (mock *mockMongo) Subscribe() (*driver.Subscription, error) {
+	if mock.updates == nil {
+		mock.updates = make(chan description.Topology, 1)
+		mock.updates <- description.Topology{SessionTimeoutMinutes: 30}
+	}
+	return &driver.Subscription{Updates: mock.updates}, nil
+}
+
+func (mock *mockMongo) Unsubscribe(*driver.Subscription) error {
+	return nil
+}
+
+// mockRTTMonitor reports no round trip time for the mock deployment
+type mockRTTMonitor struct{}
+
+func (mockRTTMonitor) EWMA() time.Duration { return 0 }
+func (mockRTTMonitor) Min() time.Duration  { return 0 }
+func (mockRTTMonitor) P90() time.Duration  { return 0 }
+func (mockRTTMonitor) Stats() string       { return "" }
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ReserveNonce hands out the next free nonce of an EVM account, concurrent signings of the same
+// account never receive the same nonce
+func ReserveNonce(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	client, ok := EVMClients[blockchainId]
+	if !ok {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: no rpc client configured for blockchain: %s", blockchainId), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	nonceCollection := DB.Database(MongoDatabase).Collection("NonceCollection")
+	defer CloseClientDB(DB)
+
+	account, err := readAccount(userId, blockchainId, accountName, userCollection)
+	if err != nil {
+		log.Error("Error reading account record err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), RPCTimeout)
+	defer cancel()
+	reservation, err := reserveNonce(ctx, client, blockchainId, account.Address, nonceCollection)
+	if err != nil {
+		log.Error("Error reserving nonce err:", err)
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(reservation, nil, c.Writer)
+	return
+}
+
+// ReleaseNonce returns a reserved nonce that will not be used, or the nonce of a recorded transaction
+// that was never broadcast so a replacement transaction can use it
+func ReleaseNonce(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	nonce, err := strconv.ParseUint(c.Query("nonce"), 10, 64)
+	if err != nil {
+		WriteErrorResponse(http.StatusBadRequest, "Invalid query parameter: nonce", c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	nonceCollection := DB.Database(MongoDatabase).Collection("NonceCollection")
+	txCollection := DB.Database(MongoDatabase).Collection("TxCollection")
+	defer CloseClientDB(DB)
+
+	account, err := readAccount(userId, blockchainId, accountName, userCollection)
+	if err != nil {
+		log.Error("Error reading account record err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	err = releaseNonce(blockchainId, account.Address, nonce, nonceCollection, txCollection)
+	if err != nil {
+		log.Error("Error releasing nonce err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse("Success", nil, c.Writer)
+	return
+}
+
+// reserveNonce reconciles the reservations of an account with the pending nonce on chain, then
+// reuses the lowest released nonce or hands out the next nonce of the account counter
+func reserveNonce(ctx context.Context, client EVMClient, blockchainId, address string, nonceCollection *mongo.Collection) (NonceReservation, error) {
+	if !common.IsHexAddress(address) {
+		return NonceReservation{}, fmt.Errorf("invalid account address: %s", address)
+	}
+	address = common.HexToAddress(address).Hex()
+
+	pendingNonce, err := client.PendingNonceAt(ctx, address)
+	if err != nil {
+		return NonceReservation{}, err
+	}
+
+	reservations, err := readOpenNonceReservations(blockchainId, address, nonceCollection)
+	if err != nil {
+		return NonceReservation{}, err
+	}
+	release, stale := reconcileNonceReservations(reservations, pendingNonce, time.Now().UTC())
+	// a reservation changed by a concurrent request no longer matches and is skipped
+	for _, nonce := range release {
+		err = updateNonceReservation(blockchainId, address, nonce, []string{NonceReserved}, NonceReleased, "", nonceCollection)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return NonceReservation{}, err
+		}
+	}
+	for _, nonce := range stale {
+		err = updateNonceReservation(blockchainId, address, nonce, []string{NonceReserved, NonceReleased}, NonceStale, "", nonceCollection)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return NonceReservation{}, err
+		}
+	}
+
+	reservation, err := claimReleasedNonce(blockchainId, address, pendingNonce, nonceCollection)
+	if err == nil {
+		return reservation, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return NonceReservation{}, err
+	}
+
+	nonce, err := incrementNonceCounter(blockchainId, address, pendingNonce, nonceCollection)
+	if err != nil {
+		return NonceReservation{}, err
+	}
+
+	reservation = NonceReservation{
+		BlockchainId: blockchainId,
+		Address:      address,
+		Nonce:        nonce,
+		Status:       NonceReserved,
+		ReservedAt:   time.Now().UTC(),
+	}
+	err = writeNonceReservation(reservation, nonceCollection)
+	return reservation, err
+}
+
+// reconcileNonceReservations returns the reserved nonces that expired and must be released, and the
+// open nonces below the pending nonce that were used on chain and can no longer be handed out
+func reconcileNonceReservations(reservations []NonceReservation, pendingNonce uint64, now time.Time) ([]uint64, []uint64) {
+	var release, stale []uint64
+	for _, reservation := range reservations {
+		if reservation.Nonce < pendingNonce {
+			stale = append(stale, reservation.Nonce)
+		} else if reservation.Status == NonceReserved && now.Sub(reservation.ReservedAt) > NonceReservationTTL {
+			release = append(release, reservation.Nonce)
+		}
+	}
+
+	return release, stale
+}
+
+// markNonceUsed links a recorded transaction to the reservation of its nonce, nonces used without a
+// reservation move the account counter past them so they are never handed out
+func markNonceUsed(blockchainId, address string, nonce uint64, txHash string, nonceCollection *mongo.Collection) error {
+	address = common.HexToAddress(address).Hex()
+	err := updateNonceReservation(blockchainId, address, nonce, []string{NonceReserved, NonceReleased}, NonceUsed, txHash, nonceCollection)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	return raiseNonceCounter(blockchainId, address, nonce+1, nonceCollection)
+}
+
+// releaseNonce releases a reserved nonce. A nonce used by a transaction that was never broadcast is
+// released as well and the abandoned transaction is marked as replaced
+func releaseNonce(blockchainId, address string, nonce uint64, nonceCollection, txCollection *mongo.Collection) error {
+	address = common.HexToAddress(address).Hex()
+	reservation, err := readNonceReservation(blockchainId, address, nonce, nonceCollection)
+	if err != nil {
+		return fmt.Errorf("nonce %d is not reserved for %s", nonce, address)
+	}
+
+	switch reservation.Status {
+	case NonceReserved:
+	case NonceUsed:
+		tx, err := readTx(reservation.TxHash, txCollection)
+		if err != nil {
+			return err
+		}
+		if tx.Status != TxCreated && tx.Status != TxSigned {
+			return fmt.Errorf("nonce %d is used by transaction %s with status %s", nonce, tx.TxHash, tx.Status)
+		}
+
+		tx.Status = TxReplaced
+		tx.UpdatedAt = time.Now().UTC()
+		err = updateTx(tx.TxHash, tx, txCollection)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("nonce %d is already %s", nonce, reservation.Status)
+	}
+
+	return updateNonceReservation(blockchainId, address, nonce, []string{reservation.Status}, NonceReleased, "", nonceCollection)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestReconcileNonceReservations(t *testing.T) {
+	now := time.Now().UTC()
+	reservations := []NonceReservation{
+		{Nonce: 4, Status: NonceReserved, ReservedAt: now},
+		{Nonce: 5, Status: NonceReleased, ReservedAt: now},
+		{Nonce: 6, Status: NonceReserved, ReservedAt: now.Add(-NonceReservationTTL - time.Minute)},
+		{Nonce: 7, Status: NonceReserved, ReservedAt: now.Add(-time.Minute)},
+		{Nonce: 8, Status: NonceReleased, ReservedAt: now.Add(-NonceReservationTTL - time.Minute)},
+	}
+
+	release, stale := reconcileNonceReservations(reservations, 6, now)
+	if len(stale) != 2 || stale[0] != 4 || stale[1] != 5 {
+		t.Error("Nonces below the pending nonce should be stale")
+	}
+	if len(release) != 1 || release[0] != 6 {
+		t.Error("Only expired reserved nonces should be released")
+	}
+}
+
+// nonceTestAddress is the checksummed sender of the mocked nonce reservations
+const nonceTestAddress = "0xba536245A30404A983E120a3d07A7dF260a89669"
+
+func TestReserveNonce(t *testing.T) {
+	client := &fakeEVMClient{pendingNonces: map[string]uint64{nonceTestAddress: 5}}
+
+	t.Run("next nonce of the counter", func(t *testing.T) {
+		nonceCollection, _ := newMockCollection(t,
+			cursorResponse(),
+			successResponse(bson.E{"value", nil}),
+			updatedResponse(1),
+			successResponse(bson.E{"value", bson.D{{"nextNonce", 7}}}),
+			successResponse(),
+		)
+		reservation, err := reserveNonce(context.Background(), client, "ETH", nonceTestAddress, nonceCollection)
+		if err != nil || reservation.Nonce != 7 || reservation.Status != NonceReserved {
+			t.Error("Next nonce of the account counter should be reserved", err)
+		}
+	})
+
+	t.Run("released nonce is reused", func(t *testing.T) {
+		released := bson.D{{"blockchainId", "ETH"}, {"address", nonceTestAddress}, {"nonce", 6}, {"status", NonceReleased}, {"reservedAt", time.Now().UTC()}}
+		nonceCollection, _ := newMockCollection(t,
+			cursorResponse(released),
+			successResponse(bson.E{"value", bson.D{{"nonce", 6}, {"status", NonceReserved}}}),
+		)
+		reservation, err := reserveNonce(context.Background(), client, "ETH", nonceTestAddress, nonceCollection)
+		if err != nil || reservation.Nonce != 6 {
+			t.Error("Released nonce should be reserved again", err)
+		}
+	})
+
+	t.Run("failed stale update", func(t *testing.T) {
+		used := bson.D{{"blockchainId", "ETH"}, {"address", nonceTestAddress}, {"nonce", 3}, {"status", NonceReserved}, {"reservedAt", time.Now().UTC()}}
+		nonceCollection, _ := newMockCollection(t,
+			cursorResponse(used),
+			commandErrorResponse("interrupted"),
+		)
+		_, err := reserveNonce(context.Background(), client, "ETH", nonceTestAddress, nonceCollection)
+		if err == nil {
+			t.Error("Failed reservation update should be returned")
+		}
+	})
+
+	t.Run("concurrent counter creation", func(t *testing.T) {
+		nonceCollection, _ := newMockCollection(t,
+			cursorResponse(),
+			successResponse(bson.E{"value", nil}),
+			duplicateKeyResponse(),
+			updatedResponse(1),
+			successResponse(bson.E{"value", bson.D{{"nextNonce", 5}}}),
+			successResponse(),
+		)
+		reservation, err := reserveNonce(context.Background(), client, "ETH", nonceTestAddress, nonceCollection)
+		if err != nil || reservation.Nonce != 5 {
+			t.Error("Counter upsert should be retried after a duplicate key error", err)
+		}
+	})
+
+	t.Run("duplicate reservation", func(t *testing.T) {
+		nonceCollection, _ := newMockCollection(t,
+			cursorResponse(),
+			successResponse(bson.E{"value", nil}),
+			updatedResponse(1),
+			successResponse(bson.E{"value", bson.D{{"nextNonce", 5}}}),
+			duplicateKeyResponse(),
+		)
+		_, err := reserveNonce(context.Background(), client, "ETH", nonceTestAddress, nonceCollection)
+		if err == nil {
+			t.Error("Nonce reserved twice should be rejected")
+		}
+	})
+}
+
+func TestReleaseNonce(t *testing.T) {
+
+	t.Run("reserved nonce", func(t *testing.T) {
+		nonceCollection, _ := newMockCollection(t,
+			cursorResponse(bson.D{{"nonce", 6}, {"status", NonceReserved}}),
+			updatedResponse(1),
+		)
+		if err := releaseNonce("ETH", nonceTestAddress, 6, nonceCollection, nonceCollection); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("nonce of a signed transaction", func(t *testing.T) {
+		nonceCollection, _ := newMockCollection(t,
+			cursorResponse(bson.D{{"nonce", 6}, {"status", NonceUsed}, {"txHash", "0x01"}}),
+			cursorResponse(bson.D{{"txHash", "0x01"}, {"status", TxSigned}}),
+			updatedResponse(1),
+			updatedResponse(1),
+		)
+		if err := releaseNonce("ETH", nonceTestAddress, 6, nonceCollection, nonceCollection); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("nonce of a broadcast transaction", func(t *testing.T) {
+		nonceCollection, _ := newMockCollection(t,
+			cursorResponse(bson.D{{"nonce", 6}, {"status", NonceUsed}, {"txHash", "0x01"}}),
+			cursorResponse(bson.D{{"txHash", "0x01"}, {"status", TxBroadcast}}),
+		)
+		if releaseNonce("ETH", nonceTestAddress, 6, nonceCollection, nonceCollection) == nil {
+			t.Error("Nonce of a broadcast transaction should not be released")
+		}
+	})
+
+	t.Run("nonce not reserved", func(t *testing.T) {
+		nonceCollection, _ := newMockCollection(t, cursorResponse())
+		if releaseNonce("ETH", nonceTestAddress, 6, nonceCollection, nonceCollection) == nil {
+			t.Error("Nonce without reservation should not be released")
+		}
+	})
+}
+
+func TestCreateNonceIndexes(t *testing.T) {
+	nonceCollection, mock := newMockCollection(t, successResponse())
+	if err := createNonceIndexes(nonceCollection); err != nil {
+		t.Fatal(err)
+	}
+
+	indexes, _ := mock.command(0).Lookup("indexes").Array().Values()
+	if len(indexes) != 2 {
+		t.Fatal("Counter and reservation indexes should be created")
+	}
+	for _, index := range indexes {
+		if unique, _ := index.Document().Lookup("unique").BooleanOK(); !unique {
+			t.Error("Nonce indexes should be unique")
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	//"github.com/coinbase/kryptology/pkg/core/curves"
@@ -12,6 +15,7 @@ import (
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/curve25519"
 )
 
 // PostECDSAKeyShare api function for receiving and storing participant
@@ -24,6 +28,37 @@ func PostECDSAKeyShare(c *gin.Context) {
 		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
 		return
 	}
+
+	err = validateTokenId(keyShare.BlockchainId, keyShare.TokenId)
+	if err != nil {
+		log.Error("Error validating token: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	if keyShare.ChainCode != "" {
+		_, err = parseChainCode(keyShare.ChainCode)
+		if err != nil {
+			log.Error("Error validating chain code: ", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+	}
+
+	//derive the address from the share public key instead of trusting the client
+	address, err := deriveECDSAAddress(keyShare.BlockchainId, keyShare.ShareData.PK)
+	if err != nil {
+		log.Error("Error deriving address: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	keyShare.Address, err = verifyAddress(keyShare.BlockchainId, keyShare.Address, address)
+	if err != nil {
+		log.Error("Error verifying address: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
 	var DB *mongo.Client = ConnectDB()
 	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
 	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
@@ -45,12 +80,26 @@ func PostECDSAKeyShare(c *gin.Context) {
 		}
 	} else if err != nil {
 		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
 	} else {
 		err = updateECDSAShare(keyShare, keyShareCollection)
 		if err != nil {
 			WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
 			return
 		}
+
+		err = updateAccountAddress(keyShare.UserId, keyShare.BlockchainId, keyShare.AccountName, keyShare.Address, userCollection)
+		if err != nil {
+			WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+	}
+
+	//keep the public key and chain code on the account record so they can be served without decrypting the share
+	err = updateAccountPublicKey(keyShare.UserId, keyShare.BlockchainId, keyShare.AccountName, keyShare.ShareData.PK, keyShare.ChainCode, userCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
 	}
 
 	ValidateAndWriteResponse("Success", err, c.Writer)
@@ -67,6 +116,34 @@ func PostEDDSAKeyShare(c *gin.Context) {
 		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
 		return
 	}
+
+	err = validateTokenId(keyShare.BlockchainId, keyShare.TokenId)
+	if err != nil {
+		log.Error("Error validating token: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	//derive the address from the share public key instead of trusting the client
+	pk, err := parseEDDSAPublicKey(keyShare.PK)
+	if err != nil {
+		log.Error("Error reading public key: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	address, err := deriveEDDSAAddress(keyShare.BlockchainId, pk)
+	if err != nil {
+		log.Error("Error deriving address: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	keyShare.Address, err = verifyAddress(keyShare.BlockchainId, keyShare.Address, address)
+	if err != nil {
+		log.Error("Error verifying address: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
 	var DB *mongo.Client = ConnectDB()
 	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
 	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
@@ -87,12 +164,26 @@ func PostEDDSAKeyShare(c *gin.Context) {
 		}
 	} else if err != nil {
 		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
 	} else {
 		err = updateEDDSAShare(keyShare, keyShareCollection)
 		if err != nil {
 			WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
 			return
 		}
+
+		err = updateAccountAddress(keyShare.UserId, keyShare.BlockchainId, keyShare.AccountName, keyShare.Address, userCollection)
+		if err != nil {
+			WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+	}
+
+	//keep the public key on the account record so signatures can be verified without decrypting the share
+	err = updateAccountPublicKey(keyShare.UserId, keyShare.BlockchainId, keyShare.AccountName, keyShare.PK, "", userCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
 	}
 
 	ValidateAndWriteResponse("Success", err, c.Writer)
@@ -104,6 +195,9 @@ func GetECDSAKeyShare(c *gin.Context) {
 	userId := c.Param("userId")
 	blockchainId := c.Param("blockchainId")
 	accountName := c.Param("accountName")
+	if !authorizeUser(c, userId) {
+		return
+	}
 	var DB *mongo.Client = ConnectDB()
 	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
 	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
@@ -115,7 +209,14 @@ func GetECDSAKeyShare(c *gin.Context) {
 		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Recovery not initiated"), c.Writer)
 		return
 	}
-	if recoveryRecord.Status == "customerVerified" {
+	err = recoveryUnlocked(recoveryRecord, time.Now())
+	if err == nil {
+		err = recoveryCoversAccount(recoveryRecord, blockchainId, accountName)
+	}
+	if err == nil && recoveryRecord.Mode == RecoveryModeReshare {
+		err = fmt.Errorf("Recovery re-provisions the device, shares are not exported")
+	}
+	if err == nil {
 		share, err := readECDSAShare(userId, blockchainId, accountName, keyShareCollection)
 		if err != nil {
 			log.Error("Error reading share err:", err)
@@ -123,12 +224,32 @@ func GetECDSAKeyShare(c *gin.Context) {
 			return
 		}
 
-		ValidateAndWriteResponse(share, err, c.Writer)
+		recipientKey, err := recoveryRecipientKey(recoveryRecord, c.Query("publicKey"))
+		if err != nil {
+			log.Error("Error checking recipient key err:", err)
+			WriteErrorResponse(http.StatusUnauthorized, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+
+		release, err := releaseShare(share, c.Query("scheme"), recipientKey)
+		if err != nil {
+			log.Error("Error sealing share err:", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+
+		err = markRecoveryAccount(recoveryRecord.ID, blockchainId, accountName, RecoveryAccountReleased, time.Now().UTC(), userCollection)
+		if err != nil {
+			WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+
+		ValidateAndWriteResponse(release, nil, c.Writer)
 		return
 	}
 
-	log.Error("Recovery not verified")
-	WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Recovery not verified"), c.Writer)
+	log.Error("Recovery not unlocked err:", err)
+	WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
 	return
 }
 
@@ -137,6 +258,9 @@ func GetEDDSAKeyShare(c *gin.Context) {
 	userId := c.Param("userId")
 	blockchainId := c.Param("blockchainId")
 	accountName := c.Param("accountName")
+	if !authorizeUser(c, userId) {
+		return
+	}
 	var DB *mongo.Client = ConnectDB()
 	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
 	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
@@ -148,7 +272,14 @@ func GetEDDSAKeyShare(c *gin.Context) {
 		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Recovery not initiated"), c.Writer)
 		return
 	}
-	if recoveryRecord.Status == "customerVerified" {
+	err = recoveryUnlocked(recoveryRecord, time.Now())
+	if err == nil {
+		err = recoveryCoversAccount(recoveryRecord, blockchainId, accountName)
+	}
+	if err == nil && recoveryRecord.Mode == RecoveryModeReshare {
+		err = fmt.Errorf("Recovery re-provisions the device, shares are not exported")
+	}
+	if err == nil {
 		share, err := readEDDSAShare(userId, blockchainId, accountName, keyShareCollection)
 		if err != nil {
 			log.Error("Error reading share err:", err)
@@ -156,12 +287,32 @@ func GetEDDSAKeyShare(c *gin.Context) {
 			return
 		}
 
-		ValidateAndWriteResponse(share, err, c.Writer)
+		recipientKey, err := recoveryRecipientKey(recoveryRecord, c.Query("publicKey"))
+		if err != nil {
+			log.Error("Error checking recipient key err:", err)
+			WriteErrorResponse(http.StatusUnauthorized, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+
+		release, err := releaseShare(share, c.Query("scheme"), recipientKey)
+		if err != nil {
+			log.Error("Error sealing share err:", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+
+		err = markRecoveryAccount(recoveryRecord.ID, blockchainId, accountName, RecoveryAccountReleased, time.Now().UTC(), userCollection)
+		if err != nil {
+			WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+
+		ValidateAndWriteResponse(release, nil, c.Writer)
 		return
 	}
 
-	log.Error("Recovery not verified")
-	WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Recovery not verified"), c.Writer)
+	log.Error("Recovery not unlocked err:", err)
+	WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
 	return
 }
 
@@ -193,30 +344,231 @@ func GetRecoverUserAccountsStatus(c *gin.Context) {
 	var DB *mongo.Client = ConnectDB()
 	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
 	defer CloseClientDB(DB)
-	recoveryRecord, err := readRecoveryRecord(userId, userCollection)
+	recoveryRecords, err := readRecoveryRecords(userId, userCollection)
+	if err != nil {
+		log.Error("Error getting recovery record err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
 
-	if err == mongo.ErrNoDocuments {
+	if len(recoveryRecords) == 0 {
 		ValidateAndWriteResponse(SuccessDetails{
 			Message: "not initiated",
 		}, nil, c.Writer)
 		return
 	}
 
+	ValidateAndWriteResponse(recoveryStatus(recoveryRecords[0]), err, c.Writer)
+	return
+}
+
+// GetRecoveryHistory returns every recovery of a user, newest first
+func GetRecoveryHistory(c *gin.Context) {
+	userId := c.Param("userId")
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	defer CloseClientDB(DB)
+	recoveryRecords, err := readRecoveryRecords(userId, userCollection)
+	if err != nil {
+		log.Error("Error getting recovery records err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	result := []RecoveryStatus{}
+	for _, recoveryRecord := range recoveryRecords {
+		result = append(result, recoveryStatus(recoveryRecord))
+	}
+
+	ValidateAndWriteResponse(result, nil, c.Writer)
+	return
+}
+
+// recoveryStatus converts a recovery record to its api representation
+func recoveryStatus(recoveryRecord RecoveryRecord) RecoveryStatus {
+	status := RecoveryStatus{Message: recoveryRecord.Status, Mode: recoveryRecord.Mode, RecordId: recoveryRecord.ID.Hex(), DeviceKey: recoveryRecord.DeviceKey, Accounts: recoveryRecord.Accounts, Decisions: recoveryRecord.Decisions}
+	if !recoveryRecord.UnlockAt.IsZero() {
+		status.UnlockAt = &recoveryRecord.UnlockAt
+	}
+	if !recoveryRecord.CreatedAt.IsZero() {
+		status.CreatedAt = &recoveryRecord.CreatedAt
+		status.UpdatedAt = &recoveryRecord.UpdatedAt
+	}
+	if !recoveryRecord.ExpiresAt.IsZero() && !recoveryEnded(recoveryRecord.Status) {
+		status.ExpiresAt = &recoveryRecord.ExpiresAt
+	}
+
+	return status
+}
+
+// recoveryEnded reports whether a recovery status is final
+func recoveryEnded(status string) bool {
+	for _, ended := range RecoveryEnded {
+		if status == ended {
+			return true
+		}
+	}
+	return false
+}
+
+// CancelRecovery lets the user stop a recovery, e.g. during the time lock after an account takeover
+func CancelRecovery(c *gin.Context) {
+	userId := c.Param("userId")
+	if !authorizeUser(c, userId) {
+		return
+	}
+
+	var request MFARequest
+	err := json.NewDecoder(c.Request.Body).Decode(&request)
+	if err != nil {
+		log.Error("Error decoding mfa request: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	defer CloseClientDB(DB)
+
+	_, err = readRecoveryRecord(userId, userCollection)
 	if err != nil {
 		log.Error("Error getting recovery record err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Recovery not initiated"), c.Writer)
+		return
+	}
+
+	step, err := verifyMFACode(userId, request.Code, true, userCollection)
+	if err != nil {
+		log.Error("Error verifying mfa code err:", err)
+		WriteErrorResponse(http.StatusUnauthorized, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	evidence := RecoveryEvidence{Status: Cancelled, Method: EvidenceTOTP, TimeStep: step, VerifiedAt: time.Now().UTC()}
+	err = endRecoveryRecord(userId, Cancelled, evidence, userCollection)
+	if err != nil {
+		log.Error("Error cancelling recovery record err:", err)
 		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
 		return
 	}
 
 	ValidateAndWriteResponse(SuccessDetails{
-		Message: recoveryRecord.Status,
-	}, err, c.Writer)
+		Message: "Success",
+	}, nil, c.Writer)
 	return
 }
 
+// recoveryUnlocked checks that the customer is verified, the time lock of the recovery has passed
+// and the recovery has not expired
+func recoveryUnlocked(recoveryRecord RecoveryRecord, now time.Time) error {
+	if recoveryRecord.Status != CustomerVerified {
+		return fmt.Errorf("Recovery not verified")
+	}
+	if recoveryRecord.UnlockAt.IsZero() || now.Before(recoveryRecord.UnlockAt) {
+		return fmt.Errorf("Recovery locked until %s", recoveryRecord.UnlockAt.Format(time.RFC3339))
+	}
+	if !now.Before(recoveryRecord.ExpiresAt) {
+		return fmt.Errorf("Recovery expired")
+	}
+
+	return nil
+}
+
+// recoveryCoversAccount checks that an account was named in the recovery request and its share is still pending
+func recoveryCoversAccount(recoveryRecord RecoveryRecord, blockchainId, accountName string) error {
+	for _, account := range recoveryRecord.Accounts {
+		if account.BlockchainId == blockchainId && account.AccountName == accountName {
+			if account.Status != RecoveryAccountPending {
+				return fmt.Errorf("Share of account %s %s was already %s", blockchainId, accountName, account.Status)
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Account %s %s is not covered by the recovery", blockchainId, accountName)
+}
+
+// recoveryReprovisioned checks that every account of a reshare recovery was re-provisioned, a recovery completes
+// only once no re-sharing session is left open
+func recoveryReprovisioned(recoveryRecord RecoveryRecord) error {
+	if recoveryRecord.Mode != RecoveryModeReshare {
+		return nil
+	}
+	for _, account := range recoveryRecord.Accounts {
+		if account.Status != RecoveryAccountReprovisioned {
+			return fmt.Errorf("Account %s %s is not re-provisioned, finalize or roll back its reshare first", account.BlockchainId, account.AccountName)
+		}
+	}
+	return nil
+}
+
+// validateRecoveryAccounts checks that a recovery request names at least one account and no account twice
+func validateRecoveryAccounts(accounts []RecoveryAccount) error {
+	if len(accounts) == 0 {
+		return fmt.Errorf("recovery must name the accounts it covers")
+	}
+
+	named := make(map[string]bool)
+	for _, account := range accounts {
+		if account.BlockchainId == "" || account.AccountName == "" {
+			return fmt.Errorf("recovery accounts need blockchainId and accountName")
+		}
+		key := account.BlockchainId + "-" + account.AccountName
+		if named[key] {
+			return fmt.Errorf("account %s %s is named twice", account.BlockchainId, account.AccountName)
+		}
+		named[key] = true
+	}
+
+	return nil
+}
+
+// validateRecoveryMode defaults the recovery mode to export, a reshare recovery only covers ecdsa accounts
+func validateRecoveryMode(mode string, accounts []RecoveryAccount) (string, error) {
+	switch mode {
+	case "", RecoveryModeExport:
+		return RecoveryModeExport, nil
+	case RecoveryModeReshare:
+		for _, account := range accounts {
+			curve, err := signatureCurve(account.BlockchainId)
+			if err != nil || curve != CurveSecp256k1 {
+				return mode, fmt.Errorf("account %s %s can not be re-shared, reshare supports ecdsa accounts", account.BlockchainId, account.AccountName)
+			}
+		}
+		return mode, nil
+	}
+
+	return mode, fmt.Errorf("unknown recovery mode: %s", mode)
+}
+
+// validateDeviceKey checks the key of the new device, operators approve it with the record. An export recovery
+// seals the released shares to it, a reshare recovery the device sub-shares. Only an export with plaintext
+// release enabled names no device
+func validateDeviceKey(mode, deviceKey string) error {
+	if deviceKey == "" && mode == RecoveryModeExport && AllowPlaintextShareRelease {
+		return nil
+	}
+
+	pkBytes, err := hex.DecodeString(strings.TrimPrefix(deviceKey, "0x"))
+	if err == nil && (mode == RecoveryModeReshare || len(pkBytes) != curve25519.PointSize) {
+		_, err = parseSEC1PublicKey(pkBytes)
+	}
+	if err != nil || deviceKey == "" {
+		if mode == RecoveryModeReshare {
+			return fmt.Errorf("reshare needs the secp256k1 deviceKey of the new device")
+		}
+		return fmt.Errorf("export needs the secp256k1 or X25519 deviceKey the shares are sealed to")
+	}
+	return nil
+}
+
 // RecoverUserAccounts creates or updates recovery record
 func RecoverUserAccounts(c *gin.Context) {
 	userId := c.Param("userId")
+	if !authorizeUser(c, userId) {
+		return
+	}
 
 	state := c.Query("state")
 	log.Info("State passed:", state)
@@ -232,39 +584,100 @@ func RecoverUserAccounts(c *gin.Context) {
 
 		return
 	} else if state == Initiate {
-		err := createRecoveryRecord(userId, userCollection)
+		enrollment, err := readMFAEnrollment(userId, userCollection)
+		if err != nil || !enrollment.Confirmed {
+			log.Error("Error starting recovery: mfa not enrolled")
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "MFA enrollment required for recovery"), c.Writer)
+			return
+		}
+
+		var request RecoveryRequest
+		err = json.NewDecoder(c.Request.Body).Decode(&request)
+		if err == nil {
+			err = validateRecoveryAccounts(request.Accounts)
+		}
+		if err == nil {
+			request.Mode, err = validateRecoveryMode(request.Mode, request.Accounts)
+		}
+		if err == nil {
+			err = validateDeviceKey(request.Mode, request.DeviceKey)
+		}
+		if err != nil {
+			log.Error("Error decoding recovery request: ", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+
+		err = createRecoveryRecord(userId, request.Mode, request.DeviceKey, request.Accounts, userCollection)
 		if err != nil {
 			log.Error("Error creating recovery record err:", err)
 			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
 			return
 		}
 	} else {
+		previous, ok := RecoveryTransitions[state]
+		if state == CustomerVerified {
+			log.Error("Error updating recovery record: customer verification needs operator approval")
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "customer verification needs operator approval quorum"), c.Writer)
+			return
+		} else if !ok {
+			log.Error("Error updating recovery record: unknown state")
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Error updating recovery record: unknown state"), c.Writer)
+			return
+		}
+
+		var request MFARequest
+		err := json.NewDecoder(c.Request.Body).Decode(&request)
+		if err != nil {
+			log.Error("Error decoding mfa request: ", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+
 		recoveryRecord, err := readRecoveryRecord(userId, userCollection)
 		if err != nil {
 			log.Error("Error getting recovery record err:", err)
 			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
 			return
 		}
-		if state == CustomerVerified && recoveryRecord.Status == Initiated {
-			err := updateRecoveryRecord(userId, state, userCollection)
+		if recoveryRecord.Status != previous {
+			log.Error("Error updating recovery record: wrong status")
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Error updating recovery record: wrong status"), c.Writer)
+			return
+		}
+		if state == Complete {
+			err = recoveryReprovisioned(recoveryRecord)
 			if err != nil {
-				log.Error("Error creating recovery record err:", err)
+				log.Error("Error completing recovery err:", err)
 				WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
 				return
 			}
-		} else if state == Complete && recoveryRecord.Status == CustomerVerified {
-			err := deleteRecoveryRecord(userId, userCollection)
+		}
+
+		//every transition needs a fresh TOTP code, the state parameter alone moves nothing
+		step, err := verifyMFACode(userId, request.Code, true, userCollection)
+		if err != nil {
+			log.Error("Error verifying mfa code err:", err)
+			WriteErrorResponse(http.StatusUnauthorized, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+
+		// a completed recovery keeps no replaced share that rebuilds the key with the old device
+		if state == Complete && recoveryRecord.Mode == RecoveryModeReshare {
+			err = purgeRecoveryReshares(recoveryRecord.ID, time.Now().UTC(), DB.Database(MongoDatabase).Collection("ReshareCollection"))
 			if err != nil {
-				log.Error("Error deleting recovery record err:", err)
-				WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+				WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
 				return
 			}
-		} else {
-			log.Error("Error updating recovery record: wrong status")
-			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Error updating recovery record: wrong status"), c.Writer)
-			return
 		}
 
+		evidence := RecoveryEvidence{Status: state, Method: EvidenceTOTP, TimeStep: step, VerifiedAt: time.Now().UTC()}
+		err = advanceRecoveryRecord(userId, previous, state, evidence, userCollection)
+		if err != nil {
+			log.Error("Error updating recovery record err:", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
 	}
 
 	ValidateAndWriteResponse(SuccessDetails{
@@ -308,32 +721,29 @@ func POSTEDDSASignature(c *gin.Context) {
 	return
 }
 
-func generatePaillierKeys() {
-
-	for {
+// completeEDDSASignature combines the client partial signature over a prepared payload with the custody
+// share and checks the resulting signature against the account public key
+func completeEDDSASignature(share EDDSAShare, payload []byte, partialSignature string) ([]byte, error) {
+	pk, err := parseEDDSAPublicKey(share.PK)
+	if err != nil {
+		return nil, err
+	}
 
-		id := uuid.New().String()
-		var DB *mongo.Client = ConnectDB()
-		paillierKeyCollection := DB.Database(MongoDatabase).Collection("PaillierKeyCollection")
-		paillierKey, err := ECDSAWalletService.CreatePaillierKeyPair()
-		if err != nil {
-			log.Error("Error creating paillier key", err)
-			return
-		}
+	fullSignature, err := EDDSASignerService.CustodySign(share.PK, share.SigShare, hex.EncodeToString(payload), partialSignature)
+	if err != nil {
+		return nil, fmt.Errorf("Error generating full signature: %s", err)
+	}
 
-		keyData := PaillierKey{
-			UniqueId:        id,
-			PaillierKeyData: paillierKey,
-		}
-		errDB := writePaillierKey(keyData, paillierKeyCollection)
-		if errDB != nil {
-			log.Error("Error writing paillier key error:", errDB)
-			return
-		}
-		defer CloseClientDB(DB)
+	signature, err := parseEDDSASignature(fullSignature)
+	if err != nil {
+		return nil, err
+	}
 
-		time.Sleep(60 * time.Second)
+	if !ed25519.Verify(pk, payload, signature) {
+		return nil, fmt.Errorf("signature does not match account public key")
 	}
+
+	return signature, nil
 }
 
 func RequestPaillierKey(c *gin.Context) {
@@ -354,7 +764,9 @@ func RequestPaillierKey(c *gin.Context) {
 					Error:     err.Error(),
 				}
 				errDB := writePaillierKey(keyData, userCollection)
-				log.Error("Error writing paillier key error:", errDB)
+				if errDB != nil {
+					log.Error("Error writing paillier key error:", errDB)
+				}
 				return
 			}
 
@@ -365,7 +777,9 @@ func RequestPaillierKey(c *gin.Context) {
 				PaillierKeyData: paillierKey,
 			}
 			errDB := writePaillierKey(keyData, userCollection)
-			log.Error("Error writing paillier key error:", errDB)
+			if errDB != nil {
+				log.Error("Error writing paillier key error:", errDB)
+			}
 			defer CloseClientDB(DB)
 		}(i, id, userId)
 	}
@@ -447,41 +861,105 @@ func RemovePaillierKey(c *gin.Context) {
 	return
 }
 
-func GetRandomPaillierKey(c *gin.Context) {
+// ClaimPaillierKeys reserves PaillierClaimSize pool keys for a user and returns them once. The claim is
+// audited and the key material is removed from the pool before the keys are returned
+func ClaimPaillierKeys(c *gin.Context) {
+	userId := c.Param("userId")
+	claimId := uuid.New().String()
+
 	var DB *mongo.Client = ConnectDB()
 	paillierKeyCollection := DB.Database(MongoDatabase).Collection("PaillierKeyCollection")
-
+	claimCollection := DB.Database(MongoDatabase).Collection("PaillierClaimCollection")
 	defer CloseClientDB(DB)
 
-	paillierKeys, err := readRandomPaillierKeys(paillierKeyCollection)
+	now := time.Now().UTC()
+	var paillierKeys []PaillierKey
+	for len(paillierKeys) < PaillierClaimSize {
+		paillierKey, err := claimPaillierKey(userId, claimId, now, paillierKeyCollection)
+		if err == mongo.ErrNoDocuments {
+			// not enough keys, the reserved keys were never handed out and go back to the pool
+			releasePaillierClaim(claimId, paillierKeyCollection)
+			WriteErrorResponse(http.StatusServiceUnavailable, fmt.Sprintf("Error: %s", "Paillier key pool exhausted, retry later"), c.Writer)
+			return
+		} else if err != nil {
+			releasePaillierClaim(claimId, paillierKeyCollection)
+			WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+		paillierKeys = append(paillierKeys, paillierKey)
+	}
 
-	if err != nil {
-		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error getting paillier keys: %s", err), c.Writer)
-		return
+	err := writePaillierClaims(paillierClaimAudit(paillierKeys), claimCollection)
+	if err == nil {
+		err = deletePaillierClaim(claimId, paillierKeyCollection)
 	}
-	if len(paillierKeys) == 0 {
-		ValidateAndWriteResponse(SuccessDetails{
-			Message: "No paillier keys found",
-		}, err, c.Writer)
-		return
-	} else if len(paillierKeys) == 1 {
-		ValidateAndWriteResponse(SuccessDetails{
-			Message: "Only one paillier key found",
-		}, err, c.Writer)
+	if err != nil {
+		// claimed keys stay reserved and are not handed out again
+		log.Error("Error archiving paillier claim err:", err)
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
 		return
 	}
 
-	paillierKeysJSON, err := json.Marshal(paillierKeys)
+	ValidateAndWriteResponse(PaillierKeyClaimResponse{ClaimId: claimId, Keys: paillierKeys}, nil, c.Writer)
+	return
+}
+
+// GetPaillierKeyClaims returns the audit of the pool keys a user received
+func GetPaillierKeyClaims(c *gin.Context) {
+	userId := c.Param("userId")
+
+	var DB *mongo.Client = ConnectDB()
+	claimCollection := DB.Database(MongoDatabase).Collection("PaillierClaimCollection")
+	defer CloseClientDB(DB)
+
+	claims, err := readPaillierClaims(userId, claimCollection)
 	if err != nil {
-		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error json marshall: %s", err), c.Writer)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
 		return
 	}
 
-	log.Info("Paillier keys: ", string(paillierKeysJSON))
+	ValidateAndWriteResponse(claims, nil, c.Writer)
+	return
+}
 
-	ValidateAndWriteResponse(SuccessDetails{
-		Message: string(paillierKeysJSON),
-	}, err, c.Writer)
+// paillierClaimAudit returns the audit records of claimed keys, they hold the key ids but no key material
+func paillierClaimAudit(paillierKeys []PaillierKey) []PaillierKeyClaim {
+	claims := []PaillierKeyClaim{}
+	for _, paillierKey := range paillierKeys {
+		claims = append(claims, PaillierKeyClaim{
+			ClaimId:   paillierKey.ClaimId,
+			KeyId:     paillierKey.UniqueId,
+			UserId:    paillierKey.ClaimedBy,
+			ClaimedAt: paillierKey.ClaimedAt,
+		})
+	}
+	return claims
+}
 
-	return
+// sweepRecoveries periodically expires recoveries that made no progress before their expiry and drops the
+// replaced shares of re-sharing sessions past their rollback window
+func sweepRecoveries() {
+	for {
+		time.Sleep(RecoverySweepInterval)
+
+		var DB *mongo.Client = ConnectDB()
+		userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+		reshareCollection := DB.Database(MongoDatabase).Collection("ReshareCollection")
+
+		expired, err := expireRecoveryRecords(time.Now().UTC(), userCollection)
+		if err != nil {
+			log.Error("Error expiring recovery records err:", err)
+		} else if expired > 0 {
+			log.Info("Expired recovery records: ", expired)
+		}
+
+		purged, err := purgeReshareRollbacks(time.Now().UTC(), reshareCollection)
+		if err != nil {
+			log.Error("Error purging reshare rollbacks err:", err)
+		} else if purged > 0 {
+			log.Info("Purged reshare rollbacks: ", purged)
+		}
+
+		CloseClientDB(DB)
+	}
 }
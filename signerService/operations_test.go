@@ -2,7 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var tx = BasicTx{
@@ -41,3 +46,144 @@ func TestPrepareETHHash(t *testing.T) {
 		t.Error("Error calculating ETH hash")
 	}
 }
+
+func TestRecoveryUnlocked(t *testing.T) {
+	verifiedAt := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	record := RecoveryRecord{Status: CustomerVerified, VerifiedAt: verifiedAt, UnlockAt: verifiedAt.Add(48 * time.Hour), ExpiresAt: verifiedAt.Add(72 * time.Hour)}
+
+	if err := recoveryUnlocked(record, verifiedAt.Add(time.Hour)); err == nil {
+		t.Error("Shares should stay locked during the time lock")
+	}
+	if err := recoveryUnlocked(record, verifiedAt.Add(48*time.Hour)); err != nil {
+		t.Error("Shares should unlock after the time lock:", err)
+	}
+
+	if err := recoveryUnlocked(record, verifiedAt.Add(72*time.Hour)); err == nil {
+		t.Error("Shares should not be released after the recovery expired")
+	}
+
+	record.Status = MFAVerified
+	if err := recoveryUnlocked(record, verifiedAt.Add(72*time.Hour)); err == nil {
+		t.Error("Shares should stay locked until the customer is verified")
+	}
+
+	if err := recoveryUnlocked(RecoveryRecord{Status: CustomerVerified}, verifiedAt); err == nil {
+		t.Error("Records verified without a time lock should stay locked")
+	}
+}
+
+func TestRecoveryStatus(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	record := RecoveryRecord{Status: MFAVerified, CreatedAt: now, UpdatedAt: now, ExpiresAt: now.Add(RecoveryExpiry)}
+
+	status := recoveryStatus(record)
+	if status.Message != MFAVerified || status.ExpiresAt == nil || status.UnlockAt != nil || status.CreatedAt == nil {
+		t.Error("Unexpected status of an ongoing recovery:", status)
+	}
+
+	for _, ended := range []string{Complete, Rejected, Cancelled, Expired} {
+		record.Status = ended
+		if status := recoveryStatus(record); status.ExpiresAt != nil {
+			t.Error("Ended recoveries should not report an expiry:", ended)
+		}
+	}
+}
+
+func TestRecoveryAccounts(t *testing.T) {
+	accounts := []RecoveryAccount{{BlockchainId: "ETH", AccountName: "main"}, {BlockchainId: "SOL", AccountName: "main"}}
+	if err := validateRecoveryAccounts(accounts); err != nil {
+		t.Error("Distinct accounts should be accepted:", err)
+	}
+	if err := validateRecoveryAccounts(nil); err == nil {
+		t.Error("Recovery without accounts should be rejected")
+	}
+	if err := validateRecoveryAccounts(append(accounts, RecoveryAccount{BlockchainId: "ETH", AccountName: "main"})); err == nil {
+		t.Error("Accounts named twice should be rejected")
+	}
+	if err := validateRecoveryAccounts([]RecoveryAccount{{BlockchainId: "ETH"}}); err == nil {
+		t.Error("Accounts without a name should be rejected")
+	}
+
+	record := RecoveryRecord{Accounts: []RecoveryAccount{
+		{BlockchainId: "ETH", AccountName: "main", Status: RecoveryAccountReleased},
+		{BlockchainId: "SOL", AccountName: "main", Status: RecoveryAccountPending},
+	}}
+	if err := recoveryCoversAccount(record, "SOL", "main"); err != nil {
+		t.Error("Named account should be covered:", err)
+	}
+	if err := recoveryCoversAccount(record, "BTC", "main"); err == nil {
+		t.Error("Accounts outside the recovery should not be released")
+	}
+	if err := recoveryCoversAccount(record, "ETH", "main"); err == nil {
+		t.Error("Released share should not be released again")
+	}
+}
+
+func TestPaillierClaimAudit(t *testing.T) {
+	claimedAt := time.Now().UTC()
+	paillierKeys := []PaillierKey{
+		{UniqueId: "key-1", PaillierKeyData: "secret-1", Status: PaillierKeyClaimed, ClaimId: "claim-1", ClaimedBy: "user-1", ClaimedAt: claimedAt},
+		{UniqueId: "key-2", PaillierKeyData: "secret-2", Status: PaillierKeyClaimed, ClaimId: "claim-1", ClaimedBy: "user-1", ClaimedAt: claimedAt},
+	}
+
+	claims := paillierClaimAudit(paillierKeys)
+	if len(claims) != 2 {
+		t.Fatalf("Audit has %d records, expected 2", len(claims))
+	}
+	for i, claim := range claims {
+		if claim.KeyId != paillierKeys[i].UniqueId || claim.UserId != "user-1" || claim.ClaimId != "claim-1" || !claim.ClaimedAt.Equal(claimedAt) {
+			t.Errorf("Audit record %d does not match the claimed key: %+v", i, claim)
+		}
+	}
+
+	auditJSON, _ := json.Marshal(claims)
+	if strings.Contains(string(auditJSON), "secret") {
+		t.Error("Audit records contain key material")
+	}
+}
+
+func TestCreateRecoveryRecordConcurrentStart(t *testing.T) {
+	account := bson.D{{"userId", "user1"}, {"blockchainId", "ETH"}, {"accountName", "main"}, {"recordType", "AccountData"}}
+	userCollection, mock := newMockCollection(t, cursorResponse(), cursorResponse(account), duplicateKeyResponse())
+
+	// the ongoing record of a concurrent request is only visible to the unique index
+	err := createRecoveryRecord("user1", RecoveryModeExport, "", []RecoveryAccount{{BlockchainId: "ETH", AccountName: "main"}}, userCollection)
+	if err == nil || !strings.Contains(err.Error(), "already started") {
+		t.Error("Second ongoing recovery should be rejected:", err)
+	}
+	documents, _ := mock.command(2).Lookup("documents").Array().Values()
+	if ongoing, ok := documents[0].Document().Lookup("ongoing").BooleanOK(); !ok || !ongoing {
+		t.Error("New recovery should be marked ongoing")
+	}
+}
+
+func TestEndedRecoveryIsNotOngoing(t *testing.T) {
+	userCollection, mock := newMockCollection(t, updatedResponse(1), updatedResponse(1))
+	evidence := RecoveryEvidence{Status: Rejected, Method: EvidenceOperatorRejection, VerifiedAt: time.Now().UTC()}
+
+	if err := advanceRecoveryRecord("user1", MFAVerified, Rejected, evidence, userCollection); err != nil {
+		t.Fatal(err)
+	}
+	if err := endRecoveryRecord("user1", Cancelled, evidence, userCollection); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		updates, _ := mock.command(i).Lookup("updates").Array().Values()
+		if _, err := updates[0].Document().Lookup("u", "$unset").Document().LookupErr("ongoing"); err != nil {
+			t.Error("Ended recovery should no longer be ongoing")
+		}
+	}
+}
+
+func TestMarkRecoveryAccountOnce(t *testing.T) {
+	userCollection, _ := newMockCollection(t, updatedResponse(1), updatedResponse(0))
+	now := time.Now().UTC()
+
+	if err := markRecoveryAccount(primitive.NewObjectID(), "ETH", "main", RecoveryAccountReleased, now, userCollection); err != nil {
+		t.Fatal(err)
+	}
+	// the second release of the same share matches no pending account
+	if markRecoveryAccount(primitive.NewObjectID(), "ETH", "main", RecoveryAccountReleased, now, userCollection) == nil {
+		t.Error("Share released twice")
+	}
+}
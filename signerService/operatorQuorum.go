@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Operator roles, only recovery approvers count towards the quorum
+const (
+	OperatorRoleApprover = "recoveryApprover"
+	OperatorRoleAuditor  = "auditor"
+)
+
+// Operator decisions on a recovery record
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+)
+
+// Operators is the registry of recovery operators loaded at startup from OPERATOR_REGISTRY_FILE,
+// without a registry no recovery can reach customerVerified
+var Operators OperatorRegistry = loadOperatorRegistry()
+
+func loadOperatorRegistry() OperatorRegistry {
+	path, ok := os.LookupEnv("OPERATOR_REGISTRY_FILE")
+	if !ok {
+		log.Warn("missing environment variable: OPERATOR_REGISTRY_FILE, recovery approval is disabled")
+		return OperatorRegistry{}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal("Error reading operator registry err:", err)
+	}
+	registry, err := parseOperatorRegistry(data)
+	if err != nil {
+		log.Fatal("Error loading operator registry err:", err)
+	}
+	return registry
+}
+
+// parseOperatorRegistry decodes and validates an operator registry config, the quorum must be reachable
+// by the registered approvers
+func parseOperatorRegistry(data []byte) (OperatorRegistry, error) {
+	var registry OperatorRegistry
+	err := json.Unmarshal(data, &registry)
+	if err != nil {
+		return registry, err
+	}
+
+	approvers := 0
+	ids := make(map[string]bool)
+	for _, operator := range registry.Operators {
+		if operator.OperatorId == "" || ids[operator.OperatorId] {
+			return registry, fmt.Errorf("missing or duplicate operator id: %q", operator.OperatorId)
+		}
+		ids[operator.OperatorId] = true
+
+		if operator.Role != OperatorRoleApprover && operator.Role != OperatorRoleAuditor {
+			return registry, fmt.Errorf("invalid role %s of operator %s", operator.Role, operator.OperatorId)
+		}
+		if operator.Role == OperatorRoleApprover {
+			approvers++
+		}
+
+		_, err = parseEDDSAPublicKey(operator.PublicKey)
+		if err != nil {
+			return registry, fmt.Errorf("invalid public key of operator %s: %s", operator.OperatorId, err)
+		}
+	}
+
+	if registry.Quorum < 1 || registry.Quorum > approvers {
+		return registry, fmt.Errorf("quorum %d is not reachable with %d approvers", registry.Quorum, approvers)
+	}
+
+	return registry, nil
+}
+
+// DecideRecovery stores the signed approval or rejection of an operator on a recovery record, the
+// record moves to customerVerified once the quorum of approvals is met and to rejected on any rejection
+func DecideRecovery(c *gin.Context) {
+	userId := c.Param("userId")
+
+	var request RecoveryDecisionRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&request)
+	if err != nil {
+		log.Error("Error decoding recovery decision: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	defer CloseClientDB(DB)
+
+	recoveryRecord, err := readRecoveryRecord(userId, userCollection)
+	if err != nil {
+		log.Error("Error getting recovery record err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Recovery not initiated"), c.Writer)
+		return
+	}
+	if recoveryRecord.Status != MFAVerified {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Recovery is not awaiting operator approval"), c.Writer)
+		return
+	}
+
+	decision, err := verifyOperatorDecision(Operators, recoveryRecord, request, time.Now().UTC())
+	if err != nil {
+		log.Error("Error verifying operator decision err:", err)
+		WriteErrorResponse(http.StatusUnauthorized, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	err = addRecoveryDecision(userId, decision, userCollection)
+	if err != nil {
+		log.Error("Error saving operator decision err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	err = applyRecoveryDecision(userId, decision, Operators.Quorum, userCollection)
+	if err != nil {
+		log.Error("Error updating recovery record err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(SuccessDetails{
+		Message: "Success",
+	}, nil, c.Writer)
+	return
+}
+
+// applyRecoveryDecision moves the recovery record after a stored decision, to rejected on a rejection and to
+// customerVerified once the quorum of approvals is met
+func applyRecoveryDecision(userId string, decision OperatorDecision, quorum int, userCollection *mongo.Collection) error {
+	// count the decisions stored so far, approvals of other operators may have arrived concurrently
+	recoveryRecord, err := readRecoveryRecord(userId, userCollection)
+	if err != nil {
+		return err
+	}
+
+	if decision.Decision == DecisionReject {
+		evidence := RecoveryEvidence{Status: Rejected, Method: EvidenceOperatorRejection, VerifiedAt: decision.DecidedAt}
+		return advanceRecoveryRecord(userId, MFAVerified, Rejected, evidence, userCollection)
+	}
+	if recoveryRejected(recoveryRecord.Decisions) {
+		return fmt.Errorf("Recovery was rejected by an operator")
+	}
+	if !recoveryQuorumReached(recoveryRecord.Decisions, quorum) {
+		return nil
+	}
+
+	evidence := RecoveryEvidence{Status: CustomerVerified, Method: EvidenceOperatorQuorum, VerifiedAt: decision.DecidedAt}
+	err = advanceRecoveryRecord(userId, MFAVerified, CustomerVerified, evidence, userCollection)
+	if err != nil {
+		// a concurrent last approval may have verified the record first, the stored decision counted towards it
+		current, readErr := readRecoveryRecord(userId, userCollection)
+		if readErr == nil && current.Status == CustomerVerified {
+			return nil
+		}
+	}
+	return err
+}
+
+// verifyOperatorDecision checks that a registered approver signed the decision for this recovery record
+func verifyOperatorDecision(registry OperatorRegistry, recoveryRecord RecoveryRecord, request RecoveryDecisionRequest, now time.Time) (OperatorDecision, error) {
+	if request.Decision != DecisionApprove && request.Decision != DecisionReject {
+		return OperatorDecision{}, fmt.Errorf("invalid decision: %s", request.Decision)
+	}
+
+	operator, err := lookupApprover(registry, request.OperatorId)
+	if err != nil {
+		return OperatorDecision{}, err
+	}
+	for _, decision := range recoveryRecord.Decisions {
+		if decision.OperatorId == operator.OperatorId {
+			return OperatorDecision{}, fmt.Errorf("operator %s already decided", operator.OperatorId)
+		}
+	}
+
+	pk, err := parseEDDSAPublicKey(operator.PublicKey)
+	if err != nil {
+		return OperatorDecision{}, err
+	}
+	sig, err := parseEDDSASignature(request.Signature)
+	if err != nil {
+		return OperatorDecision{}, err
+	}
+	if !ed25519.Verify(pk, recoveryDecisionMessage(recoveryRecord, request.Decision), sig) {
+		return OperatorDecision{}, fmt.Errorf("invalid operator signature")
+	}
+
+	return OperatorDecision{
+		OperatorId: operator.OperatorId,
+		Role:       operator.Role,
+		Decision:   request.Decision,
+		Signature:  request.Signature,
+		DecidedAt:  now,
+	}, nil
+}
+
+// lookupApprover returns the registered operator with the recovery approver role
+func lookupApprover(registry OperatorRegistry, operatorId string) (Operator, error) {
+	for _, operator := range registry.Operators {
+		if operator.OperatorId == operatorId && operator.Role == OperatorRoleApprover {
+			return operator, nil
+		}
+	}
+	return Operator{}, fmt.Errorf("operator %s is not a recovery approver", operatorId)
+}
+
+// recoveryDecisionMessage is the message signed by an operator, it binds the decision to one recovery record,
+// the accounts it covers and to the new device of a reshare recovery
+func recoveryDecisionMessage(recoveryRecord RecoveryRecord, decision string) []byte {
+	var accounts []string
+	for _, account := range recoveryRecord.Accounts {
+		accounts = append(accounts, account.BlockchainId+"/"+account.AccountName)
+	}
+	sort.Strings(accounts)
+
+	message := fmt.Sprintf("signerService recovery %s\nuserId: %s\nrecordId: %s\ncreatedAt: %s\naccounts: %s", decision, recoveryRecord.UserId,
+		recoveryRecord.ID.Hex(), recoveryRecord.CreatedAt.UTC().Format(time.RFC3339Nano), strings.Join(accounts, ","))
+	if recoveryRecord.DeviceKey != "" {
+		message += fmt.Sprintf("\ndeviceKey: %s", recoveryRecord.DeviceKey)
+	}
+	return []byte(message)
+}
+
+// recoveryRejected reports whether any operator rejected a recovery
+func recoveryRejected(decisions []OperatorDecision) bool {
+	for _, decision := range decisions {
+		if decision.Decision == DecisionReject {
+			return true
+		}
+	}
+	return false
+}
+
+// recoveryQuorumReached reports whether enough distinct approvers approved a recovery
+func recoveryQuorumReached(decisions []OperatorDecision, quorum int) bool {
+	approvers := make(map[string]bool)
+	for _, decision := range decisions {
+		if decision.Decision == DecisionApprove && decision.Role == OperatorRoleApprover {
+			approvers[decision.OperatorId] = true
+		}
+	}
+
+	return quorum > 0 && len(approvers) >= quorum
+}
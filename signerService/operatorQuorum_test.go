@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseOperatorRegistry(t *testing.T) {
+	pk, _, _ := ed25519.GenerateKey(rand.Reader)
+	operator := func(id, role string) string {
+		return fmt.Sprintf(`{"operatorId":%q,"role":%q,"publicKey":%q}`, id, role, hex.EncodeToString(pk))
+	}
+
+	registry, err := parseOperatorRegistry([]byte(fmt.Sprintf(`{"quorum":2,"operators":[%s,%s,%s]}`,
+		operator("op1", OperatorRoleApprover), operator("op2", OperatorRoleApprover), operator("audit", OperatorRoleAuditor))))
+	if err != nil || registry.Quorum != 2 || len(registry.Operators) != 3 {
+		t.Error("Valid registry should load:", err)
+	}
+
+	invalid := []string{
+		fmt.Sprintf(`{"quorum":2,"operators":[%s,%s]}`, operator("op1", OperatorRoleApprover), operator("audit", OperatorRoleAuditor)),
+		fmt.Sprintf(`{"quorum":1,"operators":[%s,%s]}`, operator("op1", OperatorRoleApprover), operator("op1", OperatorRoleApprover)),
+		fmt.Sprintf(`{"quorum":1,"operators":[%s]}`, operator("op1", "admin")),
+		fmt.Sprintf(`{"quorum":0,"operators":[%s]}`, operator("op1", OperatorRoleApprover)),
+		`{"quorum":1,"operators":[{"operatorId":"op1","role":"recoveryApprover","publicKey":"abcd"}]}`,
+	}
+	for _, data := range invalid {
+		if _, err := parseOperatorRegistry([]byte(data)); err == nil {
+			t.Error("Invalid registry should be rejected:", data)
+		}
+	}
+}
+
+func TestVerifyOperatorDecision(t *testing.T) {
+	approverPK, approverSK, _ := ed25519.GenerateKey(rand.Reader)
+	auditorPK, auditorSK, _ := ed25519.GenerateKey(rand.Reader)
+	registry := OperatorRegistry{Quorum: 1, Operators: []Operator{
+		{OperatorId: "op1", Role: OperatorRoleApprover, PublicKey: hex.EncodeToString(approverPK)},
+		{OperatorId: "audit", Role: OperatorRoleAuditor, PublicKey: hex.EncodeToString(auditorPK)},
+	}}
+	now := time.Now().UTC()
+	accounts := []RecoveryAccount{{BlockchainId: "SOL", AccountName: "main"}, {BlockchainId: "ETH", AccountName: "main"}}
+	record := RecoveryRecord{ID: primitive.NewObjectID(), UserId: "user1", Status: MFAVerified, Accounts: accounts, CreatedAt: now}
+
+	sign := func(sk ed25519.PrivateKey, record RecoveryRecord, decision string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(sk, recoveryDecisionMessage(record, decision)))
+	}
+
+	decision, err := verifyOperatorDecision(registry, record, RecoveryDecisionRequest{OperatorId: "op1", Decision: DecisionApprove, Signature: sign(approverSK, record, DecisionApprove)}, now)
+	if err != nil || decision.OperatorId != "op1" || decision.Decision != DecisionApprove || decision.Role != OperatorRoleApprover {
+		t.Error("Signed approval should verify:", err)
+	}
+
+	otherRecord := RecoveryRecord{ID: primitive.NewObjectID(), UserId: "user1"}
+	// an approval of a reshare recovery is bound to the new device key
+	otherDevice := record
+	otherDevice.DeviceKey = "02" + strings.Repeat("ab", 32)
+	// and to the accounts the record covers when it was approved
+	otherAccounts := record
+	otherAccounts.Accounts = append([]RecoveryAccount{{BlockchainId: "BTC", AccountName: "main"}}, accounts...)
+	otherCreation := record
+	otherCreation.CreatedAt = now.Add(-time.Hour)
+	invalid := []RecoveryDecisionRequest{
+		{OperatorId: "op1", Decision: DecisionApprove, Signature: sign(approverSK, otherRecord, DecisionApprove)},
+		{OperatorId: "op1", Decision: DecisionApprove, Signature: sign(approverSK, otherDevice, DecisionApprove)},
+		{OperatorId: "op1", Decision: DecisionApprove, Signature: sign(approverSK, otherAccounts, DecisionApprove)},
+		{OperatorId: "op1", Decision: DecisionApprove, Signature: sign(approverSK, otherCreation, DecisionApprove)},
+		{OperatorId: "op1", Decision: DecisionApprove, Signature: sign(approverSK, record, DecisionReject)},
+		{OperatorId: "audit", Decision: DecisionApprove, Signature: sign(auditorSK, record, DecisionApprove)},
+		{OperatorId: "unknown", Decision: DecisionApprove, Signature: sign(approverSK, record, DecisionApprove)},
+		{OperatorId: "op1", Decision: "skip", Signature: sign(approverSK, record, "skip")},
+	}
+	for _, request := range invalid {
+		if _, err := verifyOperatorDecision(registry, record, request, now); err == nil {
+			t.Error("Decision should be rejected:", request.OperatorId, request.Decision)
+		}
+	}
+
+	record.Decisions = []OperatorDecision{decision}
+	if _, err := verifyOperatorDecision(registry, record, RecoveryDecisionRequest{OperatorId: "op1", Decision: DecisionReject, Signature: sign(approverSK, record, DecisionReject)}, now); err == nil {
+		t.Error("An operator should only decide once")
+	}
+}
+
+func TestRecoveryQuorumReached(t *testing.T) {
+	decisions := []OperatorDecision{
+		{OperatorId: "op1", Role: OperatorRoleApprover, Decision: DecisionApprove},
+		{OperatorId: "op1", Role: OperatorRoleApprover, Decision: DecisionApprove},
+		{OperatorId: "audit", Role: OperatorRoleAuditor, Decision: DecisionApprove},
+		{OperatorId: "op2", Role: OperatorRoleApprover, Decision: DecisionReject},
+	}
+	if recoveryQuorumReached(decisions, 2) {
+		t.Error("Duplicate, auditor and rejecting decisions should not count towards the quorum")
+	}
+
+	decisions = append(decisions, OperatorDecision{OperatorId: "op3", Role: OperatorRoleApprover, Decision: DecisionApprove})
+	if !recoveryQuorumReached(decisions, 2) {
+		t.Error("Two distinct approvers should reach a quorum of 2")
+	}
+	if recoveryQuorumReached(decisions, 0) {
+		t.Error("A missing quorum should never be reached")
+	}
+}
+
+func TestRecoveryRejected(t *testing.T) {
+	decisions := []OperatorDecision{
+		{OperatorId: "op1", Role: OperatorRoleApprover, Decision: DecisionApprove},
+		{OperatorId: "op2", Role: OperatorRoleApprover, Decision: DecisionApprove},
+	}
+	if recoveryRejected(decisions) {
+		t.Error("Approvals should not reject a recovery")
+	}
+	if !recoveryRejected(append(decisions, OperatorDecision{OperatorId: "op3", Role: OperatorRoleApprover, Decision: DecisionReject})) {
+		t.Error("A stored rejection should reject the recovery")
+	}
+}
+
+func TestAdvanceRecoveryRecordExcludesRejected(t *testing.T) {
+	userCollection, mock := newMockCollection(t, updatedResponse(0))
+	evidence := RecoveryEvidence{Status: CustomerVerified, Method: EvidenceOperatorQuorum, VerifiedAt: time.Now().UTC()}
+
+	// the record matched no document since a rejection was stored concurrently
+	if advanceRecoveryRecord("user1", MFAVerified, CustomerVerified, evidence, userCollection) == nil {
+		t.Error("Rejected recovery should not be verified")
+	}
+	update, _ := mock.command(0).Lookup("updates").Array().Values()
+	filter := update[0].Document().Lookup("q").Document()
+	if filter.Lookup("decisions.decision", "$ne").StringValue() != DecisionReject {
+		t.Error("Advance filter should exclude records with a rejection:", filter)
+	}
+}
+
+func TestRecoveryDecisionMessageSortsAccounts(t *testing.T) {
+	record := RecoveryRecord{ID: primitive.NewObjectID(), UserId: "user1", Accounts: []RecoveryAccount{{BlockchainId: "SOL", AccountName: "main"}, {BlockchainId: "ETH", AccountName: "main"}}}
+	reordered := record
+	reordered.Accounts = []RecoveryAccount{record.Accounts[1], record.Accounts[0]}
+
+	if string(recoveryDecisionMessage(record, DecisionApprove)) != string(recoveryDecisionMessage(reordered, DecisionApprove)) {
+		t.Error("Decision message should not depend on the order of the accounts")
+	}
+}
+
+func TestApplyRecoveryDecisionConcurrentQuorum(t *testing.T) {
+	decisions := []OperatorDecision{
+		{OperatorId: "op1", Role: OperatorRoleApprover, Decision: DecisionApprove},
+		{OperatorId: "op2", Role: OperatorRoleApprover, Decision: DecisionApprove},
+	}
+	awaiting := RecoveryRecord{UserId: "user1", Status: MFAVerified, Decisions: decisions, RecordType: Recovery}
+	verified := awaiting
+	verified.Status = CustomerVerified
+
+	// the other last approval verified the record between reading the decisions and the status update
+	userCollection, _ := newMockCollection(t, cursorResponse(awaiting), updatedResponse(0), cursorResponse(verified))
+	if err := applyRecoveryDecision("user1", decisions[1], 2, userCollection); err != nil {
+		t.Error("Decision counted towards a concurrently reached quorum should succeed:", err)
+	}
+
+	userCollection, _ = newMockCollection(t, cursorResponse(awaiting), updatedResponse(0), cursorResponse(awaiting))
+	if applyRecoveryDecision("user1", decisions[1], 2, userCollection) == nil {
+		t.Error("Failed status update should be reported")
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Paillier pool sizing, the pool is refilled to PAILLIER_POOL_TARGET once it drops below
+// PAILLIER_POOL_LOW_WATER. Keys are generated by up to PAILLIER_POOL_WORKERS workers, one per CPU by default
+var (
+	PaillierPoolTarget   = getPoolSize("PAILLIER_POOL_TARGET", 100)
+	PaillierPoolLowWater = getPoolSize("PAILLIER_POOL_LOW_WATER", 20)
+	PaillierPoolWorkers  = getPoolSize("PAILLIER_POOL_WORKERS", runtime.NumCPU())
+)
+
+const (
+	PaillierPoolInterval   = 30 * time.Second // wait time between pool depth checks of an idle or standby generator
+	PaillierLeaseDuration  = 5 * time.Minute  // generator lease, renewed before every batch
+	PaillierBackoffInitial = time.Second
+	PaillierBackoffMax     = 5 * time.Minute
+	PaillierRateWindow     = 10 * time.Minute // window of the reported generation rate
+	PaillierGeneratorLease = "paillierGenerator"
+)
+
+// paillierPool is the state of the pool generator of this replica
+type paillierPool struct {
+	sync.Mutex
+	owner     string      // lease owner identifier of this replica
+	leader    bool        // this replica holds the generator lease
+	refilling bool        // the pool dropped below the low-water mark and is not yet at target
+	depth     int64       // pool depth at the last check
+	generated int64       // keys generated by this replica
+	failures  int         // consecutive failures, reset by a successful batch
+	lastError string      // last generation or DB error
+	retryAt   time.Time   // end of the current backoff
+	recent    []time.Time // generation times within the rate window
+}
+
+var PaillierPool = newPaillierPool()
+
+func newPaillierPool() *paillierPool {
+	hostname, _ := os.Hostname()
+	return &paillierPool{owner: hostname + "-" + uuid.New().String()}
+}
+
+// generatePaillierKeys keeps the Paillier key pool between the low-water mark and the target size.
+// Only the replica holding the generator lease generates keys, errors back off exponentially
+func generatePaillierKeys() {
+	if PaillierPoolLowWater > PaillierPoolTarget {
+		log.Fatal("invalid environment variable: PAILLIER_POOL_LOW_WATER is above PAILLIER_POOL_TARGET")
+	}
+
+	for {
+		wait := PaillierPool.run()
+		time.Sleep(wait)
+	}
+}
+
+// migratePaillierKeys encrypts the paillier keys written before encryption at rest, it retries with backoff until both collections are migrated
+func migratePaillierKeys() {
+	for failures := 0; ; {
+		var DB *mongo.Client = ConnectDB()
+		var migrated int
+		var err error
+		for _, collection := range []string{"PaillierKeyCollection", "UserCollection"} {
+			var count int
+			count, err = encryptPlaintextPaillierKeys(DB.Database(MongoDatabase).Collection(collection))
+			migrated += count
+			if err != nil {
+				break
+			}
+		}
+		CloseClientDB(DB)
+
+		if err == nil {
+			log.Info("Encrypted plaintext paillier keys: ", migrated)
+			return
+		}
+		failures++
+		log.Error("Error encrypting plaintext paillier keys err:", err)
+		time.Sleep(paillierBackoff(failures))
+	}
+}
+
+// run checks the pool once, generates a batch of keys when the pool needs refilling and returns the wait before the next run
+func (pool *paillierPool) run() time.Duration {
+	var DB *mongo.Client = ConnectDB()
+	defer CloseClientDB(DB)
+	paillierKeyCollection := DB.Database(MongoDatabase).Collection("PaillierKeyCollection")
+	leaseCollection := DB.Database(MongoDatabase).Collection("LeaseCollection")
+
+	now := time.Now().UTC()
+	leader, err := acquireLease(PaillierGeneratorLease, pool.owner, now, PaillierLeaseDuration, leaseCollection)
+	if err != nil {
+		return pool.failed(err, now)
+	}
+	pool.setLeader(leader)
+	if !leader {
+		return PaillierPoolInterval
+	}
+
+	depth, err := countPaillierKeys(paillierKeyCollection)
+	if err != nil {
+		return pool.failed(err, now)
+	}
+	count := pool.keysToGenerate(depth)
+	if count == 0 {
+		return PaillierPoolInterval
+	}
+	if count > PaillierPoolWorkers {
+		count = PaillierPoolWorkers
+	}
+
+	err = generatePaillierBatch(count, paillierKeyCollection, pool.generatedKey)
+	if err != nil {
+		return pool.failed(err, time.Now().UTC())
+	}
+	pool.succeeded()
+	return 0
+}
+
+// generatePaillierBatch generates count pool keys concurrently and returns the first error
+func generatePaillierBatch(count int, paillierKeyCollection *mongo.Collection, generated func(time.Time)) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, count)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			paillierKey, err := ECDSAWalletService.CreatePaillierKeyPair()
+			if err != nil {
+				log.Error("Error creating paillier key", err)
+				errs <- err
+				return
+			}
+
+			keyData := PaillierKey{
+				UniqueId:        uuid.New().String(),
+				PaillierKeyData: paillierKey,
+				Status:          PaillierKeyAvailable,
+			}
+			err = writePaillierKey(keyData, paillierKeyCollection)
+			if err != nil {
+				log.Error("Error writing paillier key error:", err)
+				errs <- err
+				return
+			}
+			generated(time.Now().UTC())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+// keysToGenerate returns the keys missing from the target once the pool dropped below the low-water mark
+func (pool *paillierPool) keysToGenerate(depth int64) int {
+	pool.Lock()
+	defer pool.Unlock()
+
+	pool.depth = depth
+	if depth < int64(PaillierPoolLowWater) {
+		pool.refilling = true
+	}
+	if depth >= int64(PaillierPoolTarget) {
+		pool.refilling = false
+	}
+	if !pool.refilling {
+		return 0
+	}
+	return int(int64(PaillierPoolTarget) - depth)
+}
+
+func (pool *paillierPool) setLeader(leader bool) {
+	pool.Lock()
+	defer pool.Unlock()
+	if leader != pool.leader {
+		log.Info("Paillier pool generator lease held: ", leader)
+	}
+	pool.leader = leader
+}
+
+func (pool *paillierPool) generatedKey(at time.Time) {
+	pool.Lock()
+	defer pool.Unlock()
+	pool.generated++
+	pool.depth++
+	pool.recent = append(pool.recent, at)
+	pool.pruneRecent(at)
+}
+
+// pruneRecent drops generation times before the rate window, callers hold the lock
+func (pool *paillierPool) pruneRecent(now time.Time) {
+	start := now.Add(-PaillierRateWindow)
+	recent := pool.recent[:0]
+	for _, at := range pool.recent {
+		if at.After(start) {
+			recent = append(recent, at)
+		}
+	}
+	pool.recent = recent
+}
+
+func (pool *paillierPool) succeeded() {
+	pool.Lock()
+	defer pool.Unlock()
+	pool.failures = 0
+	pool.retryAt = time.Time{}
+}
+
+// failed records an error and returns the backoff before the next run
+func (pool *paillierPool) failed(err error, now time.Time) time.Duration {
+	pool.Lock()
+	defer pool.Unlock()
+	pool.failures++
+	pool.lastError = err.Error()
+	backoff := paillierBackoff(pool.failures)
+	pool.retryAt = now.Add(backoff)
+	log.Error("Error refilling paillier pool, retry in ", backoff, " err:", err)
+	return backoff
+}
+
+// paillierBackoff doubles the wait after each consecutive failure up to PaillierBackoffMax
+func paillierBackoff(failures int) time.Duration {
+	backoff := PaillierBackoffInitial
+	for i := 1; i < failures && backoff < PaillierBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > PaillierBackoffMax {
+		return PaillierBackoffMax
+	}
+	return backoff
+}
+
+// status returns the pool status of this replica, the generation rate is in keys per minute over the rate window
+func (pool *paillierPool) status(now time.Time) PaillierPoolStatus {
+	pool.Lock()
+	defer pool.Unlock()
+
+	pool.pruneRecent(now)
+
+	status := PaillierPoolStatus{
+		Depth:          pool.depth,
+		Target:         PaillierPoolTarget,
+		LowWater:       PaillierPoolLowWater,
+		Workers:        PaillierPoolWorkers,
+		Leader:         pool.leader,
+		Refilling:      pool.refilling,
+		Generated:      pool.generated,
+		GenerationRate: float64(len(pool.recent)) / PaillierRateWindow.Minutes(),
+		Failures:       pool.failures,
+		LastError:      pool.lastError,
+	}
+	if !pool.retryAt.IsZero() {
+		retryAt := pool.retryAt
+		status.RetryAt = &retryAt
+	}
+	return status
+}
+
+// GetPaillierPoolStatus returns the depth of the Paillier key pool and the generator status of the replica
+func GetPaillierPoolStatus(c *gin.Context) {
+	var DB *mongo.Client = ConnectDB()
+	paillierKeyCollection := DB.Database(MongoDatabase).Collection("PaillierKeyCollection")
+	defer CloseClientDB(DB)
+
+	depth, err := countPaillierKeys(paillierKeyCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	status := PaillierPool.status(time.Now().UTC())
+	status.Depth = depth
+
+	ValidateAndWriteResponse(status, nil, c.Writer)
+	return
+}
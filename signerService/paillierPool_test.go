@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPaillierKeysToGenerate(t *testing.T) {
+	pool := newPaillierPool()
+
+	// above the low-water mark nothing is generated until the pool drops below it
+	if count := pool.keysToGenerate(int64(PaillierPoolLowWater)); count != 0 {
+		t.Errorf("Generating %d keys above the low-water mark", count)
+	}
+	if count := pool.keysToGenerate(int64(PaillierPoolLowWater) - 1); count != PaillierPoolTarget-PaillierPoolLowWater+1 {
+		t.Errorf("Refill generates %d keys", count)
+	}
+	// the refill continues above the low-water mark until the target is reached
+	if count := pool.keysToGenerate(int64(PaillierPoolTarget) - 1); count != 1 {
+		t.Errorf("Refill stopped before the target, %d keys", count)
+	}
+	if count := pool.keysToGenerate(int64(PaillierPoolTarget)); count != 0 || pool.refilling {
+		t.Error("Refill continues at the target")
+	}
+	if count := pool.keysToGenerate(int64(PaillierPoolTarget) - 1); count != 0 {
+		t.Error("Refill restarted above the low-water mark")
+	}
+}
+
+func TestPaillierBackoff(t *testing.T) {
+	for failures, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 20: PaillierBackoffMax, 100: PaillierBackoffMax} {
+		if backoff := paillierBackoff(failures); backoff != expected {
+			t.Errorf("Backoff after %d failures is %s, expected %s", failures, backoff, expected)
+		}
+	}
+}
+
+func TestPaillierPoolStatus(t *testing.T) {
+	pool := newPaillierPool()
+	now := time.Now().UTC()
+
+	pool.generatedKey(now.Add(-2 * PaillierRateWindow))
+	for i := 0; i < 5; i++ {
+		pool.generatedKey(now.Add(-time.Minute))
+	}
+	pool.failed(fmt.Errorf("db unavailable"), now)
+
+	status := pool.status(now)
+	if status.Generated != 6 {
+		t.Errorf("Generated %d keys, expected 6", status.Generated)
+	}
+	if status.GenerationRate != 5/PaillierRateWindow.Minutes() {
+		t.Errorf("Generation rate %f does not count keys in the rate window", status.GenerationRate)
+	}
+	if status.Failures != 1 || status.RetryAt == nil || !status.RetryAt.Equal(now.Add(PaillierBackoffInitial)) {
+		t.Error("Failure backoff not reported")
+	}
+
+	pool.succeeded()
+	if status := pool.status(now); status.Failures != 0 || status.RetryAt != nil {
+		t.Error("Backoff not reset after success")
+	}
+}
+
+func TestPaillierKeyEncryptionAtRest(t *testing.T) {
+	// keys written before encryption at rest are handed out as stored
+	legacy := PaillierKey{UniqueId: "key-1", PaillierKeyData: `{"N":1}`}
+	if err := decryptPaillierKey(&legacy); err != nil || legacy.PaillierKeyData != `{"N":1}` {
+		t.Error("Plaintext paillier key not passed through")
+	}
+
+	// failed generations have no secret to encrypt
+	failed := PaillierKey{UniqueId: "key-2", Error: "generation failed"}
+	if err := encryptPaillierKey(&failed); err != nil || failed.EncryptedKey != nil {
+		t.Error("Empty paillier key encrypted")
+	}
+
+	keyJSON, _ := json.Marshal(PaillierKey{UniqueId: "key-3", EncryptedKey: []string{"ciphertext"}})
+	if strings.Contains(string(keyJSON), "ciphertext") {
+		t.Error("Encrypted paillier key exposed in api responses")
+	}
+}
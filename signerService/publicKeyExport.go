@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BIP32 extended public key version bytes, xpub on mainnet and tpub on testnet
+var xpubVersions = map[string]uint32{
+	Mainnet: 0x0488b21e,
+	Testnet: 0x043587cf,
+}
+
+// Object identifiers of the SubjectPublicKeyInfo of a secp256k1 public key
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSecp256k1      = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+// subjectPublicKeyInfo is the X.509 SubjectPublicKeyInfo structure, x509 only marshals the NIST curves
+type subjectPublicKeyInfo struct {
+	Algorithm algorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.ObjectIdentifier
+}
+
+// GetPublicKey returns the group public key of an account in the common public key encodings,
+// the key and chain code are read from the account record so the secret share is never decrypted
+func GetPublicKey(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+	derivationPath := c.Query("derivationPath")
+
+	curve, err := signatureCurve(blockchainId)
+	if err != nil {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	defer CloseClientDB(DB)
+
+	account, err := readAccount(userId, blockchainId, accountName, userCollection)
+	if err != nil {
+		log.Error("Error reading account err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	if account.PublicKey == "" {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: account %s has no stored public key", accountName), c.Writer)
+		return
+	}
+
+	var export PublicKeyExport
+	if curve == CurveEd25519 {
+		if derivationPath != "" {
+			WriteErrorResponse(http.StatusBadRequest, "Error: derivation is not supported for eddsa accounts", c.Writer)
+			return
+		}
+
+		pk, err := parseEDDSAPublicKey(account.PublicKey)
+		if err != nil {
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+		export = exportEDDSAPublicKey(pk)
+	} else {
+		export, err = exportECDSAPublicKey(account.PublicKey, account.ChainCode, derivationPath)
+		if err != nil {
+			log.Error("Error exporting public key err:", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+	}
+
+	ValidateAndWriteResponse(export, nil, c.Writer)
+	return
+}
+
+// exportECDSAPublicKey returns the SEC1, PEM, JWK and xpub encodings of the account public key or of its
+// non-hardened child at the derivation path
+func exportECDSAPublicKey(publicKey, chainCodeHex, derivationPath string) (PublicKeyExport, error) {
+	if derivationPath == "" {
+		derivationPath = "m"
+	}
+	indexes, err := parseDerivationPath(derivationPath)
+	if err != nil {
+		return PublicKeyExport{}, err
+	}
+
+	pk, err := parseECDSAPublicKey(publicKey)
+	if err != nil {
+		return PublicKeyExport{}, err
+	}
+	// without a chain code only the account key itself is exported and no xpub is published
+	var chainCode []byte
+	if chainCodeHex != "" || len(indexes) > 0 {
+		chainCode, err = parseChainCode(chainCodeHex)
+		if err != nil {
+			return PublicKeyExport{}, err
+		}
+	}
+
+	var parentFingerprint []byte
+	var childNumber uint32
+	for _, index := range indexes {
+		parentFingerprint = hash160(crypto.CompressPubkey(pk))[:4]
+		childNumber = index
+		_, pk, chainCode, err = deriveChildPublicKey(pk, chainCode, index)
+		if err != nil {
+			return PublicKeyExport{}, err
+		}
+	}
+
+	uncompressed := sec1Uncompressed(pk)
+	spki, err := asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: algorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: oidSecp256k1},
+		PublicKey: asn1.BitString{Bytes: uncompressed, BitLength: len(uncompressed) * 8},
+	})
+	if err != nil {
+		return PublicKeyExport{}, err
+	}
+
+	export := PublicKeyExport{
+		Curve:            CurveSecp256k1,
+		DerivationPath:   derivationPath,
+		SEC1Compressed:   hex.EncodeToString(crypto.CompressPubkey(pk)),
+		SEC1Uncompressed: hex.EncodeToString(uncompressed),
+		PEM:              string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: spki})),
+		JWK: PublicKeyJWK{
+			Kty: "EC",
+			Crv: "secp256k1",
+			X:   base64.RawURLEncoding.EncodeToString(uncompressed[1:33]),
+			Y:   base64.RawURLEncoding.EncodeToString(uncompressed[33:]),
+		},
+	}
+	if chainCode != nil {
+		export.Xpub = serializeXpub(pk, chainCode, len(indexes), parentFingerprint, childNumber)
+	}
+
+	return export, nil
+}
+
+// exportEDDSAPublicKey returns the raw, PEM and JWK encodings of an ed25519 public key
+func exportEDDSAPublicKey(pk ed25519.PublicKey) PublicKeyExport {
+	spki, _ := x509.MarshalPKIXPublicKey(pk)
+
+	return PublicKeyExport{
+		Curve: CurveEd25519,
+		Raw:   hex.EncodeToString(pk),
+		PEM:   string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: spki})),
+		JWK: PublicKeyJWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pk),
+		},
+	}
+}
+
+// sec1Uncompressed returns the 65 byte SEC1 encoding 0x04 || x || y of a public key
+func sec1Uncompressed(pk *ecdsa.PublicKey) []byte {
+	encoded := make([]byte, 65)
+	encoded[0] = PubkeyUncompressed
+	pk.X.FillBytes(encoded[1:33])
+	pk.Y.FillBytes(encoded[33:])
+	return encoded
+}
+
+// serializeXpub returns the base58check BIP32 serialization of an extended public key
+func serializeXpub(pk *ecdsa.PublicKey, chainCode []byte, depth int, parentFingerprint []byte, childNumber uint32) string {
+	data := make([]byte, 78)
+	binary.BigEndian.PutUint32(data[0:4], xpubVersions[Network])
+	data[4] = byte(depth)
+	copy(data[5:9], parentFingerprint)
+	binary.BigEndian.PutUint32(data[9:13], childNumber)
+	copy(data[13:45], chainCode)
+	copy(data[45:78], crypto.CompressPubkey(pk))
+
+	checksum := doubleSha256(data)
+	return base58.Encode(append(data, checksum[:4]...))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestExportECDSAPublicKey(t *testing.T) {
+	network := Network
+	Network = Mainnet
+	defer func() { Network = network }()
+
+	// BIP32 test vector 2, m and m/0
+	rootXpub := "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB"
+	childXpub := "xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH"
+	chainCode, compressedPK := decodeXpub(rootXpub)
+	pk, err := crypto.DecompressPubkey(compressedPK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := encodePublicKey(pk)
+	chainCodeHex := hex.EncodeToString(chainCode)
+
+	export, err := exportECDSAPublicKey(publicKey, chainCodeHex, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.Xpub != rootXpub || export.DerivationPath != "m" {
+		t.Error("Root xpub does not match BIP32 test vector:", export.Xpub)
+	}
+	if export.SEC1Compressed != hex.EncodeToString(compressedPK) || export.SEC1Uncompressed != hex.EncodeToString(crypto.FromECDSAPub(pk)) {
+		t.Error("Unexpected SEC1 encodings")
+	}
+
+	block, _ := pem.Decode([]byte(export.PEM))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		t.Fatal("Expected a PEM public key block")
+	}
+	// SubjectPublicKeyInfo header of an uncompressed secp256k1 key as written by openssl
+	if hex.EncodeToString(block.Bytes) != "3056301006072a8648ce3d020106052b8104000a034200"+export.SEC1Uncompressed {
+		t.Error("Unexpected SubjectPublicKeyInfo:", hex.EncodeToString(block.Bytes))
+	}
+
+	x, _ := base64.RawURLEncoding.DecodeString(export.JWK.X)
+	y, _ := base64.RawURLEncoding.DecodeString(export.JWK.Y)
+	if export.JWK.Kty != "EC" || export.JWK.Crv != "secp256k1" || hex.EncodeToString(append(append([]byte{4}, x...), y...)) != export.SEC1Uncompressed {
+		t.Error("Unexpected JWK:", export.JWK)
+	}
+
+	child, err := exportECDSAPublicKey(publicKey, chainCodeHex, "m/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if child.Xpub != childXpub {
+		t.Error("Child xpub does not match BIP32 test vector:", child.Xpub)
+	}
+
+	// accounts without a chain code export the account key but no xpub
+	noChainCode, err := exportECDSAPublicKey(publicKey, "", "")
+	if err != nil || noChainCode.Xpub != "" || noChainCode.SEC1Compressed != export.SEC1Compressed {
+		t.Error("Xpub published without a chain code")
+	}
+	if _, err := exportECDSAPublicKey(publicKey, "", "m/0"); err == nil {
+		t.Error("Derivation without a chain code should be rejected")
+	}
+
+	Network = Testnet
+	testnet, _ := exportECDSAPublicKey(publicKey, chainCodeHex, "")
+	if !strings.HasPrefix(testnet.Xpub, "tpub") {
+		t.Error("Testnet extended keys should be tpub:", testnet.Xpub)
+	}
+}
+
+func TestExportEDDSAPublicKey(t *testing.T) {
+	pk, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("Error generating key")
+	}
+
+	export := exportEDDSAPublicKey(pk)
+	block, _ := pem.Decode([]byte(export.PEM))
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil || !pk.Equal(parsed) {
+		t.Error("PEM should encode the ed25519 public key")
+	}
+
+	x, _ := base64.RawURLEncoding.DecodeString(export.JWK.X)
+	if export.JWK.Kty != "OKP" || export.JWK.Crv != "Ed25519" || !pk.Equal(ed25519.PublicKey(x)) || export.Raw != hex.EncodeToString(pk) {
+		t.Error("Unexpected JWK:", export.JWK)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ECDSAPoint is the JSON representation of a curve point used by the MPC shares
+// e.g. ShareData.PK and the entries of ShareData.PubShares
+type ECDSAPoint struct {
+	CurveName string   `json:"CurveName"` // curveName is the name of the curve the point belongs to
+	X         *big.Int `json:"X"`         // x coordinate of the point
+	Y         *big.Int `json:"Y"`         // y coordinate of the point
+}
+
+// ECDSASignature is the JSON representation of a combined MPC ECDSA signature
+type ECDSASignature struct {
+	V int      `json:"V"` // recovery id, may be missing and is recomputed from the public key
+	R *big.Int `json:"R"` // r value of the signature
+	S *big.Int `json:"S"` // s value of the signature
+}
+
+// parseECDSAPublicKey converts the group public key stored in ShareData.PK into an ecdsa public key
+func parseECDSAPublicKey(pk string) (*ecdsa.PublicKey, error) {
+	var point ECDSAPoint
+	err := json.Unmarshal([]byte(pk), &point)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding public key: %s", err)
+	}
+
+	return pointToPublicKey(point)
+}
+
+// pointToPublicKey validates a secp256k1 point and returns it as an ecdsa public key
+func pointToPublicKey(point ECDSAPoint) (*ecdsa.PublicKey, error) {
+	if point.CurveName != "" && point.CurveName != "secp256k1" {
+		return nil, fmt.Errorf("unsupported curve: %s", point.CurveName)
+	}
+	if point.X == nil || point.Y == nil || !crypto.S256().IsOnCurve(point.X, point.Y) {
+		return nil, fmt.Errorf("public key is not a valid secp256k1 point")
+	}
+
+	return &ecdsa.PublicKey{Curve: crypto.S256(), X: point.X, Y: point.Y}, nil
+}
+
+// decodeEDDSABytes decodes a hex or base64 encoded value of the expected length
+func decodeEDDSABytes(value string, size int) ([]byte, error) {
+	trimmed := strings.TrimPrefix(value, "0x")
+	if decoded, err := hex.DecodeString(trimmed); err == nil && len(decoded) == size {
+		return decoded, nil
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil && len(decoded) == size {
+		return decoded, nil
+	}
+
+	return nil, fmt.Errorf("expected hex or base64 encoding of %d bytes", size)
+}
+
+// parseEDDSAPublicKey converts the group public key stored in EDDSAShare.PK into an ed25519 public key
+func parseEDDSAPublicKey(pk string) (ed25519.PublicKey, error) {
+	decoded, err := decodeEDDSABytes(pk, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding eddsa public key: %s", err)
+	}
+
+	return ed25519.PublicKey(decoded), nil
+}
+
+// parseEDDSASignature converts the full signature returned by EDDSASignerService.CustodySign into bytes
+func parseEDDSASignature(signature string) ([]byte, error) {
+	decoded, err := decodeEDDSABytes(signature, ed25519.SignatureSize)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding eddsa signature: %s", err)
+	}
+
+	return decoded, nil
+}
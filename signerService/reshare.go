@@ -0,0 +1,914 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Re-sharing participants, the custody and escrow services deal fresh shares to every participant
+// including the new mobile device. Any ReshareThreshold shares sign, as in the signing rounds
+var ReshareDealers = []uint32{1, 2}
+
+const (
+	MobileIdentifier uint32 = 3
+	ReshareThreshold        = 2
+)
+
+// ReshareRollbackWindow is how long a finalized re-sharing can be rolled back, the replaced share is dropped after it
+const ReshareRollbackWindow = time.Hour
+
+// StartReshare opens a re-sharing session for an account of a recovery in reshare mode and returns the signed
+// session state with the session key the other dealer seals its sub-share to. A rolled back session is restarted
+func StartReshare(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	reshareCollection := DB.Database(MongoDatabase).Collection("ReshareCollection")
+	defer CloseClientDB(DB)
+
+	recoveryRecord, err := readReshareRecovery(userId, blockchainId, accountName, userCollection)
+	if err == nil && recoveryRecord.DeviceKey == "" {
+		err = fmt.Errorf("Recovery has no approved device key")
+	}
+	if err != nil {
+		log.Error("Error starting reshare err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	previous, err := readReshareSession(userId, blockchainId, accountName, recoveryRecord.ID, reshareCollection)
+	if err == nil && previous.Status != ReshareRolledBack {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Reshare already started"), c.Writer)
+		return
+	} else if err != nil && err != mongo.ErrNoDocuments {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	share, err := readECDSAShare(userId, blockchainId, accountName, keyShareCollection)
+	if err != nil {
+		log.Error("Error reading share err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	shareValue, err := decodeShareValue(share)
+	if err == nil {
+		_, err = otherDealer(ResharePeers, shareValue.Identifier)
+	}
+	if err != nil {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	sessionKey, err := crypto.GenerateKey()
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	now := time.Now().UTC()
+	session := ReshareSession{
+		ID:           previous.ID,
+		UserId:       userId,
+		BlockchainId: blockchainId,
+		AccountName:  accountName,
+		RecoveryId:   recoveryRecord.ID,
+		Identifier:   shareValue.Identifier,
+		SessionKey:   hex.EncodeToString(crypto.CompressPubkey(&sessionKey.PublicKey)),
+		DeviceKey:    recoveryRecord.DeviceKey,
+		Commitments:  make(map[string]string),
+		Status:       ReshareStarted,
+		CreatedAt:    now,
+		UpdatedAt:    previous.UpdatedAt,
+	}
+	secrets := ReshareSecrets{SessionKey: hex.EncodeToString(crypto.FromECDSA(sessionKey)), SubShares: make(map[string]*big.Int)}
+
+	err = saveReshareSession(session, secrets, reshareCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	state, err := signedSessionState(ReshareSigningKey, session)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(state, nil, c.Writer)
+	return
+}
+
+// GetReshareSession returns the signed state of the re-sharing session of an account, the other dealer reads the
+// session key it seals to and the refreshed public shares this service committed to from it
+func GetReshareSession(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	reshareCollection := DB.Database(MongoDatabase).Collection("ReshareCollection")
+	defer CloseClientDB(DB)
+
+	session, err := readRecoveryReshareSession(userId, blockchainId, accountName, userCollection, reshareCollection)
+	if err != nil {
+		log.Error("Error reading reshare session err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	state, err := signedSessionState(ReshareSigningKey, session)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(state, nil, c.Writer)
+	return
+}
+
+// DealReshare re-shares this service's share with a fresh polynomial and returns the signed dealing. The sub-shares
+// are sealed to the session key read from the other dealer, signed with its pinned key, and to the device key
+// approved with the recovery record
+func DealReshare(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	reshareCollection := DB.Database(MongoDatabase).Collection("ReshareCollection")
+	defer CloseClientDB(DB)
+
+	session, secrets, err := readActiveReshareSession(userId, blockchainId, accountName, userCollection, reshareCollection)
+	if err != nil {
+		log.Error("Error reading reshare session err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	if session.Status != ReshareStarted {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Reshare dealing already created"), c.Writer)
+		return
+	}
+
+	var peerState ReshareSessionState
+	peer, err := otherDealer(ResharePeers, session.Identifier)
+	if err == nil {
+		peerState, err = fetchPeerSession(peer, userId, blockchainId, accountName)
+	}
+	if err == nil && (peerState.RecordId != session.RecoveryId.Hex() || peerState.Status == ReshareRolledBack) {
+		err = fmt.Errorf("participant %d has no active session for the recovery", peer.Identifier)
+	}
+	if err != nil {
+		log.Error("Error reading peer reshare session err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	share, err := readECDSAShare(userId, blockchainId, accountName, keyShareCollection)
+	if err != nil {
+		log.Error("Error reading share err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	shareValue, err := decodeShareValue(share)
+	if err != nil {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	commitments, subShares, err := dealReshare(shareValue, ReshareDealers, reshareRecipients(share), ReshareThreshold, rand.Reader)
+	if err != nil {
+		log.Error("Error dealing reshare err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	// only keys authenticated by the peer or approved with the recovery receive sub-shares
+	recipientKeys := map[uint32]string{peer.Identifier: peerState.SessionKey, MobileIdentifier: session.DeviceKey}
+	dealing := ReshareDealing{
+		DealerId:    session.Identifier,
+		RecordId:    session.RecoveryId.Hex(),
+		SessionKey:  peerState.SessionKey,
+		Commitments: commitments,
+		SubShares:   make(map[string]SealedShare),
+	}
+	for recipient, subShare := range subShares {
+		id := strconv.FormatUint(uint64(recipient), 10)
+		if recipient == session.Identifier {
+			secrets.SubShares[id] = subShare
+			continue
+		}
+
+		recipientKey, ok := recipientKeys[recipient]
+		if !ok || recipientKey == "" {
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: no key to seal the sub-share of participant %s", id), c.Writer)
+			return
+		}
+		dealing.SubShares[id], err = sealShare(subShare.FillBytes(make([]byte, 32)), ShareSealECIES, recipientKey)
+		if err != nil {
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+	}
+
+	dealing.Signature, err = signReshareDealing(ReshareSigningKey, userId, blockchainId, accountName, dealing)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	commitmentsJSON, _ := json.Marshal(commitments)
+	session.Commitments[strconv.FormatUint(uint64(session.Identifier), 10)] = string(commitmentsJSON)
+	session.Status = ReshareDealt
+	err = saveReshareSession(session, secrets, reshareCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(dealing, nil, c.Writer)
+	return
+}
+
+// ReceiveReshareDealing verifies the dealing of the other dealer, its signature by the pinned dealer key, its
+// binding to this session and its commitments against its previous public share. Once every dealer's sub-share
+// is in, the refreshed share is computed and kept with the session until the new device commits to it
+func ReceiveReshareDealing(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	var dealing ReshareDealing
+	err := json.NewDecoder(c.Request.Body).Decode(&dealing)
+	if err != nil {
+		log.Error("Error decoding reshare dealing: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	// commitments built from the dealer's public share pass the Feldman check for any sub-share,
+	// only the dealer's signature shows it re-shared its share
+	err = verifyDealingSignature(ResharePeers, userId, blockchainId, accountName, dealing)
+	if err != nil {
+		log.Error("Error verifying reshare dealing signature err:", err)
+		WriteErrorResponse(http.StatusUnauthorized, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	reshareCollection := DB.Database(MongoDatabase).Collection("ReshareCollection")
+	defer CloseClientDB(DB)
+
+	session, secrets, err := readActiveReshareSession(userId, blockchainId, accountName, userCollection, reshareCollection)
+	if err != nil {
+		log.Error("Error reading reshare session err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	dealerId := strconv.FormatUint(uint64(dealing.DealerId), 10)
+	if session.Status != ReshareDealt || dealing.DealerId == session.Identifier || !isReshareDealer(dealing.DealerId) {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Unexpected reshare dealing"), c.Writer)
+		return
+	}
+	if dealing.RecordId != session.RecoveryId.Hex() || dealing.SessionKey != session.SessionKey {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Dealing belongs to another reshare session"), c.Writer)
+		return
+	}
+	if _, ok := session.Commitments[dealerId]; ok {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: dealing of participant %s already received", dealerId), c.Writer)
+		return
+	}
+
+	share, err := readECDSAShare(userId, blockchainId, accountName, keyShareCollection)
+	if err != nil {
+		log.Error("Error reading share err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	subShare, err := openReshareSubShare(dealing, session.Identifier, secrets.SessionKey)
+	if err == nil {
+		err = verifyReshareDealing(share, dealing, session.Identifier, subShare)
+	}
+	if err != nil {
+		log.Error("Error verifying reshare dealing err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	commitmentsJSON, _ := json.Marshal(dealing.Commitments)
+	session.Commitments[dealerId] = string(commitmentsJSON)
+	secrets.SubShares[dealerId] = subShare
+
+	if len(session.Commitments) == len(ReshareDealers) {
+		commitments := make(map[uint32][]ECDSAPoint)
+		for id, value := range session.Commitments {
+			dealer, _ := strconv.ParseUint(id, 10, 32)
+			var points []ECDSAPoint
+			json.Unmarshal([]byte(value), &points)
+			commitments[uint32(dealer)] = points
+		}
+
+		refreshed, pubShares, err := combineReshare(share, session.Identifier, commitments, secrets.SubShares)
+		if err != nil {
+			log.Error("Error combining reshare err:", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+		secrets.Share = refreshed
+		session.PubShares = pubShares
+		session.Status = ReshareRefreshed
+	}
+
+	err = saveReshareSession(session, secrets, reshareCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(SuccessDetails{
+		Message: session.Status,
+	}, nil, c.Writer)
+	return
+}
+
+// CompleteReshare records the commit of the new device, the public share it signed with the approved device key
+// must match the refreshed public shares. The stored share is kept until FinalizeReshare sees the other dealer committed
+func CompleteReshare(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	var request ReshareCompleteRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&request)
+	if err != nil {
+		log.Error("Error decoding reshare request: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	reshareCollection := DB.Database(MongoDatabase).Collection("ReshareCollection")
+	defer CloseClientDB(DB)
+
+	session, secrets, err := readActiveReshareSession(userId, blockchainId, accountName, userCollection, reshareCollection)
+	if err != nil {
+		log.Error("Error reading reshare session err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	if session.Status != ReshareRefreshed {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Reshare dealings not complete"), c.Writer)
+		return
+	}
+
+	err = verifyDevicePublicShare(session.PubShares, request.PublicShare)
+	if err == nil {
+		err = verifyDeviceCommit(session, request)
+	}
+	if err != nil {
+		log.Error("Error verifying device share err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	session.Status = ReshareCommitted
+	err = saveReshareSession(session, secrets, reshareCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(SuccessDetails{
+		Message: session.Status,
+	}, nil, c.Writer)
+	return
+}
+
+// FinalizeReshare replaces the stored share with the refreshed share once the new device and the other dealer
+// committed to the same refreshed public shares, the replaced share is kept with the session for a rollback
+// until ReshareRollbackWindow passes or the recovery completes
+func FinalizeReshare(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	reshareCollection := DB.Database(MongoDatabase).Collection("ReshareCollection")
+	defer CloseClientDB(DB)
+
+	session, secrets, err := readActiveReshareSession(userId, blockchainId, accountName, userCollection, reshareCollection)
+	if err != nil {
+		log.Error("Error reading reshare session err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	if session.Status != ReshareCommitted {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", "Reshare not committed by the device"), c.Writer)
+		return
+	}
+
+	var peerState ReshareSessionState
+	peer, err := otherDealer(ResharePeers, session.Identifier)
+	if err == nil {
+		peerState, err = fetchPeerSession(peer, userId, blockchainId, accountName)
+	}
+	if err == nil {
+		err = peerCommitted(session, peerState)
+	}
+	if err != nil {
+		log.Error("Error reading peer reshare session err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	share, err := readECDSAShare(userId, blockchainId, accountName, keyShareCollection)
+	if err != nil {
+		log.Error("Error reading share err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	// the session keeps the replaced share before the stored share changes, so a failed update can be rolled back
+	now := time.Now().UTC()
+	session.PreviousPubShares = share.ShareData.PubShares
+	session.RollbackUntil = now.Add(ReshareRollbackWindow)
+	session.Status = ReshareComplete
+	err = saveReshareSession(session, ReshareSecrets{Share: secrets.Share, PreviousShare: share.ShareData.Share}, reshareCollection)
+	if err == nil {
+		share.ShareData.Share = secrets.Share
+		share.ShareData.PubShares = session.PubShares
+		err = updateECDSAShare(share, keyShareCollection)
+	}
+	if err == nil {
+		err = markRecoveryAccount(session.RecoveryId, blockchainId, accountName, RecoveryAccountReprovisioned, now, userCollection)
+	}
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(SuccessDetails{
+		Message: session.Status,
+	}, nil, c.Writer)
+	return
+}
+
+// RollbackReshare ends a re-sharing session and restores the replaced share of a finalized one. It is refused
+// while the other dealer holds its refreshed share, the other dealer rolls back first, and once the replaced
+// share of a finalized session was dropped
+func RollbackReshare(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	reshareCollection := DB.Database(MongoDatabase).Collection("ReshareCollection")
+	defer CloseClientDB(DB)
+
+	session, err := readRecoveryReshareSession(userId, blockchainId, accountName, userCollection, reshareCollection)
+	if err == nil && session.Status == ReshareRolledBack {
+		err = fmt.Errorf("Reshare already rolled back")
+	}
+	if err == nil {
+		err = reshareRollbackOpen(session, time.Now())
+	}
+	if err != nil {
+		log.Error("Error reading reshare session err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	secrets, err := decryptReshareSecrets(session)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var peerState ReshareSessionState
+	peer, err := otherDealer(ResharePeers, session.Identifier)
+	if err == nil {
+		peerState, err = fetchPeerSession(peer, userId, blockchainId, accountName)
+	}
+	if err == nil && peerState.RecordId == session.RecoveryId.Hex() && peerState.Status == ReshareComplete {
+		err = fmt.Errorf("participant %d holds its refreshed share and rolls back first", peer.Identifier)
+	}
+	if err != nil {
+		log.Error("Error rolling back reshare err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	if session.Status == ReshareComplete {
+		share, err := readECDSAShare(userId, blockchainId, accountName, keyShareCollection)
+		if err != nil {
+			log.Error("Error reading share err:", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+		share.ShareData.Share = secrets.PreviousShare
+		share.ShareData.PubShares = session.PreviousPubShares
+
+		err = updateECDSAShare(share, keyShareCollection)
+		if err == nil {
+			err = resetRecoveryAccount(session.RecoveryId, blockchainId, accountName, time.Now().UTC(), userCollection)
+		}
+		if err != nil {
+			WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+	}
+
+	session.Status = ReshareRolledBack
+	err = saveReshareSession(session, ReshareSecrets{}, reshareCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(SuccessDetails{
+		Message: session.Status,
+	}, nil, c.Writer)
+	return
+}
+
+// reshareRollbackOpen checks that a finalized session still holds the replaced share within its rollback window
+func reshareRollbackOpen(session ReshareSession, now time.Time) error {
+	if session.Status != ReshareComplete {
+		return nil
+	}
+	if len(session.Secrets) == 0 || len(session.PreviousPubShares) == 0 || !now.Before(session.RollbackUntil) {
+		return fmt.Errorf("Reshare rollback window has passed")
+	}
+	return nil
+}
+
+// readReshareRecovery returns the unlocked reshare mode recovery covering an account
+func readReshareRecovery(userId, blockchainId, accountName string, userCollection *mongo.Collection) (RecoveryRecord, error) {
+	recoveryRecord, err := readRecoveryRecord(userId, userCollection)
+	if err != nil {
+		return recoveryRecord, fmt.Errorf("Recovery not initiated")
+	}
+
+	err = recoveryUnlocked(recoveryRecord, time.Now())
+	if err == nil {
+		err = recoveryCoversAccount(recoveryRecord, blockchainId, accountName)
+	}
+	if err == nil && recoveryRecord.Mode != RecoveryModeReshare {
+		err = fmt.Errorf("Recovery is not in reshare mode")
+	}
+	return recoveryRecord, err
+}
+
+// readActiveReshareSession returns the re-sharing session of the ongoing recovery and its decrypted secrets
+func readActiveReshareSession(userId, blockchainId, accountName string, userCollection, reshareCollection *mongo.Collection) (ReshareSession, ReshareSecrets, error) {
+	recoveryRecord, err := readReshareRecovery(userId, blockchainId, accountName, userCollection)
+	if err != nil {
+		return ReshareSession{}, ReshareSecrets{}, err
+	}
+
+	session, err := readReshareSession(userId, blockchainId, accountName, recoveryRecord.ID, reshareCollection)
+	if err != nil || session.Status == ReshareRolledBack {
+		return session, ReshareSecrets{}, fmt.Errorf("Reshare not started")
+	}
+
+	secrets, err := decryptReshareSecrets(session)
+	return session, secrets, err
+}
+
+// readRecoveryReshareSession returns the re-sharing session of an account for the ongoing recovery whatever the
+// status of the session, the other dealer reads finalized and rolled back sessions too
+func readRecoveryReshareSession(userId, blockchainId, accountName string, userCollection, reshareCollection *mongo.Collection) (ReshareSession, error) {
+	recoveryRecord, err := readRecoveryRecord(userId, userCollection)
+	if err != nil {
+		return ReshareSession{}, fmt.Errorf("Recovery not initiated")
+	}
+
+	session, err := readReshareSession(userId, blockchainId, accountName, recoveryRecord.ID, reshareCollection)
+	if err != nil {
+		return session, fmt.Errorf("Reshare not started")
+	}
+	return session, nil
+}
+
+// decryptReshareSecrets decrypts the secrets of a re-sharing session
+func decryptReshareSecrets(session ReshareSession) (ReshareSecrets, error) {
+	var secrets ReshareSecrets
+	secretsJSON, err := decrypChunkData(session.Secrets)
+	if err != nil {
+		log.Error("Error decrypting reshare secrets ", err)
+		return secrets, err
+	}
+	err = json.Unmarshal(secretsJSON, &secrets)
+	return secrets, err
+}
+
+// saveReshareSession encrypts the session secrets and writes the session, an existing session is only
+// replaced if no other request updated it since it was read
+func saveReshareSession(session ReshareSession, secrets ReshareSecrets, reshareCollection *mongo.Collection) error {
+	secretsJSON, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	session.Secrets, err = chunkEncryptData(secretsJSON)
+	if err != nil {
+		log.Error("Error encrypting reshare secrets:", err)
+		return err
+	}
+
+	previous := session.UpdatedAt
+	session.UpdatedAt = time.Now().UTC()
+	if session.ID.IsZero() {
+		return writeReshareSession(session, reshareCollection)
+	}
+	return updateReshareSession(session, previous, reshareCollection)
+}
+
+// decodeShareValue decodes ShareData.Share of an ecdsa key share
+func decodeShareValue(share KeyShare) (ECDSAShareValue, error) {
+	var shareValue ECDSAShareValue
+	err := json.Unmarshal([]byte(share.ShareData.Share), &shareValue)
+	if err != nil || shareValue.Value == nil {
+		return shareValue, fmt.Errorf("Error decoding share value: %v", err)
+	}
+	return shareValue, nil
+}
+
+// reshareRecipients returns the participant identifiers of the public shares, every participant gets a fresh share
+func reshareRecipients(share KeyShare) []uint32 {
+	var recipients []uint32
+	for id := range share.ShareData.PubShares {
+		recipient, err := strconv.ParseUint(id, 10, 32)
+		if err == nil {
+			recipients = append(recipients, uint32(recipient))
+		}
+	}
+	sort.Slice(recipients, func(i, j int) bool { return recipients[i] < recipients[j] })
+	return recipients
+}
+
+func isReshareDealer(id uint32) bool {
+	for _, dealer := range ReshareDealers {
+		if dealer == id {
+			return true
+		}
+	}
+	return false
+}
+
+// lagrangeCoefficient returns the coefficient of participant id for interpolating at zero over ids
+func lagrangeCoefficient(id uint32, ids []uint32) *big.Int {
+	numerator := big.NewInt(1)
+	denominator := big.NewInt(1)
+	for _, other := range ids {
+		if other == id {
+			continue
+		}
+		numerator.Mul(numerator, big.NewInt(int64(other)))
+		numerator.Mod(numerator, secp256k1N)
+		denominator.Mul(denominator, big.NewInt(int64(other)-int64(id)))
+		denominator.Mod(denominator, secp256k1N)
+	}
+
+	coefficient := new(big.Int).ModInverse(denominator, secp256k1N)
+	coefficient.Mul(coefficient, numerator)
+	return coefficient.Mod(coefficient, secp256k1N)
+}
+
+// dealReshare shares lambda * share value with a random polynomial of degree threshold - 1 and returns
+// the Feldman commitments of the coefficients and the polynomial evaluated at each recipient
+func dealReshare(shareValue ECDSAShareValue, dealers, recipients []uint32, threshold int, random io.Reader) ([]ECDSAPoint, map[uint32]*big.Int, error) {
+	if !isReshareDealer(shareValue.Identifier) {
+		return nil, nil, fmt.Errorf("participant %d is not a reshare dealer", shareValue.Identifier)
+	}
+
+	coefficients := []*big.Int{new(big.Int).Mod(new(big.Int).Mul(lagrangeCoefficient(shareValue.Identifier, dealers), shareValue.Value), secp256k1N)}
+	for len(coefficients) < threshold {
+		coefficient, err := rand.Int(random, secp256k1N)
+		if err != nil {
+			return nil, nil, err
+		}
+		coefficients = append(coefficients, coefficient)
+	}
+
+	var commitments []ECDSAPoint
+	for _, coefficient := range coefficients {
+		commitments = append(commitments, publicKeyToPoint(scalarBaseMult(coefficient)))
+	}
+
+	subShares := make(map[uint32]*big.Int)
+	for _, recipient := range recipients {
+		x := big.NewInt(int64(recipient))
+		value := new(big.Int)
+		for i := len(coefficients) - 1; i >= 0; i-- {
+			value.Mul(value, x)
+			value.Add(value, coefficients[i])
+			value.Mod(value, secp256k1N)
+		}
+		subShares[recipient] = value
+	}
+
+	return commitments, subShares, nil
+}
+
+// openReshareSubShare decrypts the sub-share sealed to this service's session key
+func openReshareSubShare(dealing ReshareDealing, identifier uint32, sessionKey string) (*big.Int, error) {
+	sealed, ok := dealing.SubShares[strconv.FormatUint(uint64(identifier), 10)]
+	if !ok || sealed.Scheme != ShareSealECIES {
+		return nil, fmt.Errorf("dealing has no sub-share for participant %d", identifier)
+	}
+
+	key, err := crypto.HexToECDSA(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(sealed.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := ecies.ImportECDSA(key).Decrypt(ciphertext, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening sub-share: %s", err)
+	}
+
+	return new(big.Int).SetBytes(plaintext), nil
+}
+
+// verifyReshareDealing checks that the dealer re-shared its own share, the constant commitment must be
+// lambda times the dealer's public share, and that the sub-share matches the commitments
+func verifyReshareDealing(share KeyShare, dealing ReshareDealing, recipient uint32, subShare *big.Int) error {
+	if len(dealing.Commitments) != ReshareThreshold {
+		return fmt.Errorf("dealing needs %d commitments", ReshareThreshold)
+	}
+
+	var dealerShare ECDSAPublicShare
+	err := json.Unmarshal([]byte(share.ShareData.PubShares[strconv.FormatUint(uint64(dealing.DealerId), 10)]), &dealerShare)
+	if err != nil {
+		return fmt.Errorf("Error decoding public share of dealer %d: %s", dealing.DealerId, err)
+	}
+	dealerPoint, err := pointToPublicKey(dealerShare.Point)
+	if err != nil {
+		return err
+	}
+	constant, err := pointToPublicKey(dealing.Commitments[0])
+	if err != nil {
+		return err
+	}
+	if !pointsEqual(constant, scalarMult(dealerPoint, lagrangeCoefficient(dealing.DealerId, ReshareDealers))) {
+		return fmt.Errorf("dealing of participant %d does not re-share its share", dealing.DealerId)
+	}
+
+	expected, err := evaluateCommitments(dealing.Commitments, recipient)
+	if err != nil {
+		return err
+	}
+	if !pointsEqual(expected, scalarBaseMult(subShare)) {
+		return fmt.Errorf("sub-share of participant %d does not match the commitments", dealing.DealerId)
+	}
+
+	return nil
+}
+
+// combineReshare sums the sub-shares of every dealer into the refreshed share and derives the refreshed public
+// shares of all participants from the commitments. The group public key is unchanged
+func combineReshare(share KeyShare, identifier uint32, commitments map[uint32][]ECDSAPoint, subShares map[string]*big.Int) (string, map[string]string, error) {
+	value := new(big.Int)
+	for _, subShare := range subShares {
+		value.Add(value, subShare)
+	}
+	value.Mod(value, secp256k1N)
+
+	pk, err := parseECDSAPublicKey(share.ShareData.PK)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// the constant terms sum to the old secret, so the group public key is unchanged
+	var groupKey *ecdsa.PublicKey
+	for _, dealer := range ReshareDealers {
+		dealerCommitments, ok := commitments[dealer]
+		if !ok || len(dealerCommitments) == 0 {
+			return "", nil, fmt.Errorf("missing dealing of participant %d", dealer)
+		}
+		constant, err := pointToPublicKey(dealerCommitments[0])
+		if err != nil {
+			return "", nil, err
+		}
+		groupKey = addPoints(groupKey, constant)
+	}
+	if !pointsEqual(groupKey, pk) {
+		return "", nil, fmt.Errorf("refreshed shares do not match the group public key")
+	}
+
+	pubShares := make(map[string]string)
+	for _, recipient := range reshareRecipients(share) {
+		var point *ecdsa.PublicKey
+		for _, dealer := range ReshareDealers {
+			evaluated, err := evaluateCommitments(commitments[dealer], recipient)
+			if err != nil {
+				return "", nil, err
+			}
+			point = addPoints(point, evaluated)
+		}
+		if recipient == identifier && !pointsEqual(point, scalarBaseMult(value)) {
+			return "", nil, fmt.Errorf("refreshed share does not match its public share")
+		}
+
+		pubShareJSON, _ := json.Marshal(ECDSAPublicShare{Point: publicKeyToPoint(point)})
+		pubShares[strconv.FormatUint(uint64(recipient), 10)] = string(pubShareJSON)
+	}
+
+	shareValueJSON, _ := json.Marshal(ECDSAShareValue{Identifier: identifier, Value: value, Point: publicKeyToPoint(scalarBaseMult(value))})
+	return string(shareValueJSON), pubShares, nil
+}
+
+// verifyDevicePublicShare checks the public share reported by the new device against the refreshed public shares
+func verifyDevicePublicShare(pubShares map[string]string, devicePoint ECDSAPoint) error {
+	var expected ECDSAPublicShare
+	err := json.Unmarshal([]byte(pubShares[strconv.FormatUint(uint64(MobileIdentifier), 10)]), &expected)
+	if err != nil {
+		return fmt.Errorf("Error decoding refreshed public share: %s", err)
+	}
+	expectedPoint, err := pointToPublicKey(expected.Point)
+	if err != nil {
+		return err
+	}
+	point, err := pointToPublicKey(devicePoint)
+	if err != nil {
+		return err
+	}
+	if !pointsEqual(point, expectedPoint) {
+		return fmt.Errorf("device share does not match the refreshed public share")
+	}
+	return nil
+}
+
+// evaluateCommitments returns sum of C_m * x^m, the public value of the dealt polynomial at x
+func evaluateCommitments(commitments []ECDSAPoint, x uint32) (*ecdsa.PublicKey, error) {
+	var result *ecdsa.PublicKey
+	power := big.NewInt(1)
+	for _, commitment := range commitments {
+		point, err := pointToPublicKey(commitment)
+		if err != nil {
+			return nil, err
+		}
+		result = addPoints(result, scalarMult(point, power))
+		power = new(big.Int).Mod(new(big.Int).Mul(power, big.NewInt(int64(x))), secp256k1N)
+	}
+	if result == nil {
+		return nil, fmt.Errorf("dealing has no commitments")
+	}
+	return result, nil
+}
+
+func scalarBaseMult(k *big.Int) *ecdsa.PublicKey {
+	x, y := crypto.S256().ScalarBaseMult(k.FillBytes(make([]byte, 32)))
+	return &ecdsa.PublicKey{Curve: crypto.S256(), X: x, Y: y}
+}
+
+func scalarMult(point *ecdsa.PublicKey, k *big.Int) *ecdsa.PublicKey {
+	x, y := crypto.S256().ScalarMult(point.X, point.Y, k.FillBytes(make([]byte, 32)))
+	return &ecdsa.PublicKey{Curve: crypto.S256(), X: x, Y: y}
+}
+
+// addPoints returns a + b, a nil point is the identity
+func addPoints(a, b *ecdsa.PublicKey) *ecdsa.PublicKey {
+	if a == nil {
+		return b
+	}
+	x, y := crypto.S256().Add(a.X, a.Y, b.X, b.Y)
+	return &ecdsa.PublicKey{Curve: crypto.S256(), X: x, Y: y}
+}
+
+func pointsEqual(a, b *ecdsa.PublicKey) bool {
+	return a.X.Cmp(b.X) == 0 && a.Y.Cmp(b.Y) == 0
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReshareSigningKey signs the session states and dealings of this service, it is the hex or base64 ed25519 seed
+// loaded from RESHARE_SIGNING_KEY_FILE. The other dealer pins its public key
+var ReshareSigningKey ed25519.PrivateKey = loadReshareSigningKey()
+
+// ResharePeers are the other re-sharing services by participant identifier, loaded from RESHARE_PEERS_FILE.
+// Without the signing key and the peers every re-sharing request is rejected
+var ResharePeers map[uint32]ResharePeer = loadResharePeers()
+
+// reshareHTTPClient reads the session state of the other dealer
+var reshareHTTPClient = &http.Client{Timeout: RPCTimeout}
+
+func loadReshareSigningKey() ed25519.PrivateKey {
+	path, ok := os.LookupEnv("RESHARE_SIGNING_KEY_FILE")
+	if !ok {
+		log.Warn("missing environment variable: RESHARE_SIGNING_KEY_FILE, re-sharing is disabled")
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal("Error reading reshare signing key err:", err)
+	}
+	seed, err := decodeEDDSABytes(strings.TrimSpace(string(data)), ed25519.SeedSize)
+	if err != nil {
+		log.Fatal("Error loading reshare signing key err:", err)
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+func loadResharePeers() map[uint32]ResharePeer {
+	path, ok := os.LookupEnv("RESHARE_PEERS_FILE")
+	if !ok {
+		log.Warn("missing environment variable: RESHARE_PEERS_FILE, re-sharing is disabled")
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal("Error reading reshare peers err:", err)
+	}
+	peers, err := parseResharePeers(data)
+	if err != nil {
+		log.Fatal("Error loading reshare peers err:", err)
+	}
+	return peers
+}
+
+// parseResharePeers decodes the list of re-sharing peers, every peer is a reshare dealer with a url and an ed25519 key
+func parseResharePeers(data []byte) (map[uint32]ResharePeer, error) {
+	var list []ResharePeer
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make(map[uint32]ResharePeer)
+	for _, peer := range list {
+		if !isReshareDealer(peer.Identifier) || peers[peer.Identifier].Identifier != 0 {
+			return nil, fmt.Errorf("invalid or duplicate reshare peer: %d", peer.Identifier)
+		}
+		if peer.URL == "" {
+			return nil, fmt.Errorf("missing url of reshare peer %d", peer.Identifier)
+		}
+		_, err = parseEDDSAPublicKey(peer.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key of reshare peer %d: %s", peer.Identifier, err)
+		}
+		peers[peer.Identifier] = peer
+	}
+
+	return peers, nil
+}
+
+// otherDealer returns the pinned peer of the reshare dealer other than identifier
+func otherDealer(peers map[uint32]ResharePeer, identifier uint32) (ResharePeer, error) {
+	for _, dealer := range ReshareDealers {
+		if dealer == identifier {
+			continue
+		}
+		peer, ok := peers[dealer]
+		if !ok {
+			return ResharePeer{}, fmt.Errorf("reshare peer %d is not configured", dealer)
+		}
+		return peer, nil
+	}
+	return ResharePeer{}, fmt.Errorf("participant %d has no other reshare dealer", identifier)
+}
+
+// reshareSessionMessage is the message a service signs over its session state, it binds the session key and
+// the refreshed public shares to one account of one recovery record
+func reshareSessionMessage(userId, blockchainId, accountName string, state ReshareSessionState) []byte {
+	pubShares := ""
+	if len(state.PubShares) > 0 {
+		pubSharesJSON, _ := json.Marshal(state.PubShares)
+		pubShares = string(pubSharesJSON)
+	}
+	return []byte(fmt.Sprintf("signerService reshare session\nuserId: %s\naccount: %s %s\nrecordId: %s\nidentifier: %d\nsessionKey: %s\nstatus: %s\npubShares: %s",
+		userId, blockchainId, accountName, state.RecordId, state.Identifier, state.SessionKey, state.Status, pubShares))
+}
+
+// reshareDealingMessage is the message a dealer signs over its dealing, it binds the commitments to one account
+// of one recovery record and to the session key of the other dealer
+func reshareDealingMessage(userId, blockchainId, accountName string, dealing ReshareDealing) []byte {
+	commitmentsJSON, _ := json.Marshal(dealing.Commitments)
+	return []byte(fmt.Sprintf("signerService reshare dealing\nuserId: %s\naccount: %s %s\nrecordId: %s\ndealerId: %d\nsessionKey: %s\ncommitments: %s",
+		userId, blockchainId, accountName, dealing.RecordId, dealing.DealerId, dealing.SessionKey, commitmentsJSON))
+}
+
+// reshareCommitMessage is the message the new device signs to commit to the public share of its refreshed share
+func reshareCommitMessage(session ReshareSession, publicShare string) []byte {
+	return []byte(fmt.Sprintf("signerService reshare commit\nuserId: %s\naccount: %s %s\nrecordId: %s\npublicShare: %s",
+		session.UserId, session.BlockchainId, session.AccountName, session.RecoveryId.Hex(), publicShare))
+}
+
+// signedSessionState returns the state of a session signed with the signing key of this service
+func signedSessionState(key ed25519.PrivateKey, session ReshareSession) (ReshareSessionState, error) {
+	if key == nil {
+		return ReshareSessionState{}, fmt.Errorf("reshare signing key is not configured")
+	}
+
+	state := ReshareSessionState{
+		RecordId:   session.RecoveryId.Hex(),
+		Identifier: session.Identifier,
+		SessionKey: session.SessionKey,
+		Status:     session.Status,
+		PubShares:  session.PubShares,
+	}
+	state.Signature = hex.EncodeToString(ed25519.Sign(key, reshareSessionMessage(session.UserId, session.BlockchainId, session.AccountName, state)))
+	return state, nil
+}
+
+// signReshareDealing signs a dealing with the signing key of this service
+func signReshareDealing(key ed25519.PrivateKey, userId, blockchainId, accountName string, dealing ReshareDealing) (string, error) {
+	if key == nil {
+		return "", fmt.Errorf("reshare signing key is not configured")
+	}
+	return hex.EncodeToString(ed25519.Sign(key, reshareDealingMessage(userId, blockchainId, accountName, dealing))), nil
+}
+
+// verifyPeerSignature checks a signature of the pinned key of a peer
+func verifyPeerSignature(peer ResharePeer, message []byte, signature string) error {
+	pk, err := parseEDDSAPublicKey(peer.PublicKey)
+	if err != nil {
+		return err
+	}
+	sig, err := parseEDDSASignature(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pk, message, sig) {
+		return fmt.Errorf("invalid signature of reshare peer %d", peer.Identifier)
+	}
+	return nil
+}
+
+// verifyDealingSignature checks that the dealing was signed by the pinned key of its dealer
+func verifyDealingSignature(peers map[uint32]ResharePeer, userId, blockchainId, accountName string, dealing ReshareDealing) error {
+	peer, ok := peers[dealing.DealerId]
+	if !ok {
+		return fmt.Errorf("participant %d is not a pinned reshare dealer", dealing.DealerId)
+	}
+	return verifyPeerSignature(peer, reshareDealingMessage(userId, blockchainId, accountName, dealing), dealing.Signature)
+}
+
+// fetchPeerSession reads the session state of the other dealer for an account and verifies it with the pinned key of the peer
+func fetchPeerSession(peer ResharePeer, userId, blockchainId, accountName string) (ReshareSessionState, error) {
+	requestURL := fmt.Sprintf("%s/api/reshareSession/%s/%s/%s", strings.TrimSuffix(peer.URL, "/"), url.PathEscape(userId), url.PathEscape(blockchainId), url.PathEscape(accountName))
+	resp, err := reshareHTTPClient.Get(requestURL)
+	if err != nil {
+		return ReshareSessionState{}, fmt.Errorf("Error reading session of reshare peer %d: %s", peer.Identifier, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ReshareSessionState{}, fmt.Errorf("Error reading session of reshare peer %d: peer returned status %d", peer.Identifier, resp.StatusCode)
+	}
+
+	var response struct {
+		Result ReshareSessionState `json:"result"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return ReshareSessionState{}, fmt.Errorf("Error decoding session of reshare peer %d: %s", peer.Identifier, err)
+	}
+
+	state := response.Result
+	if state.Identifier != peer.Identifier {
+		return state, fmt.Errorf("session of reshare peer %d names participant %d", peer.Identifier, state.Identifier)
+	}
+	return state, verifyPeerSignature(peer, reshareSessionMessage(userId, blockchainId, accountName, state), state.Signature)
+}
+
+// peerCommitted checks that the other dealer committed to the refreshed public shares of the session
+func peerCommitted(session ReshareSession, state ReshareSessionState) error {
+	if state.RecordId != session.RecoveryId.Hex() {
+		return fmt.Errorf("session of participant %d belongs to another recovery", state.Identifier)
+	}
+	if state.Status != ReshareCommitted && state.Status != ReshareComplete {
+		return fmt.Errorf("participant %d has not committed the reshare", state.Identifier)
+	}
+	if len(state.PubShares) != len(session.PubShares) {
+		return fmt.Errorf("participant %d committed to other refreshed public shares", state.Identifier)
+	}
+	for id, pubShare := range session.PubShares {
+		if state.PubShares[id] != pubShare {
+			return fmt.Errorf("participant %d committed to other refreshed public shares", state.Identifier)
+		}
+	}
+	return nil
+}
+
+// verifyDeviceCommit checks that the key of the new device approved with the recovery signed the commit to its public share
+func verifyDeviceCommit(session ReshareSession, request ReshareCompleteRequest) error {
+	point, err := pointToPublicKey(request.PublicShare)
+	if err != nil {
+		return err
+	}
+	deviceKey, err := hex.DecodeString(strings.TrimPrefix(session.DeviceKey, "0x"))
+	if err != nil || session.DeviceKey == "" {
+		return fmt.Errorf("reshare session has no device key")
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(request.Signature, "0x"))
+	if err != nil || len(signature) != crypto.SignatureLength {
+		return fmt.Errorf("invalid device signature")
+	}
+
+	hash := crypto.Keccak256(reshareCommitMessage(session, hex.EncodeToString(crypto.CompressPubkey(point))))
+	if !crypto.VerifySignature(deviceKey, hash, signature[:crypto.RecoveryIDOffset]) {
+		return fmt.Errorf("invalid device signature")
+	}
+	return nil
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// splitSecret returns 2 of 3 shamir shares of secret as key shares of participants 1, 2 and 3
+func splitSecret(secret, slope *big.Int) map[uint32]KeyShare {
+	values := make(map[uint32]*big.Int)
+	pubShares := make(map[string]string)
+	for id := uint32(1); id <= 3; id++ {
+		value := new(big.Int).Mul(slope, big.NewInt(int64(id)))
+		value.Add(value, secret)
+		values[id] = value.Mod(value, secp256k1N)
+		pubShareJSON, _ := json.Marshal(ECDSAPublicShare{Point: publicKeyToPoint(scalarBaseMult(values[id]))})
+		pubShares[strconv.FormatUint(uint64(id), 10)] = string(pubShareJSON)
+	}
+
+	shares := make(map[uint32]KeyShare)
+	for id, value := range values {
+		share := KeyShare{}
+		share.ShareData.PK = encodePublicKey(scalarBaseMult(secret))
+		shareValueJSON, _ := json.Marshal(ECDSAShareValue{Identifier: id, Value: value, Point: publicKeyToPoint(scalarBaseMult(value))})
+		share.ShareData.Share = string(shareValueJSON)
+		share.ShareData.PubShares = pubShares
+		shares[id] = share
+	}
+	return shares
+}
+
+// interpolate returns the secret shared by two shares
+func interpolate(ids []uint32, values []*big.Int) *big.Int {
+	secret := new(big.Int)
+	for i, id := range ids {
+		secret.Add(secret, new(big.Int).Mul(lagrangeCoefficient(id, ids), values[i]))
+	}
+	return secret.Mod(secret, secp256k1N)
+}
+
+func TestReshareRefreshesShares(t *testing.T) {
+	secret := big.NewInt(123456789)
+	shares := splitSecret(secret, big.NewInt(987654321))
+
+	commitments := make(map[uint32][]ECDSAPoint)
+	dealt := make(map[uint32]map[uint32]*big.Int)
+	for _, dealer := range ReshareDealers {
+		shareValue, err := decodeShareValue(shares[dealer])
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitments[dealer], dealt[dealer], err = dealReshare(shareValue, ReshareDealers, reshareRecipients(shares[dealer]), ReshareThreshold, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// each dealer verifies the dealing of the other and combines its sub-shares
+	refreshed := make(map[uint32]*big.Int)
+	var pubShares map[string]string
+	for _, recipient := range ReshareDealers {
+		subShares := make(map[string]*big.Int)
+		for _, dealer := range ReshareDealers {
+			dealing := ReshareDealing{DealerId: dealer, Commitments: commitments[dealer]}
+			err := verifyReshareDealing(shares[recipient], dealing, recipient, dealt[dealer][recipient])
+			if err != nil {
+				t.Fatal(err)
+			}
+			subShares[strconv.FormatUint(uint64(dealer), 10)] = dealt[dealer][recipient]
+		}
+
+		shareValueJSON, recipientPubShares, err := combineReshare(shares[recipient], recipient, commitments, subShares)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var shareValue ECDSAShareValue
+		json.Unmarshal([]byte(shareValueJSON), &shareValue)
+		refreshed[recipient] = shareValue.Value
+
+		if pubShares != nil && recipientPubShares[strconv.FormatUint(uint64(MobileIdentifier), 10)] != pubShares[strconv.FormatUint(uint64(MobileIdentifier), 10)] {
+			t.Error("Dealers derived different public shares for the new device")
+		}
+		pubShares = recipientPubShares
+	}
+
+	device := new(big.Int)
+	for _, dealer := range ReshareDealers {
+		device.Add(device, dealt[dealer][MobileIdentifier])
+	}
+	refreshed[MobileIdentifier] = device.Mod(device, secp256k1N)
+
+	err := verifyDevicePublicShare(pubShares, publicKeyToPoint(scalarBaseMult(refreshed[MobileIdentifier])))
+	if err != nil {
+		t.Error(err)
+	}
+	if verifyDevicePublicShare(pubShares, publicKeyToPoint(scalarBaseMult(big.NewInt(1)))) == nil {
+		t.Error("Wrong device share accepted")
+	}
+
+	for _, pair := range [][]uint32{{1, 2}, {1, 3}, {2, 3}} {
+		if interpolate(pair, []*big.Int{refreshed[pair[0]], refreshed[pair[1]]}).Cmp(secret) != 0 {
+			t.Errorf("Refreshed shares %v do not reconstruct the secret", pair)
+		}
+	}
+
+	oldDevice, _ := decodeShareValue(shares[MobileIdentifier])
+	if interpolate([]uint32{1, 3}, []*big.Int{refreshed[1], oldDevice.Value}).Cmp(secret) == 0 {
+		t.Error("Old device share still combines with the refreshed shares")
+	}
+}
+
+func TestVerifyReshareDealing(t *testing.T) {
+	shares := splitSecret(big.NewInt(42), big.NewInt(7))
+
+	// dealer 2 re-shares a value other than its share
+	forged := ECDSAShareValue{Identifier: 2, Value: big.NewInt(99)}
+	commitments, subShares, err := dealReshare(forged, ReshareDealers, []uint32{1, 2, 3}, ReshareThreshold, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dealing := ReshareDealing{DealerId: 2, Commitments: commitments}
+	if verifyReshareDealing(shares[1], dealing, 1, subShares[1]) == nil {
+		t.Error("Dealing of a forged share accepted")
+	}
+
+	shareValue, _ := decodeShareValue(shares[2])
+	commitments, subShares, err = dealReshare(shareValue, ReshareDealers, []uint32{1, 2, 3}, ReshareThreshold, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dealing = ReshareDealing{DealerId: 2, Commitments: commitments}
+	if verifyReshareDealing(shares[1], dealing, 1, new(big.Int).Add(subShares[1], big.NewInt(1))) == nil {
+		t.Error("Sub-share not matching the commitments accepted")
+	}
+
+	// the sub-share is sealed to the session key of the other dealer
+	sessionKey, _ := crypto.GenerateKey()
+	sealed, err := sealShare(subShares[1].FillBytes(make([]byte, 32)), "", hex.EncodeToString(crypto.CompressPubkey(&sessionKey.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dealing.SubShares = map[string]SealedShare{"1": sealed}
+	opened, err := openReshareSubShare(dealing, 1, hex.EncodeToString(crypto.FromECDSA(sessionKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyReshareDealing(shares[1], dealing, 1, opened); err != nil {
+		t.Error(err)
+	}
+
+	if _, _, err := dealReshare(ECDSAShareValue{Identifier: 3, Value: big.NewInt(1)}, ReshareDealers, []uint32{1, 2, 3}, ReshareThreshold, rand.Reader); err == nil {
+		t.Error("Mobile participant accepted as dealer")
+	}
+}
+
+func TestValidateRecoveryMode(t *testing.T) {
+	mode, err := validateRecoveryMode("", []RecoveryAccount{{BlockchainId: "SOL", AccountName: "main"}})
+	if err != nil || mode != RecoveryModeExport {
+		t.Error("Recovery mode does not default to export")
+	}
+	if _, err := validateRecoveryMode(RecoveryModeReshare, []RecoveryAccount{{BlockchainId: "ETH", AccountName: "main"}}); err != nil {
+		t.Error(err)
+	}
+	if _, err := validateRecoveryMode(RecoveryModeReshare, []RecoveryAccount{{BlockchainId: "SOL", AccountName: "main"}}); err == nil {
+		t.Error("Reshare accepted for eddsa account")
+	}
+	if _, err := validateRecoveryMode("restore", nil); err == nil {
+		t.Error("Unknown recovery mode accepted")
+	}
+
+	deviceKey, _ := crypto.GenerateKey()
+	if err := validateDeviceKey(RecoveryModeReshare, hex.EncodeToString(crypto.CompressPubkey(&deviceKey.PublicKey))); err != nil {
+		t.Error(err)
+	}
+	for _, invalid := range []string{"", "02abcd", hex.EncodeToString(make([]byte, 32))} {
+		if validateDeviceKey(RecoveryModeReshare, invalid) == nil {
+			t.Error("Reshare accepted with invalid device key:", invalid)
+		}
+	}
+	if err := validateDeviceKey(RecoveryModeExport, hex.EncodeToString(crypto.CompressPubkey(&deviceKey.PublicKey))); err != nil {
+		t.Error(err)
+	}
+	if err := validateDeviceKey(RecoveryModeExport, hex.EncodeToString(make([]byte, 32))); err != nil {
+		t.Error("X25519 device key rejected for export:", err)
+	}
+
+	allow := AllowPlaintextShareRelease
+	defer func() { AllowPlaintextShareRelease = allow }()
+	AllowPlaintextShareRelease = false
+	if validateDeviceKey(RecoveryModeExport, "") == nil {
+		t.Error("Export accepted without a device key")
+	}
+	AllowPlaintextShareRelease = true
+	if err := validateDeviceKey(RecoveryModeExport, ""); err != nil {
+		t.Error("Export without a device key should be accepted with plaintext release:", err)
+	}
+}
+
+func TestReceiveReshareDealingRejectsForgedDealing(t *testing.T) {
+	shares := splitSecret(big.NewInt(42), big.NewInt(7))
+	dealerPK, dealerSK, _ := ed25519.GenerateKey(rand.Reader)
+	_, attackerSK, _ := ed25519.GenerateKey(rand.Reader)
+	resharePeers := ResharePeers
+	ResharePeers = map[uint32]ResharePeer{2: {Identifier: 2, URL: "http://escrow", PublicKey: hex.EncodeToString(dealerPK)}}
+	defer func() { ResharePeers = resharePeers }()
+
+	// without dealer 2's share, C0 = lambda * P2 and C1 = s * G - C0 commit participant 1 to any chosen s
+	var dealerShare ECDSAPublicShare
+	json.Unmarshal([]byte(shares[1].ShareData.PubShares["2"]), &dealerShare)
+	dealerPoint, _ := pointToPublicKey(dealerShare.Point)
+	constant := scalarMult(dealerPoint, lagrangeCoefficient(2, ReshareDealers))
+	chosen := big.NewInt(1234)
+	slope := addPoints(scalarBaseMult(chosen), scalarMult(constant, new(big.Int).Sub(secp256k1N, big.NewInt(1))))
+
+	sessionKey, _ := crypto.GenerateKey()
+	dealing := ReshareDealing{
+		DealerId:    2,
+		RecordId:    primitive.NewObjectID().Hex(),
+		SessionKey:  hex.EncodeToString(crypto.CompressPubkey(&sessionKey.PublicKey)),
+		Commitments: []ECDSAPoint{publicKeyToPoint(constant), publicKeyToPoint(slope)},
+	}
+	if err := verifyReshareDealing(shares[1], dealing, 1, chosen); err != nil {
+		t.Fatal("Forged dealing should pass the Feldman check:", err)
+	}
+
+	signedByAttacker := dealing
+	signedByAttacker.Signature = hex.EncodeToString(ed25519.Sign(attackerSK, reshareDealingMessage("user1", "ETH", "main", dealing)))
+	for _, forged := range []ReshareDealing{dealing, signedByAttacker} {
+		body, _ := json.Marshal(forged)
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Params = gin.Params{{Key: "userId", Value: "user1"}, {Key: "blockchainId", Value: "ETH"}, {Key: "accountName", Value: "main"}}
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/receiveReshareDealing/user1/ETH/main", bytes.NewReader(body))
+
+		ReceiveReshareDealing(c)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Error("Forged dealing should be unauthorized, status:", recorder.Code)
+		}
+	}
+
+	dealing.Signature = hex.EncodeToString(ed25519.Sign(dealerSK, reshareDealingMessage("user1", "ETH", "main", dealing)))
+	if err := verifyDealingSignature(ResharePeers, "user1", "ETH", "main", dealing); err != nil {
+		t.Error(err)
+	}
+
+	// a signed dealing does not verify for another session or recovery
+	otherSession, otherRecord := dealing, dealing
+	otherSession.SessionKey = hex.EncodeToString(crypto.CompressPubkey(scalarBaseMult(chosen)))
+	otherRecord.RecordId = primitive.NewObjectID().Hex()
+	for _, replayed := range []ReshareDealing{otherSession, otherRecord} {
+		if verifyDealingSignature(ResharePeers, "user1", "ETH", "main", replayed) == nil {
+			t.Error("Dealing signature accepted for another session")
+		}
+	}
+}
+
+func TestFetchPeerSession(t *testing.T) {
+	peerPK, peerSK, _ := ed25519.GenerateKey(rand.Reader)
+	_, attackerSK, _ := ed25519.GenerateKey(rand.Reader)
+	session := ReshareSession{UserId: "user1", BlockchainId: "ETH", AccountName: "main", RecoveryId: primitive.NewObjectID(), Identifier: 2, SessionKey: "02ab", Status: ReshareCommitted, PubShares: map[string]string{"1": "a", "2": "b", "3": "c"}}
+
+	var served ReshareSessionState
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/reshareSession/user1/ETH/main" {
+			http.NotFound(w, r)
+			return
+		}
+		ValidateAndWriteResponse(served, nil, w)
+	}))
+	defer server.Close()
+	peer := ResharePeer{Identifier: 2, URL: server.URL, PublicKey: hex.EncodeToString(peerPK)}
+
+	served, _ = signedSessionState(peerSK, session)
+	state, err := fetchPeerSession(peer, "user1", "ETH", "main")
+	if err != nil || state.SessionKey != session.SessionKey {
+		t.Fatal("Signed peer session should verify:", err)
+	}
+
+	// this service's session committed to the same refreshed public shares
+	own := session
+	own.Identifier = 1
+	if err := peerCommitted(own, state); err != nil {
+		t.Error(err)
+	}
+	own.PubShares = map[string]string{"1": "a", "2": "b", "3": "x"}
+	if peerCommitted(own, state) == nil {
+		t.Error("Peer commit to other public shares accepted")
+	}
+
+	tampered := served
+	tampered.SessionKey = "03cd"
+	forged, _ := signedSessionState(attackerSK, session)
+	for _, invalid := range []ReshareSessionState{tampered, forged} {
+		served = invalid
+		if _, err := fetchPeerSession(peer, "user1", "ETH", "main"); err == nil {
+			t.Error("Peer session not signed by the pinned key accepted")
+		}
+	}
+}
+
+func TestVerifyDeviceCommit(t *testing.T) {
+	deviceKey, _ := crypto.GenerateKey()
+	otherKey, _ := crypto.GenerateKey()
+	session := ReshareSession{UserId: "user1", BlockchainId: "ETH", AccountName: "main", RecoveryId: primitive.NewObjectID(), DeviceKey: hex.EncodeToString(crypto.CompressPubkey(&deviceKey.PublicKey))}
+	publicShare := scalarBaseMult(big.NewInt(77))
+
+	sign := func(key *ecdsa.PrivateKey, session ReshareSession) string {
+		signature, _ := crypto.Sign(crypto.Keccak256(reshareCommitMessage(session, hex.EncodeToString(crypto.CompressPubkey(publicShare)))), key)
+		return hex.EncodeToString(signature)
+	}
+
+	if err := verifyDeviceCommit(session, ReshareCompleteRequest{PublicShare: publicKeyToPoint(publicShare), Signature: sign(deviceKey, session)}); err != nil {
+		t.Error(err)
+	}
+
+	otherRecord := session
+	otherRecord.RecoveryId = primitive.NewObjectID()
+	invalid := []ReshareCompleteRequest{
+		{PublicShare: publicKeyToPoint(publicShare), Signature: sign(otherKey, session)},
+		{PublicShare: publicKeyToPoint(publicShare), Signature: sign(deviceKey, otherRecord)},
+		{PublicShare: publicKeyToPoint(scalarBaseMult(big.NewInt(78))), Signature: sign(deviceKey, session)},
+		{PublicShare: publicKeyToPoint(publicShare)},
+	}
+	for _, request := range invalid {
+		if verifyDeviceCommit(session, request) == nil {
+			t.Error("Device commit not signed by the approved device key accepted")
+		}
+	}
+}
+
+func TestReshareRollbackWindow(t *testing.T) {
+	now := time.Now().UTC()
+	finalized := ReshareSession{
+		Status:            ReshareComplete,
+		PreviousPubShares: map[string]string{"1": "02aa"},
+		Secrets:           []string{"sealed"},
+		RollbackUntil:     now.Add(ReshareRollbackWindow),
+	}
+	if err := reshareRollbackOpen(finalized, now); err != nil {
+		t.Error("Finalized session should roll back within its window:", err)
+	}
+	if reshareRollbackOpen(finalized, now.Add(ReshareRollbackWindow)) == nil {
+		t.Error("Finalized session should not roll back after its window")
+	}
+
+	// a completed recovery purged the replaced share
+	purged := finalized
+	purged.Secrets = nil
+	purged.PreviousPubShares = nil
+	if reshareRollbackOpen(purged, now) == nil {
+		t.Error("Purged session should not roll back")
+	}
+	if err := reshareRollbackOpen(ReshareSession{Status: ReshareCommitted}, now); err != nil {
+		t.Error("Open session should roll back:", err)
+	}
+}
+
+func TestPurgeRecoveryReshares(t *testing.T) {
+	recoveryId := primitive.NewObjectID()
+	reshareCollection, mock := newMockCollection(t, updatedResponse(2))
+	if err := purgeRecoveryReshares(recoveryId, time.Now().UTC(), reshareCollection); err != nil {
+		t.Fatal(err)
+	}
+
+	updates, _ := mock.command(0).Lookup("updates").Array().Values()
+	update := updates[0].Document()
+	if update.Lookup("q", "recoveryId").ObjectID() != recoveryId {
+		t.Error("Purge should select the sessions of the recovery")
+	}
+	if update.Lookup("multi").Boolean() != true {
+		t.Error("Purge should update every session of the recovery")
+	}
+	unset := update.Lookup("u", "$unset").Document()
+	if _, err := unset.LookupErr("secrets"); err != nil {
+		t.Error("Completed session should no longer hold the replaced share")
+	}
+	if _, err := unset.LookupErr("previousPubShares"); err != nil {
+		t.Error("Completed session should no longer hold the replaced public shares")
+	}
+
+	// the session decoded after the purge holds nothing to roll back to
+	var session ReshareSession
+	purged := bson.M{"recoveryId": recoveryId, "status": ReshareComplete, "rollbackUntil": time.Now().Add(ReshareRollbackWindow)}
+	data, _ := bson.Marshal(purged)
+	if bson.Unmarshal(data, &session) != nil || reshareRollbackOpen(session, time.Now()) == nil {
+		t.Error("Purged session should not roll back")
+	}
+}
+
+func TestRecoveryReprovisioned(t *testing.T) {
+	record := RecoveryRecord{
+		Mode: RecoveryModeReshare,
+		Accounts: []RecoveryAccount{
+			{BlockchainId: "ETH", AccountName: "main", Status: RecoveryAccountReprovisioned},
+			{BlockchainId: "ETH", AccountName: "savings", Status: RecoveryAccountPending},
+		},
+	}
+	// the reshare of ETH savings is still open
+	if recoveryReprovisioned(record) == nil {
+		t.Error("Recovery should not complete while a reshare session is open")
+	}
+
+	record.Accounts[1].Status = RecoveryAccountReprovisioned
+	if err := recoveryReprovisioned(record); err != nil {
+		t.Error(err)
+	}
+	if err := recoveryReprovisioned(RecoveryRecord{Mode: RecoveryModeExport, Accounts: []RecoveryAccount{{Status: RecoveryAccountPending}}}); err != nil {
+		t.Error("Export recoveries complete without re-provisioning:", err)
+	}
+}
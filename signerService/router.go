@@ -12,10 +12,88 @@ func NewRouter(router *gin.Engine) {
 		wsHandler(c)
 	})
 
+	// websocket route for signing a raw message with the blockchain specific signed message
+	// prefix (EIP-191 for ETH/AVAX/BNB/MATIC, BIP-137 for BTC) using joint ecdsa signing
+	router.GET("/WSSignMessage/:userId/:blockchainId/:accountName", func(c *gin.Context) {
+		wsMessageHandler(c)
+	})
+
 	//postEDDSASignature provides api endpoint for sending partial eddsa signature
 	// and completing the signing and aggregation using the custody service
 	router.POST("/api/postEDDSASignature/:userId/:blockchainId/:accountName", HandlerWrap(POSTEDDSASignature))
 
+	//postCardanoSignature provides api endpoint for signing a cardano CBOR transaction body
+	// with the eddsa custody share and returning the signed transaction with its vkey witness
+	router.POST("/api/postCardanoSignature/:userId/:accountName", HandlerWrap(POSTCardanoSignature))
+
+	//prepareAlgorandTransaction provides api endpoint for encoding an algorand transaction or
+	// atomic transfer group and returning the payloads for the partial eddsa signatures
+	router.POST("/api/prepareAlgorandTransaction/:userId/:accountName", HandlerWrap(PrepareAlgorandTransaction))
+
+	//postAlgorandSignature provides api endpoint for completing the eddsa signing of a prepared
+	// algorand transaction or group with the custody share
+	router.POST("/api/postAlgorandSignature/:userId/:accountName", HandlerWrap(POSTAlgorandSignature))
+
+	//prepareEDDSATransaction provides api endpoint for returning the payload of a solana or stellar
+	// transaction that the client signs for the joint eddsa signature
+	router.POST("/api/prepareEDDSATransaction/:userId/:blockchainId/:accountName", HandlerWrap(PrepareEDDSATransaction))
+
+	//postEDDSATransaction provides api endpoint for completing the eddsa signing of a solana or
+	// stellar transaction and returning the assembled signed transaction
+	router.POST("/api/postEDDSATransaction/:userId/:blockchainId/:accountName", HandlerWrap(POSTEDDSATransaction))
+
+	//buildTokenTransaction provides api endpoint for building the calldata of an ERC20 transfer
+	// or approve of a registry token from a human readable amount
+	router.POST("/api/buildTokenTransaction/:blockchainId", HandlerWrap(BuildTokenTransaction))
+
+	//decodeEVMTransaction provides api endpoint for decoding the calldata of an EVM transaction
+	// into a readable summary of the method, recipient, amount and token
+	router.POST("/api/decodeEVMTransaction/:blockchainId", HandlerWrap(DecodeEVMTransaction))
+
+	//postTransaction provides api endpoint for recording a transaction of a user and optionally
+	// broadcasting it, broadcast transactions are tracked until they are confirmed
+	router.POST("/api/postTransaction/:userId", HandlerWrap(PostTransaction))
+
+	//getTransactions provides api endpoint for listing the recorded transactions of a user
+	router.GET("/api/getTransactions/:userId", HandlerWrap(GetTransactions))
+
+	//getTransaction provides api endpoint for reading a recorded transaction by its tx hash
+	router.GET("/api/getTransaction/:userId/:txHash", HandlerWrap(GetTransaction))
+
+	//reserveNonce provides api endpoint for reserving the next free nonce of an EVM account
+	router.POST("/api/reserveNonce/:userId/:blockchainId/:accountName", HandlerWrap(ReserveNonce))
+
+	//reserveNonce provides api endpoint for releasing an unused nonce or the nonce of a
+	// transaction that was never broadcast
+	router.DELETE("/api/reserveNonce/:userId/:blockchainId/:accountName", HandlerWrap(ReleaseNonce))
+
+	//syncUTXOs provides api endpoint for refreshing the unspent outputs of a BTC account from the indexer
+	router.POST("/api/syncUTXOs/:userId/:accountName", HandlerWrap(SyncUTXOs))
+
+	//getUTXOs provides api endpoint for listing the stored unspent outputs of a BTC account
+	router.GET("/api/getUTXOs/:userId/:accountName", HandlerWrap(GetUTXOs))
+
+	//prepareBitcoinTransaction provides api endpoint for selecting the inputs of a BTC transaction and
+	// returning the unsigned PSBT with the signature hash of every input for MPC signing
+	router.POST("/api/prepareBitcoinTransaction/:userId/:accountName", HandlerWrap(PrepareBitcoinTransaction))
+
+	//getPublicKey provides api endpoint for the public key of an account in SEC1, PEM, JWK and xpub form
+	router.GET("/api/getPublicKey/:userId/:blockchainId/:accountName", HandlerWrap(GetPublicKey))
+
+	//verifySignature provides api endpoint for verifying a signature against the public key of an account
+	router.POST("/api/verifySignature/:userId/:blockchainId/:accountName", HandlerWrap(VerifySignature))
+
+	//getAvalancheAddresses provides api endpoint for the C, X and P chain addresses of an AVAX account
+	router.GET("/api/getAvalancheAddresses/:userId/:accountName", HandlerWrap(GetAvalancheAddresses))
+
+	//prepareAvalancheTransaction provides api endpoint for validating an X, P or C chain import or export
+	// transaction and returning the hash signed in the MPC signing flow
+	router.POST("/api/prepareAvalancheTransaction/:userId/:chain/:accountName", HandlerWrap(PrepareAvalancheTransaction))
+
+	//postAvalancheSignature provides api endpoint for adding the MPC signature credentials to an X, P or
+	// C chain import or export transaction
+	router.POST("/api/postAvalancheSignature/:userId/:chain/:accountName", HandlerWrap(POSTAvalancheSignature))
+
 	//postShare provides api endpoint for saving key share data from a customer for
 	// a specific blockchain that uses ecdsa signing algorithm
 	router.POST("/api/postECDSAShare", HandlerWrap(PostECDSAKeyShare))
@@ -24,7 +102,7 @@ func NewRouter(router *gin.Engine) {
 
 	//getShare provides api endpoint for retriving key share data from a customer for
 	// a specific blockchain that uses ecdsa signing algorithm. This should only be accessible
-	// after prolong verification process
+	// after prolong verification process. The share is sealed to the publicKey query parameter
 	router.GET("/api/getECDSAShare/:userId/:blockchainId/:accountName", HandlerWrap(GetECDSAKeyShare))
 
 	router.GET("/api/getEDDSAShare/:userId/:blockchainId/:accountName", HandlerWrap(GetEDDSAKeyShare))
@@ -33,14 +111,68 @@ func NewRouter(router *gin.Engine) {
 	// This should only be accessible after prolong verification process
 	router.GET("/api/getUserAccounts/:userId", HandlerWrap(GetUserAccounts))
 
+	//getDerivedAddresses provides api endpoint for listing the addresses of the non-hardened
+	// child keys m/0/i of an account, signing for a child uses the derivationPath websocket query
+	router.GET("/api/getDerivedAddresses/:userId/:blockchainId/:accountName", HandlerWrap(GetDerivedAddresses))
+
+	//getTokens provides api endpoint for listing the supported tokens of the token registry,
+	// optionally filtered with the blockchainId and network query parameters
+	router.GET("/api/getTokens", HandlerWrap(GetTokens))
+
+	//getBalance provides api endpoint for reading the native and registry token balances
+	// of an EVM account from the configured blockchain node
+	router.GET("/api/getBalance/:userId/:blockchainId/:accountName", HandlerWrap(GetAccountBalance))
+
+	//getBalances provides api endpoint for reading the balances of every EVM account of a user on a blockchain
+	router.GET("/api/getBalances/:userId/:blockchainId", HandlerWrap(GetAccountBalances))
+
+	//enrollMFA provides api endpoint for creating the TOTP secret of a user
+	router.POST("/api/enrollMFA/:userId", HandlerWrap(EnrollMFA))
+
+	//confirmMFA provides api endpoint for activating a TOTP enrollment with the first code
+	router.POST("/api/confirmMFA/:userId", HandlerWrap(ConfirmMFA))
+
+	//resetMFA provides api endpoint for removing the TOTP enrollment of a user who lost the authenticator
+	router.POST("/api/resetMFA/:userId", HandlerWrap(ResetMFA))
+
 	//recoverUserAccounts provides api endpoint for creating and updating the recovery record
-	// to manage release of key shares
+	// to manage release of key shares, initiate names the accounts and every later transition needs a TOTP code
 	router.POST("/api/recoverUserAccounts/:userId", HandlerWrap(RecoverUserAccounts))
 
 	//recoverUserAccounts provides api endpoint for creating and updating the recovery record
 	// to manage release of key shares
 	router.GET("/api/recoverUserAccounts/:userId", HandlerWrap(GetRecoverUserAccountsStatus))
 
+	//decideRecovery provides api endpoint for operators to approve or reject a recovery with a signed decision
+	router.POST("/api/decideRecovery/:userId", HandlerWrap(DecideRecovery))
+
+	//getRecoveryHistory provides api endpoint for every recovery of a user including ended ones
+	router.GET("/api/getRecoveryHistory/:userId", HandlerWrap(GetRecoveryHistory))
+
+	//cancelRecovery provides api endpoint for the user to stop a recovery before the shares are released
+	router.POST("/api/cancelRecovery/:userId", HandlerWrap(CancelRecovery))
+
+	//startReshare provides api endpoint to open a re-sharing session for an account of a reshare mode recovery
+	router.POST("/api/startReshare/:userId/:blockchainId/:accountName", HandlerWrap(StartReshare))
+
+	//reshareDealing provides api endpoint for the dealing of this service's fresh sub-shares
+	router.POST("/api/reshareDealing/:userId/:blockchainId/:accountName", HandlerWrap(DealReshare))
+
+	//receiveReshareDealing provides api endpoint to receive the dealing of the other re-sharing service
+	router.POST("/api/receiveReshareDealing/:userId/:blockchainId/:accountName", HandlerWrap(ReceiveReshareDealing))
+
+	//reshareSession provides api endpoint for the other re-sharing service to read the signed session state
+	router.GET("/api/reshareSession/:userId/:blockchainId/:accountName", HandlerWrap(GetReshareSession))
+
+	//completeReshare provides api endpoint for the new device to commit to its refreshed share
+	router.POST("/api/completeReshare/:userId/:blockchainId/:accountName", HandlerWrap(CompleteReshare))
+
+	//finalizeReshare provides api endpoint to replace the stored share once the device and the other dealer committed
+	router.POST("/api/finalizeReshare/:userId/:blockchainId/:accountName", HandlerWrap(FinalizeReshare))
+
+	//rollbackReshare provides api endpoint to end a re-sharing session and restore the replaced share
+	router.POST("/api/rollbackReshare/:userId/:blockchainId/:accountName", HandlerWrap(RollbackReshare))
+
 	//initiate request to generate paillier key
 	router.POST("/api/requestPaillierKey/:userId", HandlerWrap(RequestPaillierKey))
 
@@ -50,8 +182,14 @@ func NewRouter(router *gin.Engine) {
 	//initiate request to generate paillier key
 	router.DELETE("/api/requestPaillierKey/:userId", HandlerWrap(RemovePaillierKey))
 
-	//initiate request to get random paillier keys
-	router.GET("/api/requestPaillierKey", HandlerWrap(GetRandomPaillierKey))
+	//claimPaillierKeys provides api endpoint to reserve pool paillier keys for a user, each key is handed out once
+	router.POST("/api/claimPaillierKeys/:userId", HandlerWrap(ClaimPaillierKeys))
+
+	//paillierKeyClaims provides api endpoint for the audit of the pool keys a user received
+	router.GET("/api/paillierKeyClaims/:userId", HandlerWrap(GetPaillierKeyClaims))
+
+	//paillierPoolStatus provides api endpoint for the Paillier key pool depth and generation rate
+	router.GET("/api/paillierPoolStatus", HandlerWrap(GetPaillierPoolStatus))
 
 	return
 }
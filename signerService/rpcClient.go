@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Timeout of a single JSON-RPC request to a blockchain node
+const RPCTimeout = 10 * time.Second
+
+// EVMClient is the subset of an EVM JSON-RPC node used by the service
+type EVMClient interface {
+	BalanceAt(ctx context.Context, address string) (*big.Int, error)
+	CallContract(ctx context.Context, to string, data []byte) ([]byte, error)
+	NonceAt(ctx context.Context, address string) (uint64, error)
+	PendingNonceAt(ctx context.Context, address string) (uint64, error)
+	SendRawTransaction(ctx context.Context, rawTx []byte) error
+	TransactionReceipt(ctx context.Context, txHash string) (*TxReceipt, error)
+}
+
+// TxReceipt is the outcome of a mined transaction
+type TxReceipt struct {
+	Status      uint64 // 1 for success, 0 for a reverted transaction
+	BlockNumber uint64 // block the transaction was included in
+}
+
+// EVMClients holds the node client of every EVM blockchain with a configured <blockchainId>_RPC_URL
+var EVMClients map[string]EVMClient = loadEVMClients()
+
+func loadEVMClients() map[string]EVMClient {
+	clients := make(map[string]EVMClient)
+	for _, blockchainId := range []string{"ETH", "AVAX", "BNB", "MATIC"} {
+		if url, ok := os.LookupEnv(blockchainId + "_RPC_URL"); ok {
+			clients[blockchainId] = newJSONRPCClient(url)
+		}
+	}
+	return clients
+}
+
+// jsonRPCClient is an EVMClient talking JSON-RPC over http to a node
+type jsonRPCClient struct {
+	url        string
+	httpClient *http.Client
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newJSONRPCClient(url string) *jsonRPCClient {
+	return &jsonRPCClient{url: url, httpClient: &http.Client{Timeout: RPCTimeout}}
+}
+
+// BalanceAt returns the latest native balance of an address in the smallest unit
+func (client *jsonRPCClient) BalanceAt(ctx context.Context, address string) (*big.Int, error) {
+	var balance hexutil.Big
+	err := client.call(ctx, "eth_getBalance", []interface{}{address, "latest"}, &balance)
+	if err != nil {
+		return nil, err
+	}
+	return balance.ToInt(), nil
+}
+
+// CallContract executes a read only contract call against the latest block
+func (client *jsonRPCClient) CallContract(ctx context.Context, to string, data []byte) ([]byte, error) {
+	var result hexutil.Bytes
+	call := map[string]string{"to": to, "data": hexutil.Encode(data)}
+	err := client.call(ctx, "eth_call", []interface{}{call, "latest"}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// NonceAt returns the number of transactions of an address mined in the latest block
+func (client *jsonRPCClient) NonceAt(ctx context.Context, address string) (uint64, error) {
+	var nonce hexutil.Uint64
+	err := client.call(ctx, "eth_getTransactionCount", []interface{}{address, "latest"}, &nonce)
+	return uint64(nonce), err
+}
+
+// PendingNonceAt returns the next nonce of an address including transactions in the mempool
+func (client *jsonRPCClient) PendingNonceAt(ctx context.Context, address string) (uint64, error) {
+	var nonce hexutil.Uint64
+	err := client.call(ctx, "eth_getTransactionCount", []interface{}{address, "pending"}, &nonce)
+	return uint64(nonce), err
+}
+
+// SendRawTransaction submits a signed transaction to the node
+func (client *jsonRPCClient) SendRawTransaction(ctx context.Context, rawTx []byte) error {
+	var txHash string
+	return client.call(ctx, "eth_sendRawTransaction", []interface{}{hexutil.Encode(rawTx)}, &txHash)
+}
+
+// TransactionReceipt returns the receipt of a mined transaction, or nil while it is pending
+func (client *jsonRPCClient) TransactionReceipt(ctx context.Context, txHash string) (*TxReceipt, error) {
+	var receipt *struct {
+		Status      hexutil.Uint64 `json:"status"`
+		BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	}
+	err := client.call(ctx, "eth_getTransactionReceipt", []interface{}{txHash}, &receipt)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	return &TxReceipt{Status: uint64(receipt.Status), BlockNumber: uint64(receipt.BlockNumber)}, nil
+}
+
+func (client *jsonRPCClient) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error calling %s: %s", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error calling %s: node returned status %d", method, resp.StatusCode)
+	}
+
+	var rpcResp rpcResponse
+	err = json.NewDecoder(resp.Body).Decode(&rpcResp)
+	if err != nil {
+		return fmt.Errorf("Error decoding %s response: %s", method, err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("Error calling %s: %s (code %d)", method, rpcResp.Error.Message, rpcResp.Error.Code)
+	}
+
+	return json.Unmarshal(rpcResp.Result, result)
+}
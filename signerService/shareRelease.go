@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Schemes for sealing released shares to a client ephemeral public key
+const (
+	ShareSealECIES = "ecies-secp256k1"
+	ShareSealHPKE  = "hpke-x25519"
+)
+
+// RFC 9180 base mode suite DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, AES-128-GCM
+const (
+	hpkeKEMX25519    uint16 = 0x0020
+	hpkeKDFSHA256    uint16 = 0x0001
+	hpkeAEADAES128   uint16 = 0x0001
+	hpkeModeBase     byte   = 0x00
+	hpkeShareInfo           = "signerService share release"
+	hpkeKeySize             = 16
+	hpkeNonceSize           = 12
+	hpkeSharedSecret        = 32
+)
+
+// AllowPlaintextShareRelease keeps the plaintext share response for clients that cannot seal yet,
+// it is off unless ALLOW_PLAINTEXT_SHARE_RELEASE is true
+var AllowPlaintextShareRelease = os.Getenv("ALLOW_PLAINTEXT_SHARE_RELEASE") == "true"
+
+// releaseShare returns the share sealed to the client public key, the plaintext share is only
+// returned without a public key when plaintext release is enabled
+func releaseShare(share interface{}, scheme, publicKey string) (interface{}, error) {
+	if publicKey == "" {
+		if AllowPlaintextShareRelease {
+			return share, nil
+		}
+		return nil, fmt.Errorf("publicKey query parameter is required for share release")
+	}
+
+	plaintext, err := json.Marshal(share)
+	if err != nil {
+		return nil, err
+	}
+
+	return sealShare(plaintext, scheme, publicKey)
+}
+
+// recoveryRecipientKey returns the device key approved with the recovery record, released shares are only sealed
+// to it. A publicKey named by the caller must be that key
+func recoveryRecipientKey(recoveryRecord RecoveryRecord, publicKey string) (string, error) {
+	if publicKey != "" && !strings.EqualFold(strings.TrimPrefix(publicKey, "0x"), strings.TrimPrefix(recoveryRecord.DeviceKey, "0x")) {
+		return "", fmt.Errorf("publicKey is not the device key approved with the recovery")
+	}
+	return recoveryRecord.DeviceKey, nil
+}
+
+// sealShare encrypts the share with ECIES to a secp256k1 public key or with HPKE to an X25519 public key,
+// the scheme is inferred from the key length when it is not given
+func sealShare(plaintext []byte, scheme, publicKey string) (SealedShare, error) {
+	pkBytes, err := hex.DecodeString(strings.TrimPrefix(publicKey, "0x"))
+	if err != nil {
+		return SealedShare{}, fmt.Errorf("Error decoding public key: %s", err)
+	}
+	if scheme == "" {
+		scheme = ShareSealECIES
+		if len(pkBytes) == curve25519.PointSize {
+			scheme = ShareSealHPKE
+		}
+	}
+
+	switch scheme {
+	case ShareSealECIES:
+		pk, err := parseSEC1PublicKey(pkBytes)
+		if err != nil {
+			return SealedShare{}, err
+		}
+		ciphertext, err := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(pk), plaintext, nil, nil)
+		if err != nil {
+			return SealedShare{}, err
+		}
+		return SealedShare{Scheme: scheme, Ciphertext: base64.StdEncoding.EncodeToString(ciphertext)}, nil
+
+	case ShareSealHPKE:
+		enc, ciphertext, err := hpkeSeal(rand.Reader, pkBytes, []byte(hpkeShareInfo), plaintext)
+		if err != nil {
+			return SealedShare{}, err
+		}
+		return SealedShare{
+			Scheme:     scheme,
+			Enc:        hex.EncodeToString(enc),
+			Info:       hpkeShareInfo,
+			Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+		}, nil
+	}
+
+	return SealedShare{}, fmt.Errorf("unsupported share sealing scheme: %s", scheme)
+}
+
+// parseSEC1PublicKey parses a compressed or uncompressed secp256k1 public key
+func parseSEC1PublicKey(pkBytes []byte) (*ecdsa.PublicKey, error) {
+	if len(pkBytes) == 33 {
+		return crypto.DecompressPubkey(pkBytes)
+	}
+	if len(pkBytes) != 65 || pkBytes[0] != PubkeyUncompressed {
+		return nil, fmt.Errorf("public key must be a 33 or 65 byte SEC1 secp256k1 point")
+	}
+	return crypto.UnmarshalPubkey(pkBytes)
+}
+
+// hpkeSeal is the RFC 9180 single shot base mode SealBase with empty aad, it returns the encapsulated key and ciphertext
+func hpkeSeal(random io.Reader, pkR, info, plaintext []byte) ([]byte, []byte, error) {
+	if len(pkR) != curve25519.PointSize {
+		return nil, nil, fmt.Errorf("public key must be a 32 byte X25519 key")
+	}
+
+	skE := make([]byte, curve25519.ScalarSize)
+	_, err := io.ReadFull(random, skE)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc, err := curve25519.X25519(skE, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	dh, err := curve25519.X25519(skE, pkR)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, nonce, err := hpkeKeySchedule(hpkeSharedSecretFromDH(dh, enc, pkR), info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return enc, aead.Seal(nil, nonce, plaintext, nil), nil
+}
+
+// hpkeSharedSecretFromDH is the DHKEM ExtractAndExpand of the X25519 shared secret
+func hpkeSharedSecretFromDH(dh, enc, pkR []byte) []byte {
+	kemSuite := hpkeSuiteId("KEM", hpkeKEMX25519)
+	kemContext := append(append([]byte{}, enc...), pkR...)
+
+	eaePRK := hpkeLabeledExtract(kemSuite, nil, "eae_prk", dh)
+	return hpkeLabeledExpand(kemSuite, eaePRK, "shared_secret", kemContext, hpkeSharedSecret)
+}
+
+// hpkeKeySchedule derives the AEAD key and base nonce of the base mode context
+func hpkeKeySchedule(sharedSecret, info []byte) (cipher.AEAD, []byte, error) {
+	suite := hpkeSuiteId("HPKE", hpkeKEMX25519, hpkeKDFSHA256, hpkeAEADAES128)
+
+	pskIdHash := hpkeLabeledExtract(suite, nil, "psk_id_hash", nil)
+	infoHash := hpkeLabeledExtract(suite, nil, "info_hash", info)
+	context := append(append([]byte{hpkeModeBase}, pskIdHash...), infoHash...)
+
+	secret := hpkeLabeledExtract(suite, sharedSecret, "secret", nil)
+	key := hpkeLabeledExpand(suite, secret, "key", context, hpkeKeySize)
+	nonce := hpkeLabeledExpand(suite, secret, "base_nonce", context, hpkeNonceSize)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, nonce, nil
+}
+
+func hpkeSuiteId(prefix string, ids ...uint16) []byte {
+	suite := []byte(prefix)
+	for _, id := range ids {
+		suite = binary.BigEndian.AppendUint16(suite, id)
+	}
+	return suite
+}
+
+func hpkeLabeledExtract(suite, salt []byte, label string, ikm []byte) []byte {
+	labeledIKM := append(append(append([]byte("HPKE-v1"), suite...), label...), ikm...)
+	return hkdf.Extract(sha256.New, labeledIKM, salt)
+}
+
+func hpkeLabeledExpand(suite, prk []byte, label string, info []byte, length int) []byte {
+	labeledInfo := binary.BigEndian.AppendUint16(nil, uint16(length))
+	labeledInfo = append(append(append(append(labeledInfo, "HPKE-v1"...), suite...), label...), info...)
+
+	out := make([]byte, length)
+	io.ReadFull(hkdf.Expand(sha256.New, prk, labeledInfo), out)
+	return out
+}
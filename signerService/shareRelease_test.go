@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"golang.org/x/crypto/curve25519"
+)
+
+func mustDecodeHex(t *testing.T, value string) []byte {
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestHPKEKeySchedule(t *testing.T) {
+	// RFC 9180 appendix A.1.1, DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, AES-128-GCM base mode
+	skE := mustDecodeHex(t, "52c4a758a802cd8b936eceea314432798d5baf2d7e9235dc084ab1b9cfa2f736")
+	skR := mustDecodeHex(t, "4612c550263fc8ad58375df3f557aac531d26850903e55a9f23f21d8534e8ac8")
+	pkR, _ := curve25519.X25519(skR, curve25519.Basepoint)
+	info := mustDecodeHex(t, "4f6465206f6e2061204772656369616e2055726e")
+
+	enc, _ := curve25519.X25519(skE, curve25519.Basepoint)
+	if hex.EncodeToString(enc) != "37fda3567bdbd628e88668c3c8d7e97d1d1253b6d4ea6d44c150f741f1bf4431" {
+		t.Fatal("Unexpected encapsulated key")
+	}
+	dh, _ := curve25519.X25519(skE, pkR)
+	sharedSecret := hpkeSharedSecretFromDH(dh, enc, pkR)
+	if hex.EncodeToString(sharedSecret) != "fe0e18c9f024ce43799ae393c7e8fe8fce9d218875e8227b0187c04e7d2ea1fc" {
+		t.Fatal("Unexpected shared secret:", hex.EncodeToString(sharedSecret))
+	}
+
+	aead, nonce, err := hpkeKeySchedule(sharedSecret, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(nonce) != "56d890e5accaaf011cff4b7d" {
+		t.Error("Unexpected base nonce:", hex.EncodeToString(nonce))
+	}
+	ciphertext := aead.Seal(nil, nonce, []byte("Beauty is truth, truth beauty"), []byte("Count-0"))
+	if hex.EncodeToString(ciphertext) != "f938558b5d72f1a23810b4be2ab4f84331acc02fc97babc53a52ae8218a355a96d8770ac83d07bea87e13c512a" {
+		t.Error("Unexpected ciphertext:", hex.EncodeToString(ciphertext))
+	}
+
+	sealedEnc, _, err := hpkeSeal(bytes.NewReader(skE), pkR, info, []byte("share"))
+	if err != nil || !bytes.Equal(sealedEnc, enc) {
+		t.Error("Seal should encapsulate with the ephemeral key", err)
+	}
+}
+
+func TestSealShareHPKE(t *testing.T) {
+	skR := make([]byte, curve25519.ScalarSize)
+	rand.Read(skR)
+	pkR, _ := curve25519.X25519(skR, curve25519.Basepoint)
+
+	sealed, err := sealShare([]byte(`{"share":1}`), "", hex.EncodeToString(pkR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed.Scheme != ShareSealHPKE {
+		t.Error("32 byte keys should be sealed with HPKE")
+	}
+
+	// open with the recipient key
+	enc := mustDecodeHex(t, sealed.Enc)
+	dh, _ := curve25519.X25519(skR, enc)
+	aead, nonce, _ := hpkeKeySchedule(hpkeSharedSecretFromDH(dh, enc, pkR), []byte(sealed.Info))
+	ciphertext, _ := base64.StdEncoding.DecodeString(sealed.Ciphertext)
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil || string(plaintext) != `{"share":1}` {
+		t.Error("Sealed share should open with the recipient key", err)
+	}
+}
+
+func TestSealShareECIES(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	share := KeyShare{UserId: "user1", AccountName: "main", BlockchainId: "ETH"}
+
+	for _, pk := range [][]byte{crypto.CompressPubkey(&key.PublicKey), crypto.FromECDSAPub(&key.PublicKey)} {
+		release, err := releaseShare(share, "", hex.EncodeToString(pk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed := release.(SealedShare)
+		if sealed.Scheme != ShareSealECIES {
+			t.Error("SEC1 keys should be sealed with ECIES")
+		}
+
+		ciphertext, _ := base64.StdEncoding.DecodeString(sealed.Ciphertext)
+		plaintext, err := ecies.ImportECDSA(key).Decrypt(ciphertext, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var opened KeyShare
+		if json.Unmarshal(plaintext, &opened) != nil || opened.UserId != share.UserId || opened.AccountName != share.AccountName {
+			t.Error("Sealed share should decrypt to the share")
+		}
+	}
+
+	if _, err := sealShare([]byte("share"), ShareSealHPKE, hex.EncodeToString(crypto.CompressPubkey(&key.PublicKey))); err == nil {
+		t.Error("HPKE should reject secp256k1 keys")
+	}
+}
+
+func TestRecoveryRecipientKey(t *testing.T) {
+	deviceKey, _ := crypto.GenerateKey()
+	otherKey, _ := crypto.GenerateKey()
+	record := RecoveryRecord{UserId: "user1", DeviceKey: hex.EncodeToString(crypto.CompressPubkey(&deviceKey.PublicKey))}
+
+	if key, err := recoveryRecipientKey(record, ""); err != nil || key != record.DeviceKey {
+		t.Error("Shares should be sealed to the device key of the record:", err)
+	}
+	if key, err := recoveryRecipientKey(record, "0x"+strings.ToUpper(record.DeviceKey)); err != nil || key != record.DeviceKey {
+		t.Error("The device key of the record should be accepted:", err)
+	}
+	if _, err := recoveryRecipientKey(record, hex.EncodeToString(crypto.CompressPubkey(&otherKey.PublicKey))); err == nil {
+		t.Error("A key other than the device key of the record should be rejected")
+	}
+	if _, err := recoveryRecipientKey(RecoveryRecord{UserId: "user1"}, hex.EncodeToString(crypto.CompressPubkey(&otherKey.PublicKey))); err == nil {
+		t.Error("A key should be rejected when the record names no device")
+	}
+}
+
+func TestReleaseSharePlaintext(t *testing.T) {
+	allow := AllowPlaintextShareRelease
+	defer func() { AllowPlaintextShareRelease = allow }()
+
+	AllowPlaintextShareRelease = false
+	if _, err := releaseShare(KeyShare{}, "", ""); err == nil {
+		t.Error("Plaintext release should be off by default")
+	}
+
+	AllowPlaintextShareRelease = true
+	if release, err := releaseShare(KeyShare{UserId: "user1"}, "", ""); err != nil || release.(KeyShare).UserId != "user1" {
+		t.Error("Plaintext release should return the share when enabled")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Signature curves of the supported blockchains
+const (
+	CurveSecp256k1 = "secp256k1"
+	CurveEd25519   = "ed25519"
+)
+
+// VerifySignature checks a signature claimed to come from an account against the account public key
+func VerifySignature(c *gin.Context) {
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+
+	var request SignatureRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&request)
+	if err != nil {
+		log.Error("Error decoding signature request: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	defer CloseClientDB(DB)
+
+	account, err := readAccount(userId, blockchainId, accountName, userCollection)
+	if err != nil {
+		log.Error("Error reading account err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	if account.PublicKey == "" {
+		// accounts created before the public key was saved are backfilled by backfillAccountPublicKeys at startup
+		log.Error("Error verifying signature, no stored public key, account: ", accountName)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: account %s has no stored public key", accountName), c.Writer)
+		return
+	}
+
+	result, err := verifyAccountSignature(blockchainId, account.PublicKey, request)
+	if err != nil {
+		log.Error("Error verifying signature err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	result.Address = account.Address
+
+	ValidateAndWriteResponse(result, nil, c.Writer)
+	return
+}
+
+// signatureCurve returns the curve used by the MPC shares of a blockchain
+func signatureCurve(blockchainId string) (string, error) {
+	switch blockchainId {
+	case "ETH", "BTC", "AVAX", "BNB", "MATIC":
+		return CurveSecp256k1, nil
+	case "ADA", "ALGO", "SOL", "XLM":
+		return CurveEd25519, nil
+	}
+
+	return "", fmt.Errorf("signature verification not supported for blockchain: %s", blockchainId)
+}
+
+// backfillAccountPublicKeys saves the group public key and chain code on the account records created
+// before they were stored at keygen. It runs once at startup so requests never read a key share,
+// accounts that fail are logged and retried at the next start
+func backfillAccountPublicKeys() {
+	var DB *mongo.Client = ConnectDB()
+	userCollection := DB.Database(MongoDatabase).Collection("UserCollection")
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+	defer CloseClientDB(DB)
+
+	accounts, err := readAccountsWithoutPublicKey(userCollection)
+	if err != nil {
+		log.Error("Error reading accounts without public key err:", err)
+		return
+	}
+
+	var backfilled int
+	for _, account := range accounts {
+		publicKey, chainCode, err := readSharePublicKey(account.UserId, account.BlockchainId, account.AccountName, keyShareCollection)
+		if err != nil {
+			log.Error("Error reading public key err:", err, ", account: ", account.ID.Hex())
+			continue
+		}
+		err = updateAccountPublicKey(account.UserId, account.BlockchainId, account.AccountName, publicKey, chainCode, userCollection)
+		if err != nil {
+			continue
+		}
+		backfilled++
+	}
+	log.Info("Backfilled account public keys: ", backfilled, " of ", len(accounts))
+}
+
+// readSharePublicKey reads the group public key and the chain code from the stored key share of an account
+func readSharePublicKey(userId, blockchainId, accountName string, keyShareCollection *mongo.Collection) (string, string, error) {
+	curve, err := signatureCurve(blockchainId)
+	if err != nil {
+		return "", "", err
+	}
+
+	if curve == CurveEd25519 {
+		share, err := readEDDSAShare(userId, blockchainId, accountName, keyShareCollection)
+		return share.PK, "", err
+	}
+	share, err := readECDSAShare(userId, blockchainId, accountName, keyShareCollection)
+	return share.ShareData.PK, share.ChainCode, err
+}
+
+// verifyAccountSignature verifies a signature with the curve and signature encoding of the blockchain,
+// malformed input is an error while a well formed signature that does not verify is reported as invalid
+func verifyAccountSignature(blockchainId, publicKey string, request SignatureRequest) (SignatureVerification, error) {
+	curve, err := signatureCurve(blockchainId)
+	if err != nil {
+		return SignatureVerification{}, err
+	}
+	result := SignatureVerification{Curve: curve}
+
+	if curve == CurveEd25519 {
+		pk, err := parseEDDSAPublicKey(publicKey)
+		if err != nil {
+			return result, err
+		}
+		payload, err := hex.DecodeString(strings.TrimPrefix(request.Hash, "0x"))
+		if err != nil {
+			return result, fmt.Errorf("Error decoding hash: %s", err)
+		}
+		sig, err := parseEDDSASignature(request.Signature)
+		if err != nil {
+			return result, err
+		}
+		result.Valid = ed25519.Verify(pk, payload, sig)
+		return result, nil
+	}
+
+	pk, err := parseECDSAPublicKey(publicKey)
+	if err != nil {
+		return result, err
+	}
+	hash, err := hex.DecodeString(strings.TrimPrefix(request.Hash, "0x"))
+	if err != nil || len(hash) != 32 {
+		return result, fmt.Errorf("hash must be 32 hex encoded bytes")
+	}
+	signature, recoveryId, err := parseECDSASignatureEncoding(request.Signature)
+	if err != nil {
+		return result, err
+	}
+	if signature.R.Sign() <= 0 || signature.R.Cmp(secp256k1N) >= 0 || signature.S.Sign() <= 0 || signature.S.Cmp(secp256k1N) >= 0 {
+		return result, nil
+	}
+
+	// MPC signatures may be in high s form, the recovery id flips with s
+	if signature.S.Cmp(secp256k1HalfN) > 0 && recoveryId >= 0 {
+		recoveryId ^= 1
+	}
+	sig, err := recoverableSignature(signature, hash, pk)
+	if err != nil {
+		return result, nil
+	}
+	result.Valid = recoveryId < 0 || int(sig[64]) == recoveryId
+	return result, nil
+}
+
+// parseECDSASignatureEncoding accepts the combined MPC signature JSON, hex encoded r || s with an optional
+// v byte (0, 1, 27 or 28) and base64 BIP-137 compact signatures. The recovery id is -1 when the encoding has none
+func parseECDSASignatureEncoding(encoded string) (ECDSASignature, int, error) {
+	encoded = strings.TrimSpace(encoded)
+	if strings.HasPrefix(encoded, "{") {
+		var signature ECDSASignature
+		err := json.Unmarshal([]byte(encoded), &signature)
+		if err != nil {
+			return signature, -1, fmt.Errorf("Error decoding signature: %s", err)
+		}
+		if signature.R == nil || signature.S == nil {
+			return signature, -1, fmt.Errorf("signature is missing r or s value")
+		}
+		return signature, -1, nil
+	}
+
+	if sig, err := hex.DecodeString(strings.TrimPrefix(encoded, "0x")); err == nil && (len(sig) == 64 || len(sig) == 65) {
+		signature := ECDSASignature{R: new(big.Int).SetBytes(sig[:32]), S: new(big.Int).SetBytes(sig[32:64])}
+		if len(sig) == 64 {
+			return signature, -1, nil
+		}
+		v := int(sig[64])
+		if v >= 27 {
+			v -= 27
+		}
+		if v > 1 {
+			return signature, -1, fmt.Errorf("invalid signature v value: %d", sig[64])
+		}
+		return signature, v, nil
+	}
+
+	if compact, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(compact) == 65 {
+		if compact[0] < 27 || compact[0] > 42 {
+			return ECDSASignature{}, -1, fmt.Errorf("invalid BIP-137 header: %d", compact[0])
+		}
+		signature := ECDSASignature{R: new(big.Int).SetBytes(compact[1:33]), S: new(big.Int).SetBytes(compact[33:65])}
+		return signature, int(compact[0]-27) % 4, nil
+	}
+
+	return ECDSASignature{}, -1, fmt.Errorf("unsupported signature encoding")
+}
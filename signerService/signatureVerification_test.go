@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestVerifyECDSASignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal("Error generating key")
+	}
+	other, _ := crypto.GenerateKey()
+	pk := encodePublicKey(&key.PublicKey)
+
+	hash := crypto.Keccak256([]byte("withdrawal"))
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal("Error signing hash")
+	}
+	otherSig, _ := crypto.Sign(hash, other)
+	highS := new(big.Int).Sub(secp256k1N, new(big.Int).SetBytes(sig[32:64]))
+
+	flipped := append([]byte{}, sig...)
+	flipped[64] ^= 1
+
+	tests := []struct {
+		name      string
+		signature string
+		valid     bool
+	}{
+		{"mpc json", fmt.Sprintf(`{"V":0,"R":%s,"S":%s}`, new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:64])), true},
+		{"mpc json high s", fmt.Sprintf(`{"V":0,"R":%s,"S":%s}`, new(big.Int).SetBytes(sig[:32]), highS), true},
+		{"hex r s", hex.EncodeToString(sig[:64]), true},
+		{"hex r s v", "0x" + hex.EncodeToString(append(sig[:64:64], sig[64]+27)), true},
+		{"hex wrong v", hex.EncodeToString(flipped), false},
+		{"bip137", base64.StdEncoding.EncodeToString(append([]byte{39 + sig[64]}, sig[:64]...)), true},
+		{"other key", hex.EncodeToString(otherSig), false},
+	}
+
+	for _, test := range tests {
+		result, err := verifyAccountSignature("ETH", pk, SignatureRequest{Hash: hex.EncodeToString(hash), Signature: test.signature})
+		if err != nil {
+			t.Fatal(test.name, err)
+		}
+		if result.Valid != test.valid || result.Curve != CurveSecp256k1 {
+			t.Error("Unexpected result for ", test.name, result)
+		}
+	}
+
+	_, err = verifyAccountSignature("ETH", pk, SignatureRequest{Hash: "0x1234", Signature: hex.EncodeToString(sig)})
+	if err == nil {
+		t.Error("Short hash should be rejected")
+	}
+}
+
+func TestVerifyEDDSASignature(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("Error generating key")
+	}
+	payload := []byte("solana message")
+	sig := ed25519.Sign(sk, payload)
+
+	result, err := verifyAccountSignature("SOL", hex.EncodeToString(pk), SignatureRequest{Hash: hex.EncodeToString(payload), Signature: base64.StdEncoding.EncodeToString(sig)})
+	if err != nil || !result.Valid || result.Curve != CurveEd25519 {
+		t.Error("Eddsa signature should verify", err)
+	}
+
+	result, err = verifyAccountSignature("SOL", hex.EncodeToString(pk), SignatureRequest{Hash: hex.EncodeToString([]byte("other")), Signature: hex.EncodeToString(sig)})
+	if err != nil || result.Valid {
+		t.Error("Eddsa signature over another payload should not verify")
+	}
+
+	_, err = verifyAccountSignature("DOGE", hex.EncodeToString(pk), SignatureRequest{})
+	if err == nil {
+		t.Error("Unsupported blockchain should be rejected")
+	}
+}
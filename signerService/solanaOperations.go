@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+// solanaAddress returns the base58 encoded solana address for an eddsa public key
+func solanaAddress(pk ed25519.PublicKey) string {
+	return base58.Encode(pk)
+}
+
+// prepareSolanaMessage returns the serialized solana message that is signed by every required signer.
+// The message is either given already serialized or is serialized from its legacy message fields
+func prepareSolanaMessage(txRequest EDDSATxRequest) ([]byte, error) {
+	if txRequest.SerializedMessage != "" {
+		message, err := base64.StdEncoding.DecodeString(txRequest.SerializedMessage)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding solana message: %s", err)
+		}
+		if len(message) < 4 {
+			return nil, fmt.Errorf("solana message is too short")
+		}
+		return message, nil
+	}
+
+	if txRequest.Message == nil {
+		return nil, fmt.Errorf("missing solana message")
+	}
+
+	return serializeSolanaMessage(*txRequest.Message)
+}
+
+// serializeSolanaMessage encodes a legacy solana message: header, account keys, recent blockhash and
+// the compiled instructions, using compact-u16 length prefixes for every array
+func serializeSolanaMessage(message SolanaMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(message.NumRequiredSignatures)
+	buf.WriteByte(message.NumReadonlySignedAccounts)
+	buf.WriteByte(message.NumReadonlyUnsignedAccounts)
+
+	writeCompactU16(&buf, len(message.AccountKeys))
+	for _, accountKey := range message.AccountKeys {
+		key, err := decodeSolanaKey(accountKey)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+	}
+
+	blockhash, err := decodeSolanaKey(message.RecentBlockhash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recent blockhash: %s", err)
+	}
+	buf.Write(blockhash)
+
+	writeCompactU16(&buf, len(message.Instructions))
+	for _, instruction := range message.Instructions {
+		if int(instruction.ProgramIdIndex) >= len(message.AccountKeys) {
+			return nil, fmt.Errorf("instruction program id index out of range")
+		}
+		buf.WriteByte(instruction.ProgramIdIndex)
+
+		writeCompactU16(&buf, len(instruction.Accounts))
+		for _, account := range instruction.Accounts {
+			if int(account) >= len(message.AccountKeys) {
+				return nil, fmt.Errorf("instruction account index out of range")
+			}
+			buf.WriteByte(account)
+		}
+
+		data, err := base64.StdEncoding.DecodeString(instruction.Data)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding instruction data: %s", err)
+		}
+		writeCompactU16(&buf, len(data))
+		buf.Write(data)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// assembleSolanaTransaction places the signature at the signer index of the account and returns the
+// serialized transaction together with its id, the base58 encoding of the first signature
+func assembleSolanaTransaction(message []byte, pk ed25519.PublicKey, signature []byte) ([]byte, string, error) {
+	headerOffset := solanaHeaderOffset(message)
+	numSignatures := int(message[headerOffset])
+	keys, err := solanaMessageAccountKeys(message)
+	if err != nil {
+		return nil, "", err
+	}
+
+	signerIndex := -1
+	for i := 0; i < numSignatures && i < len(keys); i++ {
+		if bytes.Equal(keys[i], pk) {
+			signerIndex = i
+			break
+		}
+	}
+	if signerIndex < 0 {
+		return nil, "", fmt.Errorf("account is not a required signer of the solana message")
+	}
+
+	signatures := make([][]byte, numSignatures)
+	for i := range signatures {
+		signatures[i] = make([]byte, ed25519.SignatureSize)
+	}
+	copy(signatures[signerIndex], signature)
+
+	var buf bytes.Buffer
+	writeCompactU16(&buf, numSignatures)
+	for _, sig := range signatures {
+		buf.Write(sig)
+	}
+	buf.Write(message)
+
+	return buf.Bytes(), base58.Encode(signatures[0]), nil
+}
+
+// solanaHeaderOffset returns where the message header starts, versioned messages are prefixed
+// with a byte that has the high bit set
+func solanaHeaderOffset(message []byte) int {
+	if message[0]&0x80 != 0 {
+		return 1
+	}
+	return 0
+}
+
+// solanaMessageAccountKeys returns the static account keys of a serialized solana message
+func solanaMessageAccountKeys(message []byte) ([][]byte, error) {
+	numKeys, offset, err := readCompactU16(message, solanaHeaderOffset(message)+3)
+	if err != nil {
+		return nil, err
+	}
+	if len(message) < offset+numKeys*ed25519.PublicKeySize {
+		return nil, fmt.Errorf("solana message is too short")
+	}
+
+	var keys [][]byte
+	for i := 0; i < numKeys; i++ {
+		start := offset + i*ed25519.PublicKeySize
+		keys = append(keys, message[start:start+ed25519.PublicKeySize])
+	}
+
+	return keys, nil
+}
+
+// decodeSolanaKey decodes a base58 encoded 32 byte account key or blockhash
+func decodeSolanaKey(key string) ([]byte, error) {
+	decoded := base58.Decode(key)
+	if len(decoded) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid solana key: %s", key)
+	}
+
+	return decoded, nil
+}
+
+// writeCompactU16 writes a solana compact-u16 length, 7 bits per byte with the high bit as continuation
+func writeCompactU16(buf *bytes.Buffer, value int) {
+	for {
+		b := byte(value & 0x7f)
+		value >>= 7
+		if value == 0 {
+			buf.WriteByte(b)
+			return
+		}
+		buf.WriteByte(b | 0x80)
+	}
+}
+
+// readCompactU16 reads a solana compact-u16 length at offset and returns the value and the next offset
+func readCompactU16(data []byte, offset int) (int, int, error) {
+	value := 0
+	for i := 0; i < 3; i++ {
+		if offset >= len(data) {
+			return 0, 0, fmt.Errorf("solana message is too short")
+		}
+		b := data[offset]
+		offset++
+		value |= int(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return value, offset, nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf("invalid compact-u16 length")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+// Stellar network passphrases, the hash of the passphrase prefixes every signed transaction
+var stellarNetworkPassphrases = map[string]string{
+	"public":  "Public Global Stellar Network ; September 2015",
+	"testnet": "Test SDF Network ; September 2015",
+}
+
+const (
+	stellarEnvelopeTypeTx      uint32 = 2      // ENVELOPE_TYPE_TX discriminant for v1 transaction envelopes
+	stellarAccountVersionByte  byte   = 6 << 3 // StrKey version byte for ed25519 public keys, encodes to "G"
+	stellarSignatureHintLength        = 4      // signature hint is the last 4 bytes of the public key
+)
+
+// stellarAddress returns the StrKey "G..." address for an eddsa public key
+func stellarAddress(pk ed25519.PublicKey) string {
+	payload := append([]byte{stellarAccountVersionByte}, pk...)
+	checksum := make([]byte, 2)
+	binary.LittleEndian.PutUint16(checksum, crc16XModem(payload))
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(append(payload, checksum...))
+}
+
+// decodeStellarEnvelope extracts the transaction XDR from a base64 unsigned v1 transaction envelope
+func decodeStellarEnvelope(envelope string) ([]byte, error) {
+	envelopeXDR, err := base64.StdEncoding.DecodeString(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding stellar envelope: %s", err)
+	}
+	if len(envelopeXDR) < 8 {
+		return nil, fmt.Errorf("stellar envelope is too short")
+	}
+
+	if binary.BigEndian.Uint32(envelopeXDR[:4]) != stellarEnvelopeTypeTx {
+		return nil, fmt.Errorf("only v1 stellar transaction envelopes are supported")
+	}
+	// an unsigned envelope ends with an empty signature array
+	if binary.BigEndian.Uint32(envelopeXDR[len(envelopeXDR)-4:]) != 0 {
+		return nil, fmt.Errorf("stellar envelope must not contain signatures")
+	}
+
+	return envelopeXDR[4 : len(envelopeXDR)-4], nil
+}
+
+// stellarTransactionHash returns the hash signed by every stellar signer:
+// sha256(sha256(network passphrase) || ENVELOPE_TYPE_TX || transaction XDR)
+func stellarTransactionHash(txXDR []byte, network string) ([]byte, error) {
+	if network == "" {
+		network = "public"
+	}
+	passphrase, ok := stellarNetworkPassphrases[network]
+	if !ok {
+		return nil, fmt.Errorf("unsupported stellar network: %s", network)
+	}
+
+	networkId := sha256.Sum256([]byte(passphrase))
+	var payload bytes.Buffer
+	payload.Write(networkId[:])
+	binary.Write(&payload, binary.BigEndian, stellarEnvelopeTypeTx)
+	payload.Write(txXDR)
+
+	hash := sha256.Sum256(payload.Bytes())
+	return hash[:], nil
+}
+
+// assembleStellarEnvelope returns the base64 XDR transaction envelope with the decorated signature
+func assembleStellarEnvelope(txXDR []byte, pk ed25519.PublicKey, signature []byte) string {
+	var envelope bytes.Buffer
+	binary.Write(&envelope, binary.BigEndian, stellarEnvelopeTypeTx)
+	envelope.Write(txXDR)
+
+	// DecoratedSignature<20>: one entry with the public key hint and the variable length signature
+	binary.Write(&envelope, binary.BigEndian, uint32(1))
+	envelope.Write(pk[len(pk)-stellarSignatureHintLength:])
+	binary.Write(&envelope, binary.BigEndian, uint32(len(signature)))
+	envelope.Write(signature)
+
+	return base64.StdEncoding.EncodeToString(envelope.Bytes())
+}
+
+// crc16XModem computes the CRC16-XModem checksum used by StrKey
+func crc16XModem(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
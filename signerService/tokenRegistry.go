@@ -0,0 +1,160 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Token standards supported by the registry
+const (
+	TokenStandardNative = "native"
+	TokenStandardERC20  = "ERC20"
+	TokenStandardERC721 = "ERC721"
+	TokenStandardASA    = "ASA"
+)
+
+// default token registry, overridden with the TOKEN_REGISTRY_FILE environment variable
+//
+//go:embed tokens.json
+var defaultTokenRegistry []byte
+
+// TokenRegistry lists the supported tokens keyed by blockchainId and network
+type TokenRegistry map[string]map[string][]Token
+
+// Tokens is the registry of supported tokens loaded at startup
+var Tokens TokenRegistry = loadTokenRegistry()
+
+func loadTokenRegistry() TokenRegistry {
+	data := defaultTokenRegistry
+	if path, ok := os.LookupEnv("TOKEN_REGISTRY_FILE"); ok {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			log.Fatal("Error reading token registry err:", err)
+		}
+	}
+
+	registry, err := parseTokenRegistry(data)
+	if err != nil {
+		log.Fatal("Error loading token registry err:", err)
+	}
+	return registry
+}
+
+// parseTokenRegistry decodes and validates a token registry config
+func parseTokenRegistry(data []byte) (TokenRegistry, error) {
+	var registry TokenRegistry
+	err := json.Unmarshal(data, &registry)
+	if err != nil {
+		return nil, err
+	}
+
+	for blockchainId, networks := range registry {
+		for network, tokens := range networks {
+			if network != Mainnet && network != Testnet {
+				return nil, fmt.Errorf("invalid network %s for blockchain %s", network, blockchainId)
+			}
+
+			symbols := make(map[string]bool)
+			for _, token := range tokens {
+				if symbols[token.Symbol] {
+					return nil, fmt.Errorf("duplicate token %s on %s %s", token.Symbol, blockchainId, network)
+				}
+				symbols[token.Symbol] = true
+
+				err = validateToken(token)
+				if err != nil {
+					return nil, fmt.Errorf("invalid token %s on %s %s: %s", token.Symbol, blockchainId, network, err)
+				}
+			}
+		}
+	}
+
+	return registry, nil
+}
+
+// validateToken checks the contract address of a token matches its standard
+func validateToken(token Token) error {
+	if token.Symbol == "" {
+		return fmt.Errorf("missing symbol")
+	}
+
+	switch token.Standard {
+	case TokenStandardNative:
+		if token.ContractAddress != "" {
+			return fmt.Errorf("native asset must not have a contract address")
+		}
+	case TokenStandardERC20, TokenStandardERC721:
+		if !common.IsHexAddress(token.ContractAddress) {
+			return fmt.Errorf("invalid contract address: %s", token.ContractAddress)
+		}
+	case TokenStandardASA:
+		// algorand standard assets are identified by their asset id
+		if _, err := strconv.ParseUint(token.ContractAddress, 10, 64); err != nil {
+			return fmt.Errorf("invalid asset id: %s", token.ContractAddress)
+		}
+	default:
+		return fmt.Errorf("unsupported token standard: %s", token.Standard)
+	}
+
+	return nil
+}
+
+// lookupToken returns the registry entry of a token on the configured network
+func lookupToken(blockchainId, tokenId string) (Token, error) {
+	for _, token := range Tokens[blockchainId][Network] {
+		if token.Symbol == tokenId {
+			return token, nil
+		}
+	}
+
+	return Token{}, fmt.Errorf("token %s is not supported on %s %s", tokenId, blockchainId, Network)
+}
+
+// lookupTokenByContract returns the registry entry of a token contract on the configured network
+func lookupTokenByContract(blockchainId, contractAddress string) (Token, error) {
+	for _, token := range Tokens[blockchainId][Network] {
+		if token.ContractAddress != "" && strings.EqualFold(token.ContractAddress, contractAddress) {
+			return token, nil
+		}
+	}
+
+	return Token{}, fmt.Errorf("contract %s is not in the token registry of %s %s", contractAddress, blockchainId, Network)
+}
+
+// validateTokenId checks a tokenId is supported on the blockchain, an empty tokenId refers to the native asset
+func validateTokenId(blockchainId, tokenId string) error {
+	if tokenId == "" {
+		return nil
+	}
+
+	_, err := lookupToken(blockchainId, tokenId)
+	return err
+}
+
+// GetTokens lists the supported tokens, optionally filtered by blockchainId and network
+func GetTokens(c *gin.Context) {
+	blockchainId := c.Query("blockchainId")
+	network := c.DefaultQuery("network", Network)
+
+	result := []TokenInfo{}
+	for _, id := range BlockchainIds {
+		if blockchainId != "" && blockchainId != id {
+			continue
+		}
+		for _, token := range Tokens[id][network] {
+			result = append(result, TokenInfo{BlockchainId: id, Network: network, Token: token})
+		}
+	}
+
+	ValidateAndWriteResponse(result, nil, c.Writer)
+	return
+}
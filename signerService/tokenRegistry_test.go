@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDefaultTokenRegistry(t *testing.T) {
+	registry, err := parseTokenRegistry(defaultTokenRegistry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, blockchainId := range BlockchainIds {
+		for _, network := range []string{Mainnet, Testnet} {
+			if len(registry[blockchainId][network]) == 0 {
+				t.Errorf("Missing tokens for %s %s", blockchainId, network)
+			}
+		}
+	}
+
+	if registry["ETH"][Mainnet][1].ContractAddress == registry["ETH"][Testnet][1].ContractAddress {
+		t.Error("ERC20 contract address should be network specific")
+	}
+}
+
+func TestParseTokenRegistry(t *testing.T) {
+	invalid := []string{
+		`{"ETH":{"devnet":[{"symbol":"ETH","decimals":18,"standard":"native"}]}}`,
+		`{"ETH":{"mainnet":[{"symbol":"ETH","decimals":18,"standard":"native"},{"symbol":"ETH","decimals":18,"standard":"native"}]}}`,
+		`{"ETH":{"mainnet":[{"symbol":"ETH","contractAddress":"0x01","decimals":18,"standard":"native"}]}}`,
+		`{"ETH":{"mainnet":[{"symbol":"QKC","contractAddress":"0x01","decimals":18,"standard":"ERC20"}]}}`,
+		`{"ALGO":{"mainnet":[{"symbol":"USDC","contractAddress":"usdc","decimals":6,"standard":"ASA"}]}}`,
+		`{"ETH":{"mainnet":[{"symbol":"QKC","decimals":18,"standard":"ERC1155"}]}}`,
+		`{"ETH":{"mainnet":[{"symbol":"ETH","decimals":256,"standard":"native"}]}}`,
+	}
+
+	for _, config := range invalid {
+		_, err := parseTokenRegistry([]byte(config))
+		if err == nil {
+			t.Errorf("Invalid registry should be rejected: %s", config)
+		}
+	}
+}
+
+func TestValidateTokenId(t *testing.T) {
+	if validateTokenId("ETH", "QKC") != nil || validateTokenId("ETH", "ETH") != nil || validateTokenId("ETH", "") != nil {
+		t.Error("Supported tokens should be accepted")
+	}
+
+	if validateTokenId("ETH", "USDC") == nil || validateTokenId("BTC", "QKC") == nil {
+		t.Error("Unsupported tokens should be rejected")
+	}
+
+	token, err := lookupToken("ALGO", "USDC")
+	if err != nil || token.Standard != TokenStandardASA || token.Decimals != 6 {
+		t.Error("Algorand standard asset lookup failed")
+	}
+}
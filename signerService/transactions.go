@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PostTransaction records a transaction of a user and broadcasts it through the node client
+// of the blockchain when the broadcast query parameter is true
+func PostTransaction(c *gin.Context) {
+	userId := c.Param("userId")
+	broadcast := c.Query("broadcast") == "true"
+
+	var tx BasicTx
+	err := json.NewDecoder(c.Request.Body).Decode(&tx)
+	if err != nil {
+		log.Error("Error decoding tx: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+	tx.UserId = userId
+
+	err = validateTokenId(tx.BlockchainId, tx.TokenId)
+	if err != nil {
+		log.Error("Error validating token: ", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	tx, err = prepareTransactionRecord(tx)
+	if err != nil {
+		log.Error("Error preparing tx record err:", err)
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	var DB *mongo.Client = ConnectDB()
+	txCollection := DB.Database(MongoDatabase).Collection("TxCollection")
+	defer CloseClientDB(DB)
+
+	_, err = readTx(tx.TxHash, txCollection)
+	if err == nil {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: transaction %s already recorded", tx.TxHash), c.Writer)
+		return
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Error("Error reading tx err:", err, ", txHash: ", tx.TxHash)
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	err = writeTx(tx, txCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	if tx.FromAddress != "" {
+		err = markNonceUsed(tx.BlockchainId, tx.FromAddress, tx.Nonce, tx.TxHash, DB.Database(MongoDatabase).Collection("NonceCollection"))
+		if err != nil {
+			log.Error("Error marking nonce used err:", err, ", txHash: ", tx.TxHash)
+		}
+	}
+
+	if broadcast {
+		client, ok := EVMClients[tx.BlockchainId]
+		if !ok {
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: no rpc client configured for blockchain: %s", tx.BlockchainId), c.Writer)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), RPCTimeout)
+		defer cancel()
+		tx, err = broadcastTransaction(ctx, client, tx)
+		if err != nil {
+			log.Error("Error broadcasting tx err:", err)
+			WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+
+		err = updateTx(tx.TxHash, tx, txCollection)
+		if err != nil {
+			WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Error: %s", err), c.Writer)
+			return
+		}
+	}
+
+	ValidateAndWriteResponse(tx, nil, c.Writer)
+	return
+}
+
+// GetTransactions returns the transactions of a user, optionally filtered with the status query parameter
+func GetTransactions(c *gin.Context) {
+	userId := c.Param("userId")
+	status := c.Query("status")
+
+	var DB *mongo.Client = ConnectDB()
+	txCollection := DB.Database(MongoDatabase).Collection("TxCollection")
+	defer CloseClientDB(DB)
+
+	txs, err := readUserTxs(userId, status, txCollection)
+	if err != nil {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: %s", err), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(txs, nil, c.Writer)
+	return
+}
+
+// GetTransaction returns a transaction of a user by its tx hash
+func GetTransaction(c *gin.Context) {
+	userId := c.Param("userId")
+	txHash := c.Param("txHash")
+
+	var DB *mongo.Client = ConnectDB()
+	txCollection := DB.Database(MongoDatabase).Collection("TxCollection")
+	defer CloseClientDB(DB)
+
+	tx, err := readTx(txHash, txCollection)
+	if err != nil || tx.UserId != userId {
+		WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Error: transaction %s not found", txHash), c.Writer)
+		return
+	}
+
+	ValidateAndWriteResponse(tx, nil, c.Writer)
+	return
+}
+
+// recordSignedTransaction records a transaction assembled and signed by the service
+func recordSignedTransaction(userId, blockchainId, accountName string, signedTx SignedTxResponse, txCollection *mongo.Collection) {
+	now := time.Now().UTC()
+	err := writeTx(BasicTx{
+		UserId:       userId,
+		BlockchainId: blockchainId,
+		AccountName:  accountName,
+		FullTx:       signedTx.SignedTx,
+		TxHash:       signedTx.TxHash,
+		Status:       TxSigned,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}, txCollection)
+	if err != nil {
+		log.Error("Error recording signed tx err:", err, ", txHash: ", signedTx.TxHash)
+	}
+}
+
+// prepareTransactionRecord sets the status and identifying fields of a new transaction record. EVM
+// transactions are decoded from FullTx, their hash, nonce and sender are taken from the transaction
+func prepareTransactionRecord(tx BasicTx) (BasicTx, error) {
+	now := time.Now().UTC()
+	tx.CreatedAt = now
+	tx.UpdatedAt = now
+
+	if !isEVMBlockchain(tx.BlockchainId) {
+		if tx.TxHash == "" {
+			return tx, fmt.Errorf("missing txHash")
+		}
+		if tx.Status != TxCreated {
+			tx.Status = TxSigned
+		}
+		return tx, nil
+	}
+
+	evmTx, err := decodeFullTx(tx.FullTx)
+	if err != nil {
+		return tx, err
+	}
+	if tx.TxHash != "" && !strings.EqualFold(tx.TxHash, evmTx.Hash().Hex()) {
+		return tx, fmt.Errorf("txHash %s does not match transaction hash %s", tx.TxHash, evmTx.Hash().Hex())
+	}
+
+	tx.TxHash = evmTx.Hash().Hex()
+	tx.Nonce = evmTx.Nonce()
+	if evmTx.To() != nil {
+		tx.ToAddress = evmTx.To().Hex()
+	}
+
+	tx.Status = TxCreated
+	if isSignedEVMTransaction(evmTx) {
+		from, err := types.Sender(types.LatestSignerForChainID(evmTx.ChainId()), evmTx)
+		if err != nil {
+			return tx, fmt.Errorf("Error recovering transaction sender: %s", err)
+		}
+		tx.FromAddress = from.Hex()
+		tx.Status = TxSigned
+	}
+
+	return tx, nil
+}
+
+// broadcastTransaction submits a signed EVM transaction to the node
+func broadcastTransaction(ctx context.Context, client EVMClient, tx BasicTx) (BasicTx, error) {
+	if tx.Status != TxSigned {
+		return tx, fmt.Errorf("only signed transactions can be broadcast, status: %s", tx.Status)
+	}
+
+	evmTx, err := decodeFullTx(tx.FullTx)
+	if err != nil {
+		return tx, err
+	}
+	rawTx, err := evmTx.MarshalBinary()
+	if err != nil {
+		return tx, err
+	}
+
+	err = client.SendRawTransaction(ctx, rawTx)
+	if err != nil {
+		return tx, err
+	}
+
+	tx.Status = TxBroadcast
+	tx.UpdatedAt = time.Now().UTC()
+	return tx, nil
+}
+
+// pollTransaction moves a broadcast transaction to confirmed or failed once its receipt is available.
+// A transaction without receipt whose nonce was used by another mined transaction was replaced
+func pollTransaction(ctx context.Context, client EVMClient, tx BasicTx) (BasicTx, bool, error) {
+	receipt, err := client.TransactionReceipt(ctx, tx.TxHash)
+	if err != nil {
+		return tx, false, err
+	}
+
+	if receipt != nil {
+		tx.Status = TxConfirmed
+		if receipt.Status == types.ReceiptStatusFailed {
+			tx.Status = TxFailed
+		}
+		tx.BlockNumber = receipt.BlockNumber
+		tx.UpdatedAt = time.Now().UTC()
+		return tx, true, nil
+	}
+
+	nonce, err := client.NonceAt(ctx, tx.FromAddress)
+	if err != nil {
+		return tx, false, err
+	}
+	if nonce > tx.Nonce {
+		// the receipt is read again since the transaction could have been mined since the first request
+		receipt, err = client.TransactionReceipt(ctx, tx.TxHash)
+		if err != nil || receipt != nil {
+			return tx, false, err
+		}
+		tx.Status = TxReplaced
+		tx.UpdatedAt = time.Now().UTC()
+		return tx, true, nil
+	}
+
+	return tx, false, nil
+}
+
+// trackTransactions polls the receipts of broadcast transactions and updates their status
+func trackTransactions() {
+	for {
+		time.Sleep(TxPollInterval)
+
+		var DB *mongo.Client = ConnectDB()
+		txCollection := DB.Database(MongoDatabase).Collection("TxCollection")
+
+		txs, err := readTxsByStatus(TxBroadcast, txCollection)
+		if err != nil {
+			log.Error("Error reading broadcast txs err:", err)
+		}
+
+		for _, tx := range txs {
+			client, ok := EVMClients[tx.BlockchainId]
+			if !ok {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+			tx, changed, err := pollTransaction(ctx, client, tx)
+			cancel()
+			if err != nil {
+				log.Error("Error polling tx err:", err, ", txHash: ", tx.TxHash)
+				continue
+			}
+			if changed {
+				err = updateTx(tx.TxHash, tx, txCollection)
+				if err != nil {
+					log.Error("Error updating tx err:", err, ", txHash: ", tx.TxHash)
+				}
+			}
+		}
+
+		CloseClientDB(DB)
+	}
+}
+
+// decodeFullTx decodes the JSON stringified EVM transaction of a BasicTx
+func decodeFullTx(fullTx string) (*types.Transaction, error) {
+	var evmTx types.Transaction
+	err := evmTx.UnmarshalJSON([]byte(fullTx))
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding transaction: %s", err)
+	}
+	return &evmTx, nil
+}
+
+// isSignedEVMTransaction reports whether the signature values of a transaction are set
+func isSignedEVMTransaction(evmTx *types.Transaction) bool {
+	_, r, s := evmTx.RawSignatureValues()
+	return r.Sign() != 0 && s.Sign() != 0
+}
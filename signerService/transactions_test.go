@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// signedTestTx returns a JSON stringified transaction signed by private key 1 and its sender
+func signedTestTx(nonce uint64) (string, string) {
+	key, _ := crypto.ToECDSA(common.LeftPadBytes([]byte{1}, 32))
+	to := common.HexToAddress("0xba536245A30404A983E120a3d07A7dF260a89669")
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+	signedTx, _ := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+		ChainID: big.NewInt(1), Nonce: nonce, To: &to, Gas: 21000,
+		GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2), Value: big.NewInt(1),
+	})
+	fullTx, _ := json.Marshal(signedTx)
+	return string(fullTx), crypto.PubkeyToAddress(key.PublicKey).Hex()
+}
+
+func TestPrepareTransactionRecord(t *testing.T) {
+	fullTx, from := signedTestTx(3)
+	record, err := prepareTransactionRecord(BasicTx{BlockchainId: "ETH", FullTx: fullTx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != TxSigned || record.FromAddress != from || record.Nonce != 3 || record.TxHash == "" {
+		t.Error("Signed transaction record should carry sender, nonce and hash")
+	}
+
+	unsigned, err := prepareTransactionRecord(BasicTx{BlockchainId: "ETH", FullTx: tx.FullTx})
+	if err != nil || unsigned.Status != TxCreated || unsigned.FromAddress != "" {
+		t.Error("Unsigned transaction should be recorded as created")
+	}
+
+	_, err = prepareTransactionRecord(BasicTx{BlockchainId: "ETH", FullTx: fullTx, TxHash: tx.TxHash})
+	if err == nil {
+		t.Error("Mismatching txHash should be rejected")
+	}
+}
+
+func TestTransactionLifecycle(t *testing.T) {
+	fullTx, from := signedTestTx(3)
+	record, _ := prepareTransactionRecord(BasicTx{BlockchainId: "ETH", FullTx: fullTx})
+	client := &fakeEVMClient{nonces: map[string]uint64{from: 3}, receipts: map[string]*TxReceipt{}}
+
+	_, err := broadcastTransaction(context.Background(), client, BasicTx{Status: TxCreated, FullTx: tx.FullTx})
+	if err == nil {
+		t.Error("Unsigned transaction should not be broadcast")
+	}
+
+	record, err = broadcastTransaction(context.Background(), client, record)
+	if err != nil || record.Status != TxBroadcast || len(client.sent) != 1 {
+		t.Fatal("Signed transaction should be broadcast")
+	}
+
+	_, changed, err := pollTransaction(context.Background(), client, record)
+	if err != nil || changed {
+		t.Error("Pending transaction should stay broadcast")
+	}
+
+	client.receipts[record.TxHash] = &TxReceipt{Status: types.ReceiptStatusSuccessful, BlockNumber: 100}
+	confirmed, changed, err := pollTransaction(context.Background(), client, record)
+	if err != nil || !changed || confirmed.Status != TxConfirmed || confirmed.BlockNumber != 100 {
+		t.Error("Mined transaction should be confirmed")
+	}
+
+	client.receipts[record.TxHash] = &TxReceipt{Status: types.ReceiptStatusFailed, BlockNumber: 100}
+	failed, _, _ := pollTransaction(context.Background(), client, record)
+	if failed.Status != TxFailed {
+		t.Error("Reverted transaction should be failed")
+	}
+
+	delete(client.receipts, record.TxHash)
+	client.nonces[from] = 4
+	replaced, changed, err := pollTransaction(context.Background(), client, record)
+	if err != nil || !changed || replaced.Status != TxReplaced {
+		t.Error("Transaction whose nonce was mined by another transaction should be replaced")
+	}
+}
@@ -53,9 +53,6 @@ func wsHandler(c *gin.Context) {
 		log.Error("Error generating hash bytes:", err)
 	}
 
-	// initialize values for processing rounds
-	var stateJson, round1JSON, round2JSON, round3JSON, round4JSON, round5JSON, round6JSON string
-
 	//get key share collection
 	var DB *mongo.Client = ConnectDB()
 	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
@@ -65,7 +62,96 @@ func wsHandler(c *gin.Context) {
 	if err != nil {
 		log.Error("Error reading share err:", err)
 	}
+	CloseClientDB(DB)
+
+	//sign for a derived child address when a derivation path is given
+	share, err = applyDerivationPath(share, c.Request.URL.Query().Get("derivationPath"))
+	if err != nil {
+		log.Error("Error applying derivation path err:", err)
+		return
+	}
+
+	// the signature of the transaction hash is recorded once the last round completes
+	signed := func(signature string) {
+		var DB *mongo.Client = ConnectDB()
+		defer CloseClientDB(DB)
+		recordSignedTransaction(userId, blockchainId, accountName, SignedTxResponse{TxHash: messageHash, SignedTx: signature}, DB.Database(MongoDatabase).Collection("TxCollection"))
+	}
+
+	processSigningRounds(conn, share, hashBytes, messageHash, userId, nil, signed)
+}
+
+// wsMessageHandler is function for managing websocket connection endpoint
+// for signing an arbitrary message with the blockchain specific signed message prefix
+// (EIP-191 personal_sign for ETH style chains, BIP-137 for BTC)
+func wsMessageHandler(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Print("upgrade:", err)
+		return
+	}
+	defer conn.Close()
+
+	userId := c.Param("userId")
+	blockchainId := c.Param("blockchainId")
+	accountName := c.Param("accountName")
+	message := c.Request.URL.Query().Get("message")
+	encoding := c.Request.URL.Query().Get("encoding")
+	addressType := c.Request.URL.Query().Get("addressType")
+
+	messageBytes, err := decodeMessage(message, encoding)
+	if err != nil {
+		log.Error("Error decoding message:", err)
+		return
+	}
+
+	//apply the signed message prefix and hashing for the blockchain
+	hashBytes, err := prepareMessageHash(messageBytes, blockchainId)
+	if err != nil {
+		log.Error("Error generating message hash:", err)
+		return
+	}
+	messageHash := hex.EncodeToString(hashBytes)
+
+	log.Info("Websocket message signing: ", userId, blockchainId, messageHash)
+
+	var DB *mongo.Client = ConnectDB()
+	keyShareCollection := DB.Database(MongoDatabase).Collection("KeyShareCollection")
+
+	share, err := readECDSAShare(userId, blockchainId, accountName, keyShareCollection)
+	CloseClientDB(DB)
+	if err != nil {
+		log.Error("Error reading share err:", err)
+		return
+	}
+
+	share, err = applyDerivationPath(share, c.Request.URL.Query().Get("derivationPath"))
+	if err != nil {
+		log.Error("Error applying derivation path err:", err)
+		return
+	}
 
+	pk, err := parseECDSAPublicKey(share.ShareData.PK)
+	if err != nil {
+		log.Error("Error reading public key err:", err)
+		return
+	}
+
+	// once the client combines the signature it is returned in the ecosystem specific format
+	finalize := func(signature string) (string, error) {
+		return formatMessageSignature(signature, hashBytes, pk, blockchainId, addressType)
+	}
+
+	processSigningRounds(conn, share, hashBytes, messageHash, userId, finalize, nil)
+}
+
+// processSigningRounds runs the ECDSA MPC signing rounds with the other participant over the
+// websocket connection. When finalize is set the client can submit the combined signature in a
+// "signature" round and receives the finalized signature back in a "signed" round. When signed is
+// set it is called with the signature of a successful round6
+func processSigningRounds(conn *websocket.Conn, share KeyShare, hashBytes []byte, messageHash, userId string, finalize func(string) (string, error), signed func(string)) {
+	// initialize values for processing rounds
+	var stateJson, round1JSON, round2JSON, round3JSON, round4JSON, round5JSON, round6JSON string
 	//get participant id used during MPC key generation and distribution
 	participantId, ok := os.LookupEnv("PARTICIPANTID")
 	if !ok {
@@ -144,9 +230,24 @@ func wsHandler(c *gin.Context) {
 			round6JSON, stateJson, err = WsSignerService.WSPerformECDSARound6(ep.ECDSAParticipant(share.ShareData), stateJson, broadcast1Map, hashBytes, signers)
 			if err != nil {
 				log.Error("Error round 2: ", err, ", msg:", messageHash, ", userId: ", userId)
+			} else if signed != nil {
+				signed(round6JSON)
 			}
 			broadcast1Map[participantId] = round6JSON
 			response = SigningRounds{Identifier: participantId, Round: "signature", Message: round6JSON}
+		case "signature":
+			log.Info("Operation: ", op)
+			if finalize == nil {
+				log.Error("Signature finalization not supported, msg:", messageHash, ", userId: ", userId)
+				continue
+			}
+			signature, err := finalize(signingMessage.Message)
+			if err != nil {
+				log.Error("Error finalizing signature: ", err, ", msg:", messageHash, ", userId: ", userId)
+				response = SigningRounds{Identifier: participantId, Round: "error", Message: err.Error()}
+				break
+			}
+			response = SigningRounds{Identifier: participantId, Round: "signed", Message: signature}
 		}
 
 		//prepare standard response to transmit back over websocket to
@@ -169,6 +270,7 @@ func prepareHash(messageHash, blockchainId string) ([]byte, error) {
 		return hash[:], nil
 
 	case "AVAX":
+		// C chain transaction hash, or the sha256 hash of an X or P chain transaction
 		hash := common.HexToHash(messageHash)
 		return hash[:], nil
 